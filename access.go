@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// checkHostAllowed reports an error if the operator's allowlist
+// (MCPSSH_ALLOWED_HOSTS) doesn't permit host. An empty allowlist permits
+// every remote host. host may carry a user ("deploy@web01"); only the host
+// part is matched, case-insensitively, against the glob patterns.
+func checkHostAllowed(host string) error {
+	if len(config.AllowedHosts) == 0 {
+		return nil
+	}
+	name := host
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+	for _, pattern := range config.AllowedHosts {
+		if ok, err := path.Match(strings.ToLower(pattern), name); ok && err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not in the allowed hosts list", host)
+}
+
+// checkJumpHostAllowed applies the allowed hosts list to a jump host spec.
+func checkJumpHostAllowed(spec string) error {
+	hop, err := parseJumpHost(spec)
+	if err != nil {
+		return err
+	}
+	if checkHostAllowed(hop.Host) != nil {
+		return fmt.Errorf("jump host %q is not in the allowed hosts list", spec)
+	}
+	return nil
+}
+
+// checkLocalAllowed reports an error if local shell sessions are turned off
+// (MCPSSH_ALLOW_LOCAL=false or MCPSSH_DISABLE_LOCAL=true). Every tool that
+// spawns a local process must call it.
+func checkLocalAllowed() error {
+	if !config.AllowLocal {
+		return fmt.Errorf("local sessions are disabled on this server")
+	}
+	return nil
+}
+
+// splitList parses a comma-separated setting, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// denylist holds the operator's blocked-input patterns, loaded at startup
+// from MCPSSH_DENY_PATTERNS and MCPSSH_DENYLIST_FILE. Empty by default.
+var denylist []*regexp.Regexp
+
+// loadDenylist compiles the deny pattern and the patterns in file (one
+// regular expression per line; blank lines and '#' comments are skipped).
+// Either may be empty.
+func loadDenylist(pattern, file string) ([]*regexp.Regexp, error) {
+	var exprs []string
+	if pattern != "" {
+		exprs = append(exprs, pattern)
+	}
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("denylist: %w", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				exprs = append(exprs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("denylist %s: %w", file, err)
+		}
+	}
+
+	rules := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("denylist pattern %q: %w", expr, err)
+		}
+		rules = append(rules, re)
+	}
+	return rules, nil
+}
+
+// checkInputAllowed rejects input matching a denylist pattern, logging the
+// attempt, then applies the input policy, which may ask the user to
+// confirm. Callers must check before anything is written to the PTY.
+func checkInputAllowed(ctx context.Context, sessID, input string) error {
+	for _, re := range denylist {
+		if re.MatchString(input) {
+			logger.Warn("blocked input", "session_id", sessID, "pattern", re.String(), "input", input)
+			return fmt.Errorf("input blocked by the server's command denylist (pattern %q); it was not sent", re.String())
+		}
+	}
+	return policy.check(ctx, sessID, input)
+}
+
+// checkContinuedInput checks input that continues a line earlier input to s
+// left unterminated, joined to that line as the shell will read it, so a
+// command split across calls can't slip past checkInputAllowed, which the
+// caller has already applied to input on its own. It then records the line
+// input leaves unterminated, if any.
+func (s *Session) checkContinuedInput(ctx context.Context, input string) error {
+	s.bufMu.Lock()
+	line := s.partialInput + input
+	s.bufMu.Unlock()
+	if line != input {
+		if err := checkInputAllowed(ctx, s.ID, line); err != nil {
+			return err
+		}
+	}
+	s.bufMu.Lock()
+	s.partialInput = line[strings.LastIndexAny(line, "\r\n")+1:]
+	s.bufMu.Unlock()
+	return nil
+}
+
+// checkWritable rejects sending anything to a read-only session: input,
+// keystrokes, signals or uploads.
+func (s *Session) checkWritable() error {
+	if s.readOnly {
+		return fmt.Errorf("session %s is read-only: its output can be read, but nothing can be sent to it", s.ID)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCheckHostAllowed(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	config.AllowedHosts = nil
+	if err := checkHostAllowed("anything.example.com"); err != nil {
+		t.Errorf("Expected an empty allowlist to permit every host, got %v", err)
+	}
+
+	config.AllowedHosts = splitList("web*.prod.example.com, bastion ,10.0.0.?,::1")
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"web01.prod.example.com", true},
+		{"deploy@WEB02.prod.example.com", true},
+		{"bastion", true},
+		{"10.0.0.5", true},
+		{"[::1]", true},
+		{"db01.prod.example.com", false},
+		{"bastion.evil.com", false},
+		{"10.0.0.50", false},
+	}
+	for _, tt := range tests {
+		if err := checkHostAllowed(tt.host); (err == nil) != tt.allowed {
+			t.Errorf("checkHostAllowed(%q) = %v, want allowed=%v", tt.host, err, tt.allowed)
+		}
+	}
+}
+
+func TestStartSessionAccessGates(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.AllowedHosts = []string{"web*"}
+	config.AllowLocal = false
+
+	start := func(host string) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"host": host, "dry_run": true}
+		result, _ := startSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	if text, isErr := start("db01"); !isErr || !strings.Contains(text, "not in the allowed hosts list") {
+		t.Errorf("Expected db01 to be denied, got: %s", text)
+	}
+	if text, isErr := start("local"); !isErr || !strings.Contains(text, "local sessions are disabled") {
+		t.Errorf("Expected local to be denied, got: %s", text)
+	}
+	if text, isErr := start("web01"); isErr && strings.Contains(text, "allowed") {
+		t.Errorf("Expected web01 to pass the allowlist, got: %s", text)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "web01", "jump_hosts": []any{"ops@bastion"}, "dry_run": true}
+	result, _ := startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; !result.IsError || !strings.Contains(text, "jump host") {
+		t.Errorf("Expected a jump host outside the allowlist to be denied, got: %s", text)
+	}
+}
+
+func TestDisableLocal(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	t.Setenv("MCPSSH_DISABLE_LOCAL", "true")
+	config = loadConfig()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "local"}
+	result, _ := startSessionHandler(context.Background(), req)
+	text := result.Content[0].(mcp.TextContent).Text
+	if !result.IsError || !strings.Contains(text, "local sessions are disabled") {
+		t.Errorf("Expected local to be blocked with MCPSSH_DISABLE_LOCAL set, got: %s", text)
+	}
+
+	sess := &Session{ID: "test-disabled-local", Cmd: exec.Command("/bin/sh"), done: make(chan struct{}), exited: make(chan struct{})}
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+	req.Params.Arguments = map[string]any{"session_id": sess.ID}
+	result, _ = restartShellHandler(context.Background(), req)
+	text = result.Content[0].(mcp.TextContent).Text
+	if !result.IsError || !strings.Contains(text, "local sessions are disabled") {
+		t.Errorf("Expected restart_shell to be blocked too, got: %s", text)
+	}
+}
+
+func TestLoadDenylist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deny.txt")
+	os.WriteFile(file, []byte("# destructive commands\n\\brm\\s+-rf\\b\n\n\\bshutdown\\b\n"), 0o600)
+
+	rules, err := loadDenylist(`\bdd\s+if=`, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+	if _, err := loadDenylist("(unclosed", ""); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+	if _, err := loadDenylist("", file+".missing"); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+	if rules, err := loadDenylist("", ""); err != nil || len(rules) != 0 {
+		t.Errorf("Expected an empty denylist by default, got %v, %v", rules, err)
+	}
+}
+
+func TestStartSessionCommandChecked(t *testing.T) {
+	savedDeny, savedPolicy := denylist, policy
+	defer func() { denylist, policy = savedDeny, savedPolicy }()
+	denylist, _ = loadDenylist(`\brm\s+-rf\b`, "")
+	var err error
+	if policy, err = loadPolicy(writePolicy(t, "rules:\n  - action: deny\n    pattern: '\\bmkfs\\b'\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	start := func(program string, argv ...string) (string, bool) {
+		return callTool(startSessionHandler, map[string]any{"host": "local", "command": program, "args": argv, "dry_run": true})
+	}
+	if text, isErr := start("sh", "-c", "rm -rf /"); !isErr || !strings.Contains(text, "denylist") {
+		t.Errorf("Expected the denylist to block the command, got: %s", text)
+	}
+	if text, isErr := start("mkfs.ext4", "/dev/sda1"); !isErr || !strings.Contains(text, "policy") {
+		t.Errorf("Expected the policy to deny the command, got: %s", text)
+	}
+	if text, isErr := start("cat", "-n"); isErr {
+		t.Errorf("Expected an allowed command to pass, got: %s", text)
+	}
+
+	// A saved command is checked again when the session is revived
+	restored := restoredSession(sessionRecord{ID: "test-restored-command", Host: "local", Command: []string{"sh", "-c", "rm -rf /"}})
+	manager.Add(restored)
+	defer manager.Remove(restored.ID)
+	if text, isErr := callTool(reconnectSessionHandler, map[string]any{"session_id": restored.ID}); !isErr || !strings.Contains(text, "denylist") {
+		t.Errorf("Expected the denylist to block the saved command, got: %s", text)
+	}
+}
+
+func TestInteractDenylist(t *testing.T) {
+	saved := denylist
+	defer func() { denylist = saved }()
+	denylist, _ = loadDenylist(`\brm\s+-rf\b`, "")
+
+	sess := startTestSession(t, "test-denylist", "/bin/sh")
+
+	interact := func(input string) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": input, "wait_duration": "0.3"}
+		result, _ := interactSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	text, isErr := interact("rm -rf /tmp/mcpssh-denylist-test\n")
+	if !isErr || !strings.Contains(text, "denylist") {
+		t.Errorf("Expected the command to be blocked, got: %s", text)
+	}
+	if text, isErr = interact("echo allowed-$((1+1))\n"); isErr || !strings.Contains(text, "allowed-2") {
+		t.Errorf("Expected the allowed command to run, got: %s", text)
+	}
+	if strings.Contains(text, "rm -rf") {
+		t.Errorf("Blocked input reached the terminal: %s", text)
+	}
+
+	// Split across calls, the command is checked as the shell reads it
+	if text, isErr = interact("rm -r"); isErr {
+		t.Fatalf("Expected the unterminated start of a line to pass, got: %s", text)
+	}
+	if text, isErr = interact("f /tmp/mcpssh-denylist-test\n"); !isErr || !strings.Contains(text, "denylist") {
+		t.Errorf("Expected the completed line to be blocked, got: %s", text)
+	}
+}
+
+func TestReadOnlySession(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "read-only-test", "read_only": true}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("read-only-test")
+	defer manager.Remove(sess.ID)
+
+	for _, call := range []struct {
+		name string
+		h    func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		args map[string]any
+	}{
+		{"interact_session input", interactSessionHandler, map[string]any{"input": "touch /tmp/mcpssh-read-only\n"}},
+		{"interact_session send_eof", interactSessionHandler, map[string]any{"send_eof": true}},
+		{"interact_session command_timeout", interactSessionHandler, map[string]any{"command_timeout": "1"}},
+		{"send_signal", sendSignalHandler, map[string]any{}},
+		{"run_command", runCommandHandler, map[string]any{"command": "true"}},
+		{"expect", expectHandler, map[string]any{"steps": []any{map[string]any{"send": "true\n", "expect_regex": "."}}}},
+		{"clear_buffer", clearBufferHandler, map[string]any{"newlines": 1}},
+	} {
+		call.args["session_id"] = sess.ID
+		if text, isErr := callTool(call.h, call.args); !isErr || !strings.Contains(text, "read-only") {
+			t.Errorf("%s: expected it to be rejected, got: %s", call.name, text)
+		}
+	}
+	if text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "wait_duration": "0.1"}); isErr {
+		t.Errorf("Expected reading to work, got: %s", text)
+	}
+	if !sess.describe().ReadOnly {
+		t.Errorf("Expected describe_session to report the session read-only")
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "regexp"
+
+// ansiRe matches terminal escape sequences: CSI sequences (colors, cursor
+// movement, erasing), OSC sequences (window titles, hyperlinks), DCS and
+// similar string sequences, and the short two- and three-byte escapes
+// (charset selection, keypad modes).
+var ansiRe = regexp.MustCompile(
+	"\x1b\\[[0-?]*[ -/]*[@-~]" + // CSI
+		"|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)" + // OSC, ended by BEL or ST
+		"|\x1b[PX^_][^\x1b]*\x1b\\\\" + // DCS, SOS, PM, APC
+		"|\x1b[ -/]*[0-~]") // Everything else
+
+// stripANSI removes terminal escape sequences from s, leaving the text.
+func stripANSI(s string) string {
+	return ansiRe.ReplaceAllString(s, "")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello\r\nworld", "hello\r\nworld"},
+		{"colors", "\x1b[01;34mdir\x1b[0m  \x1b[32mexec\x1b[m", "dir  exec"},
+		{"cursor and erase", "\x1b[2J\x1b[H\x1b[?25lmenu\x1b[K\x1b[10;5H!", "menu!"},
+		{"window title", "\x1b]0;user@host: ~\x07$ ", "$ "},
+		{"hyperlink", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"bracketed paste", "\x1b[?2004h$ ls\r\n\x1b[?2004l", "$ ls\r\n"},
+		{"charset and keypad", "\x1b(B\x1b=text\x1b>", "text"},
+		{"dcs", "\x1bP1$r0m\x1b\\ok", "ok"},
+		{"utf-8 untouched", "naïve — ✓", "naïve — ✓"},
+	}
+	for _, tt := range tests {
+		if got := stripANSI(tt.in); got != tt.want {
+			t.Errorf("%s: stripANSI(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInteractStripANSI(t *testing.T) {
+	sess := runTestSession(t, &Session{ID: "test-strip-ansi", stripANSI: true}, "/bin/sh")
+	time.Sleep(200 * time.Millisecond)
+	sess.Clear()
+
+	colored := `printf '\033[31mred\033[0m\n'` + "\n"
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": colored, "strip_echo": true}); !strings.Contains(text, "red") || strings.Contains(text, "\x1b") {
+		t.Errorf("Expected the session default to strip escapes, got %q", text)
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": colored, "strip_ansi": false}); !strings.Contains(text, "\x1b[31mred") {
+		t.Errorf("Expected strip_ansi=false to keep escapes, got %q", text)
+	}
+}
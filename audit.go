@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxAuditText caps each argument and the result recorded per audit entry;
+// the audit log says what was done, the transcript holds the full output.
+const maxAuditText = 4096
+
+// secretArgs are tool arguments never written to the audit log.
+var secretArgs = map[string]bool{"password": true, "passphrase": true, "sudo_password": true}
+
+// redactedEnv returns start_session's env argument with every value
+// redacted and the variable names kept.
+func redactedEnv(v any) any {
+	env, ok := v.(map[string]any)
+	if !ok {
+		return "[redacted]"
+	}
+	redacted := make(map[string]any, len(env))
+	for name := range env {
+		redacted[name] = "[redacted]"
+	}
+	return redacted
+}
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time       time.Time      `json:"time"`
+	Tool       string         `json:"tool"`
+	Client     string         `json:"client,omitempty"` // MCP session of the caller
+	SessionID  string         `json:"session_id,omitempty"`
+	Host       string         `json:"host,omitempty"`
+	Arguments  map[string]any `json:"arguments,omitempty"`
+	Error      bool           `json:"error,omitempty"`
+	Result     string         `json:"result,omitempty"`
+	Truncated  bool           `json:"truncated,omitempty"` // Result (or an argument) was cut to maxAuditText
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// auditKey carries the audit entry of a tool call in its context.
+type auditKey struct{}
+
+// auditSession records in the audit entry of the call in ctx, if any, that
+// it concerns sess; start_session uses it to log the ID it assigned.
+func auditSession(ctx context.Context, sess *Session) {
+	if e, ok := ctx.Value(auditKey{}).(*auditEntry); ok {
+		e.SessionID, e.Host = sess.ID, sess.Host
+	}
+}
+
+// auditLog appends an auditEntry per tool call to a file, as JSON lines.
+type auditLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// audit is the audit log, or nil if disabled.
+var audit *auditLog
+
+// openAuditLog opens path for appending, creating it private to the user.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (a *auditLog) write(e auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(e); err != nil {
+		logger.Error("audit log write failed", "err", err)
+	}
+}
+
+// auditMiddleware records every tool call in the audit log: who called
+// what on which session and host, the input sent (secrets redacted) and
+// the start of the result.
+func auditMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if audit == nil {
+			return next(ctx, req)
+		}
+		e := auditEntry{Time: time.Now(), Tool: req.Params.Name, SessionID: req.GetString("session_id", "")}
+		if cs := server.ClientSessionFromContext(ctx); cs != nil {
+			e.Client = cs.SessionID()
+		}
+		// Resolved up front: close_session removes the session
+		if sess, ok := manager.Lookup(e.SessionID); ok {
+			e.SessionID, e.Host = sess.ID, sess.Host
+		} else if host := req.GetString("host", ""); host != "" {
+			e.Host = host
+		}
+		if args := req.GetArguments(); len(args) > 0 {
+			e.Arguments = make(map[string]any, len(args))
+			for k, v := range args {
+				switch {
+				case secretArgs[k]:
+					v = "[redacted]"
+				case k == "content_base64":
+					v = "[omitted]" // Uploaded file contents
+				case k == "env":
+					v = redactedEnv(v) // Values may be tokens; the names say what was set
+				default:
+					if s, ok := v.(string); ok && len(s) > maxAuditText {
+						v, e.Truncated = s[:maxAuditText], true
+					}
+				}
+				e.Arguments[k] = v
+			}
+		}
+
+		result, err := next(context.WithValue(ctx, auditKey{}, &e), req)
+		e.DurationMS = time.Since(e.Time).Milliseconds()
+		switch {
+		case err != nil:
+			e.Error, e.Result = true, err.Error()
+		case result != nil:
+			e.Error, e.Result = result.IsError, resultText(result)
+		}
+		if len(e.Result) > maxAuditText {
+			e.Result, e.Truncated = e.Result[:maxAuditText], true
+		}
+		audit.write(e)
+		return result, err
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var err error
+	if audit, err = openAuditLog(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { audit = nil }()
+
+	call := func(name string, h server.ToolHandlerFunc, args map[string]any) *mcp.CallToolResult {
+		req := mcp.CallToolRequest{}
+		req.Params.Name, req.Params.Arguments = name, args
+		result, _ := auditMiddleware(h)(context.Background(), req)
+		return result
+	}
+	if res := call("start_session", startSessionHandler, map[string]any{"host": "local", "name": "audit-test", "password": "hunter2", "env": map[string]any{"API_TOKEN": "s3cret-token"}}); res.IsError {
+		t.Skipf("Skipping local session test: %s", resultText(res))
+	}
+	sess, _ := manager.Lookup("audit-test")
+	long := strings.Repeat("x", maxAuditText+100)
+	call("interact_session", interactSessionHandler, map[string]any{"session_id": "audit-test", "input": "echo " + long + "\n", "wait_duration": "0.3"})
+	call("close_session", closeSessionHandler, map[string]any{"session_id": "audit-test"})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid audit line %s: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d", len(entries))
+	}
+	for i, tool := range []string{"start_session", "interact_session", "close_session"} {
+		if e := entries[i]; e.Tool != tool || e.SessionID != sess.ID || e.Host != "local" || e.Time.IsZero() {
+			t.Errorf("Entry %d: expected %s on session %s (local), got %s on %s (%s)", i, tool, sess.ID, e.Tool, e.SessionID, e.Host)
+		}
+	}
+	if pw := entries[0].Arguments["password"]; pw != "[redacted]" {
+		t.Errorf("Expected the password to be redacted, got %v", pw)
+	}
+	if env, _ := entries[0].Arguments["env"].(map[string]any); len(env) != 1 || env["API_TOKEN"] != "[redacted]" {
+		t.Errorf("Expected the env names kept and values redacted, got %v", entries[0].Arguments["env"])
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "s3cret-token") {
+		t.Error("An env value reached the audit log")
+	}
+	if in, _ := entries[1].Arguments["input"].(string); len(in) != maxAuditText || !entries[1].Truncated {
+		t.Errorf("Expected the input to be truncated to %d bytes, got %d", maxAuditText, len(in))
+	}
+	if !strings.Contains(entries[2].Result, "closed") {
+		t.Errorf("Expected the close result to be recorded, got %q", entries[2].Result)
+	}
+}
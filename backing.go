@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Terminal multiplexers a remote shell can run inside, so that it survives
+// the ssh connection (and mcpssh) going away and can be attached again.
+const (
+	BackingTmux   = "tmux"
+	BackingScreen = "screen"
+)
+
+func validBacking(backing string) bool {
+	return backing == "" || backing == BackingTmux || backing == BackingScreen
+}
+
+// validBackingName matches tmux and screen session names that need no
+// quoting in the remote command. tmux rewrites '.' and ':', so they are out.
+var validBackingName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// unsafeBackingChars matches characters kept out of generated names.
+var unsafeBackingChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// newBackingName names the tmux or screen session of a new mcpssh session:
+// after its name if it has one, so a later start_session with that name
+// finds it again, else a random one.
+func newBackingName(name string) string {
+	if name != "" {
+		if n := "mcpssh-" + unsafeBackingChars.ReplaceAllString(name, "_"); validBackingName.MatchString(n) {
+			return n
+		}
+	}
+	return "mcpssh-" + uuid.NewString()[:8]
+}
+
+// checkBacking validates the backing settings of opts.
+func checkBacking(opts *SSHOptions) error {
+	if !validBacking(opts.Backing) {
+		return fmt.Errorf("invalid backing %q (use '%s' or '%s')", opts.Backing, BackingTmux, BackingScreen)
+	}
+	if opts.Backing == "" {
+		return nil
+	}
+	if opts.PTYMode == PTYDisable {
+		return fmt.Errorf("backing %s needs a remote PTY; it can't be used with pty_mode 'disable'", opts.Backing)
+	}
+	if !validBackingName.MatchString(opts.BackingSession) {
+		return fmt.Errorf("invalid %s session name %q (letters, digits, '_' and '-' only)", opts.Backing, opts.BackingSession)
+	}
+	return nil
+}
+
+// backingCommand returns the remote command that attaches to the session's
+// tmux or screen session, starting it if it doesn't exist (any more), or ""
+// to run the login shell directly.
+func (opts SSHOptions) backingCommand() string {
+	switch opts.Backing {
+	case BackingTmux:
+		return "tmux new-session -A -s " + opts.BackingSession
+	case BackingScreen:
+		return "screen -D -R -S " + opts.BackingSession // Detaching any other client
+	}
+	return ""
+}
+
+// backingKillCommand returns the remote command that ends the session's
+// tmux or screen session, or "" if it has none.
+func (opts SSHOptions) backingKillCommand() string {
+	switch opts.Backing {
+	case BackingTmux:
+		return "tmux kill-session -t " + opts.BackingSession
+	case BackingScreen:
+		return "screen -S " + opts.BackingSession + " -X quit"
+	}
+	return ""
+}
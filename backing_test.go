@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartSessionBacking(t *testing.T) {
+	fakeSSH(t)
+	for _, tc := range []struct {
+		args map[string]any
+		want string // In the command line, or in the error if wantErr
+		err  bool
+	}{
+		{map[string]any{"backing": "tmux", "name": "db"}, "-- web01 'tmux new-session -A -s mcpssh-db'", false},
+		{map[string]any{"backing": "screen", "name": "db"}, "-- web01 'screen -D -R -S mcpssh-db'", false},
+		{map[string]any{"reattach": "work"}, "-- web01 'tmux new-session -A -s work'", false}, // tmux by default
+		{map[string]any{}, "-- web01", false},
+		{map[string]any{"reattach": "a b"}, "invalid tmux session name", true},
+		{map[string]any{"backing": "tmux", "pty_mode": "disable"}, "needs a remote PTY", true},
+		{map[string]any{"backing": "byobu"}, "invalid backing", true},
+		{map[string]any{"host": "local", "backing": "tmux"}, "only available for SSH sessions", true},
+	} {
+		args := map[string]any{"host": "web01", "dry_run": true}
+		for k, v := range tc.args {
+			args[k] = v
+		}
+		text, isErr := callTool(startSessionHandler, args)
+		if isErr != tc.err || !strings.Contains(text, tc.want) {
+			t.Errorf("%v: expected %q (error %v), got %s", tc.args, tc.want, tc.err, text)
+		}
+		if !tc.err && len(tc.args) == 0 && strings.Contains(text, "tmux") {
+			t.Errorf("Expected no backing by default, got %s", text)
+		}
+	}
+
+	if name := newBackingName(""); !validBackingName.MatchString(name) {
+		t.Errorf("Random backing name %q is invalid", name)
+	}
+	if name := newBackingName("prod.db"); name != "mcpssh-prod_db" {
+		t.Errorf("Expected the name to be sanitized, got %q", name)
+	}
+}
+
+func TestCloseSessionBacking(t *testing.T) {
+	fakeSSH(t)
+	// A tmux stand-in recording how it was called
+	dir := t.TempDir()
+	record := filepath.Join(dir, "calls")
+	os.WriteFile(filepath.Join(dir, "tmux"), []byte("#!/bin/sh\necho \"$@\" >> "+record+"\n"), 0o755)
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	newSess := func(id string) *Session {
+		sess := &Session{ID: id, Host: "web01", SSH: &SSHOptions{Host: "web01", Backing: BackingTmux, BackingSession: "mcpssh-" + id}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+		if err := manager.Add(sess); err != nil {
+			t.Fatal(err)
+		}
+		return sess
+	}
+	newSess("backing-kept")
+	if text, _ := callTool(closeSessionHandler, map[string]any{"session_id": "backing-kept", "keep_backing": true}); !strings.Contains(text, "left running") {
+		t.Errorf("Expected the tmux session to be kept, got: %s", text)
+	}
+	newSess("backing-ended")
+	if text, isErr := callTool(closeSessionHandler, map[string]any{"session_id": "backing-ended"}); isErr || strings.Contains(text, "failed") {
+		t.Errorf("Expected the tmux session to be ended, got: %s", text)
+	}
+	calls, _ := os.ReadFile(record)
+	if string(calls) != "kill-session -t mcpssh-backing-ended\n" {
+		t.Errorf("Expected only the second tmux session to be killed, got %q", calls)
+	}
+
+	// The backing survives a restart in the state file
+	sess := restoredSession(sessionRecord{ID: "restored", Host: "web01", Backing: BackingScreen, BackingSession: "mcpssh-x"})
+	if sess.SSH.backingCommand() != "screen -D -R -S mcpssh-x" {
+		t.Errorf("Expected the restored session to reattach to its screen session, got %q", sess.SSH.backingCommand())
+	}
+}
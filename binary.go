@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings for output that isn't text, chosen with binary_encoding.
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+	EncodingNone   = "none" // Returned as is; JSON replaces invalid UTF-8
+)
+
+// validBinaryEncoding reports whether enc is a known binary_encoding.
+func validBinaryEncoding(enc string) bool {
+	switch enc {
+	case EncodingBase64, EncodingHex, EncodingNone:
+		return true
+	}
+	return false
+}
+
+// isText reports whether output can be returned as a JSON string without
+// being mangled: valid UTF-8 and free of NUL bytes, which terminals never
+// print for text.
+func isText(output string) bool {
+	return utf8.ValidString(output) && !strings.ContainsRune(output, 0)
+}
+
+// encodeOutput encodes output with enc unless it is text, e.g. what 'cat' of
+// a binary file prints. It returns the output to send and the encoding
+// applied, "" if none.
+func encodeOutput(output, enc string) (string, string) {
+	if enc == EncodingNone || isText(output) {
+		return output, ""
+	}
+	if enc == EncodingHex {
+		return hex.EncodeToString([]byte(output)), EncodingHex
+	}
+	return base64.StdEncoding.EncodeToString([]byte(output)), EncodingBase64
+}
+
+// withEncodingMarker prefixes encoded output with a note saying how to
+// decode it.
+func withEncodingMarker(output, enc string) string {
+	if enc == "" {
+		return output
+	}
+	return fmt.Sprintf("[Binary output, %s-encoded]\n%s", enc, output)
+}
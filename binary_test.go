@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/base64"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestEncodeOutput(t *testing.T) {
+	for _, tc := range []struct {
+		output, enc  string
+		want, wantAs string
+	}{
+		{"plain ✓ text\r\n\x1b[0m", EncodingBase64, "plain ✓ text\r\n\x1b[0m", ""},
+		{"ELF\x00\x01", EncodingBase64, base64.StdEncoding.EncodeToString([]byte("ELF\x00\x01")), EncodingBase64},
+		{"\xff\xfe", EncodingHex, "fffe", EncodingHex},
+		{"\xff\xfe", EncodingNone, "\xff\xfe", ""},
+	} {
+		got, as := encodeOutput(tc.output, tc.enc)
+		if got != tc.want || as != tc.wantAs {
+			t.Errorf("encodeOutput(%q, %s) = %q, %q; want %q, %q", tc.output, tc.enc, got, as, tc.want, tc.wantAs)
+		}
+	}
+}
+
+func TestInteractBinaryOutput(t *testing.T) {
+	sess := &Session{ID: "test-binary", Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	sess.outputBuf.Write([]byte("\x7fELF\x02\x01\x00\x00"))
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+
+	text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "wait_duration": "0", "binary_encoding": "hex"})
+	if isErr || !strings.HasPrefix(text, "[Binary output, hex-encoded]\n7f454c4602010000") {
+		t.Errorf("Expected hex-encoded output, got: %q", text)
+	}
+	if text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "binary_encoding": "utf16"}); !isErr || !strings.Contains(text, "Invalid binary_encoding") {
+		t.Errorf("Expected an unknown encoding to be rejected, got: %s", text)
+	}
+}
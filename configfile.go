@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configErr records a config file that exists (or was named explicitly) but
+// could not be applied; main refuses to start with it.
+var configErr error
+
+// fileConfig is the YAML config file. Keys mirror the MCPSSH_* environment
+// variables, which take precedence; unset keys keep the defaults. Durations
+// are in seconds.
+type fileConfig struct {
+	ControlMaster    *bool    `yaml:"control_master"`
+	ControlPersist   *string  `yaml:"control_persist"`
+	ReadBufferSize   *int     `yaml:"read_buffer_size"`
+	SSHPath          *string  `yaml:"ssh_path"`
+	SSHConfig        *string  `yaml:"ssh_config"`
+	DockerPath       *string  `yaml:"docker_path"`
+	KubectlPath      *string  `yaml:"kubectl_path"`
+	AliveInterval    *int     `yaml:"server_alive_interval"`
+	AliveCountMax    *int     `yaml:"server_alive_count_max"`
+	SSHTransport     *string  `yaml:"ssh_transport"`
+	HostKeyPolicy    *string  `yaml:"host_key_policy"`
+	MaxOutputBytes   *int     `yaml:"max_output_bytes"`
+	MaxBufferBytes   *int     `yaml:"max_buffer_bytes"`
+	MaxInputFile     *int     `yaml:"max_input_file_bytes"`
+	MaxDownload      *int     `yaml:"max_download_bytes"`
+	IDScheme         *string  `yaml:"id_scheme"`
+	MaxWait          *float64 `yaml:"max_wait"`
+	IdleTimeout      *float64 `yaml:"idle_timeout"`
+	LogLevel         *string  `yaml:"log_level"`
+	AllowedHosts     []string `yaml:"allowed_hosts"`
+	AllowLocal       *bool    `yaml:"allow_local"`
+	DenyPatterns     *string  `yaml:"deny_patterns"`
+	DenylistFile     *string  `yaml:"denylist_file"`
+	PolicyFile       *string  `yaml:"policy_file"`
+	ReadOnly         *bool    `yaml:"read_only"`
+	Backing          *string  `yaml:"backing"`
+	StateFile        *string  `yaml:"state_file"`
+	MaxSessions      *int     `yaml:"max_sessions"`
+	EvictIdle        *bool    `yaml:"evict_idle"`
+	NotifyOutput     *bool    `yaml:"notify_output"`
+	DefaultWait      *float64 `yaml:"default_wait"`
+	LogFile          *string  `yaml:"log_file"`
+	Serve            *string  `yaml:"serve"`
+	Listen           *string  `yaml:"listen"`
+	AuthTokenFile    *string  `yaml:"auth_token_file"`
+	TLSCert          *string  `yaml:"tls_cert"`
+	TLSKey           *string  `yaml:"tls_key"`
+	TLSClientCA      *string  `yaml:"tls_client_ca"`
+	TranscriptDir    *string  `yaml:"transcript_dir"`
+	TranscriptFormat *string  `yaml:"transcript_format"`
+	AuditFile        *string  `yaml:"audit_file"`
+}
+
+// configFilePath returns the config file to read: MCPSSH_CONFIG if set
+// (explicit, so it must exist), else mcpssh/config.yaml in the user's
+// config directory, e.g. ~/.config/mcpssh/config.yaml.
+func configFilePath() (path string, explicit bool) {
+	if path := os.Getenv("MCPSSH_CONFIG"); path != "" {
+		return path, true
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, "mcpssh", "config.yaml"), false
+}
+
+// applyConfigFile reads the YAML file at path into cfg. Unknown keys are
+// rejected so a typo doesn't silently leave a safety setting at its default.
+func applyConfigFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fc fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) { // EOF: empty file
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := fc.validate(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	set(&cfg.ControlMaster, fc.ControlMaster)
+	set(&cfg.ControlPersist, fc.ControlPersist)
+	set(&cfg.ReadBufferSize, fc.ReadBufferSize)
+	set(&cfg.SSHPath, fc.SSHPath)
+	set(&cfg.SSHConfigFile, fc.SSHConfig)
+	set(&cfg.DockerPath, fc.DockerPath)
+	set(&cfg.KubectlPath, fc.KubectlPath)
+	set(&cfg.AliveInterval, fc.AliveInterval)
+	set(&cfg.AliveCountMax, fc.AliveCountMax)
+	set(&cfg.SSHTransport, fc.SSHTransport)
+	set(&cfg.HostKeyPolicy, fc.HostKeyPolicy)
+	set(&cfg.MaxOutputBytes, fc.MaxOutputBytes)
+	set(&cfg.MaxBufferBytes, fc.MaxBufferBytes)
+	set(&cfg.MaxInputFile, fc.MaxInputFile)
+	set(&cfg.MaxDownload, fc.MaxDownload)
+	set(&cfg.IDScheme, fc.IDScheme)
+	set(&cfg.LogLevel, fc.LogLevel)
+	set(&cfg.AllowLocal, fc.AllowLocal)
+	set(&cfg.DenyPatterns, fc.DenyPatterns)
+	set(&cfg.DenylistFile, fc.DenylistFile)
+	set(&cfg.PolicyFile, fc.PolicyFile)
+	set(&cfg.ReadOnly, fc.ReadOnly)
+	set(&cfg.Backing, fc.Backing)
+	set(&cfg.StateFile, fc.StateFile)
+	set(&cfg.MaxSessions, fc.MaxSessions)
+	set(&cfg.EvictIdle, fc.EvictIdle)
+	set(&cfg.NotifyOutput, fc.NotifyOutput)
+	set(&cfg.LogFile, fc.LogFile)
+	set(&cfg.Serve, fc.Serve)
+	set(&cfg.Listen, fc.Listen)
+	set(&cfg.AuthTokenFile, fc.AuthTokenFile)
+	set(&cfg.TLSCert, fc.TLSCert)
+	set(&cfg.TLSKey, fc.TLSKey)
+	set(&cfg.TLSClientCA, fc.TLSClientCA)
+	set(&cfg.TranscriptDir, fc.TranscriptDir)
+	set(&cfg.TranscriptFormat, fc.TranscriptFormat)
+	set(&cfg.AuditFile, fc.AuditFile)
+	if fc.MaxWait != nil {
+		cfg.MaxWait = time.Duration(*fc.MaxWait * float64(time.Second))
+	}
+	if fc.IdleTimeout != nil {
+		cfg.IdleTimeout = time.Duration(*fc.IdleTimeout * float64(time.Second))
+	}
+	if fc.DefaultWait != nil {
+		cfg.DefaultWait = time.Duration(*fc.DefaultWait * float64(time.Second))
+	}
+	if fc.AllowedHosts != nil {
+		cfg.AllowedHosts = fc.AllowedHosts
+	}
+	cfg.ConfigFile = path
+	return nil
+}
+
+// validate rejects values the environment variables would ignore, since in
+// a file they are more likely a mistake than a request for the default.
+func (fc *fileConfig) validate() error {
+	for name, v := range map[string]*int{
+		"read_buffer_size":     fc.ReadBufferSize,
+		"max_input_file_bytes": fc.MaxInputFile,
+		"max_download_bytes":   fc.MaxDownload,
+	} {
+		if v != nil && *v <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	for name, v := range map[string]*int{
+		"max_output_bytes":       fc.MaxOutputBytes,
+		"max_buffer_bytes":       fc.MaxBufferBytes,
+		"max_sessions":           fc.MaxSessions,
+		"server_alive_interval":  fc.AliveInterval,
+		"server_alive_count_max": fc.AliveCountMax,
+	} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("%s must not be negative (0 disables it)", name)
+		}
+	}
+	if fc.MaxWait != nil && *fc.MaxWait <= 0 {
+		return fmt.Errorf("max_wait must be positive")
+	}
+	if fc.IdleTimeout != nil && *fc.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative (0 disables it)")
+	}
+	if fc.DefaultWait != nil && *fc.DefaultWait < 0 {
+		return fmt.Errorf("default_wait must not be negative")
+	}
+	if fc.HostKeyPolicy != nil && !validHostKeyPolicy(*fc.HostKeyPolicy) {
+		return fmt.Errorf("invalid host_key_policy %q", *fc.HostKeyPolicy)
+	}
+	if fc.SSHTransport != nil && *fc.SSHTransport != TransportExec && *fc.SSHTransport != TransportNative {
+		return fmt.Errorf("invalid ssh_transport %q (want %s or %s)", *fc.SSHTransport, TransportExec, TransportNative)
+	}
+	if fc.TranscriptFormat != nil && !validTranscriptFormat(*fc.TranscriptFormat) {
+		return fmt.Errorf("invalid transcript_format %q (want %s or %s)", *fc.TranscriptFormat, TranscriptText, TranscriptAsciicast)
+	}
+	if fc.Backing != nil && !validBacking(*fc.Backing) {
+		return fmt.Errorf("invalid backing %q (want %s or %s)", *fc.Backing, BackingTmux, BackingScreen)
+	}
+	if fc.IDScheme != nil && !validIDScheme(*fc.IDScheme) {
+		return fmt.Errorf("invalid id_scheme %q (want %s, %s or %s)", *fc.IDScheme, IDSchemeUUID, IDSchemeSequential, IDSchemeHost)
+	}
+	if fc.Serve != nil && !validServeMode(*fc.Serve) {
+		return fmt.Errorf("invalid serve %q (want %s, %s or %s)", *fc.Serve, ServeStdio, ServeHTTP, ServeSSE)
+	}
+	return nil
+}
+
+// set copies *v into *dst if v is non-nil.
+func set[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// loadConfigFile applies the config file, if any, to cfg. A missing file is
+// only an error if it was named explicitly.
+func loadConfigFile(cfg *Config) error {
+	path, explicit := configFilePath()
+	if path == "" {
+		return nil
+	}
+	err := applyConfigFile(cfg, path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	return err
+}
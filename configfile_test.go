@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFile(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Setenv("MCPSSH_CONFIG", write(`
+ssh_transport: native
+host_key_policy: strict
+max_wait: 120
+idle_timeout: 3600
+max_output_bytes: 0
+allowed_hosts: [web1, "db*"]
+allow_local: false
+`))
+	cfg := loadConfig()
+	if configErr != nil {
+		t.Fatalf("Unexpected error: %v", configErr)
+	}
+	if cfg.SSHTransport != TransportNative || cfg.HostKeyPolicy != HostKeyStrict || cfg.MaxWait != 120*time.Second ||
+		cfg.IdleTimeout != time.Hour || cfg.MaxOutputBytes != 0 || cfg.AllowLocal || !slices.Equal(cfg.AllowedHosts, []string{"web1", "db*"}) {
+		t.Errorf("Config file not applied: %+v", cfg)
+	}
+	if cfg.MaxDownload != 1<<20 {
+		t.Errorf("Expected unset keys to keep their defaults, got max_download_bytes %d", cfg.MaxDownload)
+	}
+
+	// The environment overrides the file
+	t.Setenv("MCPSSH_MAX_WAIT", "30")
+	t.Setenv("MCPSSH_ALLOWED_HOSTS", "bastion")
+	cfg = loadConfig()
+	if cfg.MaxWait != 30*time.Second || !slices.Equal(cfg.AllowedHosts, []string{"bastion"}) {
+		t.Errorf("Expected the environment to override the file, got max_wait %s, allowed_hosts %v", cfg.MaxWait, cfg.AllowedHosts)
+	}
+	if cfg.IdleTimeout != time.Hour {
+		t.Errorf("Expected idle_timeout from the file to survive, got %s", cfg.IdleTimeout)
+	}
+
+	for name, tc := range map[string]struct{ content, want string }{
+		"unknown key":    {"max_wiat: 10\n", "max_wiat"},
+		"invalid value":  {"host_key_policy: sometimes\n", "host_key_policy"},
+		"unknown scheme": {"id_scheme: random\n", "id_scheme"},
+		"negative":       {"max_buffer_bytes: -1\n", "max_buffer_bytes"},
+		"wrong type":     {"allow_local: maybe\n", "line 1"},
+	} {
+		t.Setenv("MCPSSH_CONFIG", write(tc.content))
+		loadConfig()
+		if configErr == nil || !strings.Contains(configErr.Error(), tc.want) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", name, tc.want, configErr)
+		}
+	}
+
+	t.Setenv("MCPSSH_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	loadConfig()
+	if configErr == nil {
+		t.Errorf("Expected an error for a missing explicit config file")
+	}
+
+	// A missing file at the default location is fine
+	t.Setenv("MCPSSH_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if cfg := loadConfig(); configErr != nil || cfg.ConfigFile != "" {
+		t.Errorf("Expected no config file, got %q, err %v", cfg.ConfigFile, configErr)
+	}
+}
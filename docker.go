@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dockerHostPrefix marks a start_session host as a running container rather
+// than an SSH destination: host "docker:web" runs docker exec in container web.
+const dockerHostPrefix = "docker:"
+
+// validContainerRe matches container names and IDs. Anything else, in
+// particular a leading '-', could be read by docker as an option.
+var validContainerRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// dockerContainer returns the container a "docker:<container>" host names,
+// and whether host is one.
+func dockerContainer(host string) (string, bool) {
+	return strings.CutPrefix(host, dockerHostPrefix)
+}
+
+// checkContainerAllowed applies the access rules to a container session.
+// The docker or kubectl client is a local process, so MCPSSH_ALLOW_LOCAL
+// governs it, and an allowed hosts list must also match the full host, e.g.
+// "docker:web".
+func checkContainerAllowed(host string) error {
+	if err := checkLocalAllowed(); err != nil {
+		return err
+	}
+	return checkHostAllowed(host)
+}
+
+// resolveDockerPath returns the configured docker binary, checking that it
+// exists and is executable.
+func resolveDockerPath() (string, error) {
+	path, err := exec.LookPath(config.DockerPath)
+	if err != nil {
+		return "", fmt.Errorf("docker binary %q is not usable (check MCPSSH_DOCKER_PATH): %v", config.DockerPath, err)
+	}
+	return path, nil
+}
+
+// dockerCommand builds the docker exec process for a container session,
+// running command in the container or, if it is nil, sh. Like SendEnv for
+// ssh, TERM and env are passed by name only, with the values in the docker
+// client's environment (see setTerm), so they stay off its command line.
+func dockerCommand(container string, command []string, env map[string]string) (*exec.Cmd, error) {
+	if !validContainerRe.MatchString(container) {
+		return nil, fmt.Errorf("invalid container name %q", container)
+	}
+	path, err := resolveDockerPath()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"exec", "-it", "-e", "TERM"}
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		args = append(args, "-e", name)
+	}
+	args = append(args, container)
+	if command == nil {
+		command = []string{"sh"}
+	}
+	c := exec.Command(path, append(args, command...)...)
+	setEnv(c, env)
+	return c, nil
+}
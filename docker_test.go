@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDocker points MCPSSH_DOCKER_PATH at a stand-in that drops the docker
+// exec options and runs the command after the container name locally.
+func fakeDocker(t *testing.T, container string) {
+	script := filepath.Join(t.TempDir(), "docker")
+	body := "#!/bin/sh\nwhile [ \"$1\" != \"" + container + "\" ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.DockerPath
+	t.Cleanup(func() { config.DockerPath = saved })
+	config.DockerPath = script
+}
+
+func TestDockerSession(t *testing.T) {
+	fakeDocker(t, "web")
+	for want, args := range map[string]map[string]any{
+		"invalid container name":          {"host": "docker:-it", "dry_run": true},
+		"only available for SSH sessions": {"host": "docker:web", "backing": "tmux", "dry_run": true},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	saved := config.AllowedHosts
+	config.AllowedHosts = []string{"web*"}
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": "docker:web", "dry_run": true})
+	config.AllowedHosts = saved
+	if !isErr || !strings.Contains(text, "allowed hosts") {
+		t.Errorf("Expected the allowed hosts list to apply to containers, got: %s", text)
+	}
+
+	env := map[string]any{"GREETING": "secret-hello"}
+	text, isErr = callTool(startSessionHandler, map[string]any{"host": "docker:web", "env": env, "dry_run": true})
+	if isErr || !strings.Contains(text, "exec -it -e TERM -e GREETING web sh") || strings.Contains(text, "secret-hello") {
+		t.Errorf("Expected docker exec with the variables passed by name, got: %s", text)
+	}
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "docker:web", "name": "docker-test", "env": env}); isErr {
+		t.Fatalf("Failed to start the container session: %s", text)
+	}
+	sess, _ := manager.Lookup("docker-test")
+	defer manager.Remove(sess.ID)
+	if sess.SSH != nil {
+		t.Error("Expected a container session to have no SSH options")
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "docker-test", "input": "echo $TERM $GREETING\n", "wait_duration": "1"}); !strings.Contains(text, "xterm-256color secret-hello") {
+		t.Errorf("Expected the shell to get TERM and env, got: %s", text)
+	}
+	if restored := restoredSession(sessionRecord{Host: "docker:web"}); restored.SSH != nil {
+		t.Error("Expected a restored container session to have no SSH options")
+	}
+}
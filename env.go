@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// validEnvName matches the environment variable names start_session sets.
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// clientEnvPrefixes are the prefixes of names that configure the local ssh,
+// docker or kubectl client, or the dynamic loader running it, rather than
+// the shell; start_session refuses them so env can't take over the client.
+var clientEnvPrefixes = []string{"LD_", "DYLD_", "SSH_", "DOCKER_", "KUBE"}
+
+// parseEnv validates start_session's env argument, an object of names to
+// string values.
+func parseEnv(raw any) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("env must be an object of variable names to values")
+	}
+	env := make(map[string]string, len(obj))
+	for name, v := range obj {
+		value, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("env %s: the value must be a string", name)
+		}
+		if !validEnvName.MatchString(name) {
+			return nil, fmt.Errorf("invalid env name %q", name)
+		}
+		if name == "TERM" {
+			return nil, fmt.Errorf("set TERM with the term parameter, not env")
+		}
+		if slices.ContainsFunc(clientEnvPrefixes, func(p string) bool { return strings.HasPrefix(name, p) }) {
+			return nil, fmt.Errorf("env %s would configure the local client; export it in the shell instead", name)
+		}
+		if strings.ContainsAny(value, "\x00\r\n") {
+			return nil, fmt.Errorf("env %s: the value must not contain NUL or line breaks", name)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// setEnv adds env to the environment of a local command, overriding any
+// inherited values.
+func setEnv(c *exec.Cmd, env map[string]string) {
+	vars := c.Environ()
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		vars = append(vars, name+"="+env[name]) // Later entries win
+	}
+	c.Env = vars
+}
+
+// sendEnvArgs returns the ssh options passing the variables of env, set in
+// the ssh process's own environment, on to the remote shell. Unlike SetEnv
+// this keeps the values, which may be secrets, out of the command line. The
+// server only sets the variables its AcceptEnv allows.
+func sendEnvArgs(env map[string]string) []string {
+	var args []string
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		args = append(args, "-o", "SendEnv="+name)
+	}
+	return args
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	env, err := parseEnv(map[string]any{"LANG": "C.UTF-8", "API_TOKEN": "s3cr3t \"quoted\""})
+	if err != nil || len(env) != 2 || env["API_TOKEN"] != "s3cr3t \"quoted\"" {
+		t.Errorf("Unexpected result %v, %v", env, err)
+	}
+	if env, err := parseEnv(nil); env != nil || err != nil {
+		t.Errorf("Expected no env by default, got %v, %v", env, err)
+	}
+	for _, bad := range []any{
+		"LANG=C",
+		map[string]any{"1X": "y"},
+		map[string]any{"A-B": "y"},
+		map[string]any{"X": 1.0},
+		map[string]any{"X": "a\nb"},
+		map[string]any{"TERM": "vt100"},
+		map[string]any{"LD_PRELOAD": "/tmp/x.so"},
+		map[string]any{"LD_LIBRARY_PATH": "/tmp"},
+		map[string]any{"DYLD_INSERT_LIBRARIES": "/tmp/x.dylib"},
+		map[string]any{"SSH_AUTH_SOCK": "/tmp/agent"},
+		map[string]any{"DOCKER_HOST": "tcp://evil:2375"},
+		map[string]any{"KUBECONFIG": "/tmp/kubeconfig"},
+	} {
+		if _, err := parseEnv(bad); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
+
+func TestStartSessionEnv(t *testing.T) {
+	// Over ssh the values travel in ssh's environment, not its command line
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": "web01", "dry_run": true, "env": map[string]any{"API_TOKEN": "s3cr3t", "LANG": "C.UTF-8"}})
+	if isErr || !strings.Contains(text, "-o SendEnv=API_TOKEN -o SendEnv=LANG") || strings.Contains(text, "s3cr3t") {
+		t.Errorf("Expected SendEnv options without the values, got: %s", text)
+	}
+	opts := SSHOptions{Host: "web01", Env: map[string]string{"API_TOKEN": "s3cr3t"}}
+	if c, err := sshCommand(&opts); err != nil || !slices.Contains(c.Env, "API_TOKEN=s3cr3t") {
+		t.Errorf("Expected the value in ssh's environment, got %v, %v", err, c)
+	}
+
+	t.Setenv("SHELL", "/bin/sh")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "env-test", "env": map[string]any{"GREETING": "hello there"}}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("env-test")
+	defer manager.Remove(sess.ID)
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "env-test", "input": "echo \"[$GREETING]\"\n", "wait_duration": "1"}); !strings.Contains(text, "[hello there]") {
+		t.Errorf("Expected the variable to be set in the shell, got: %s", text)
+	}
+	if text, _ := callTool(describeSessionHandler, map[string]any{"session_id": "env-test"}); !strings.Contains(text, "Environment: GREETING (values not shown)") || strings.Contains(text, "hello there") {
+		t.Errorf("Expected the variable name only, got: %s", text)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultStepTimeout bounds an expect step that doesn't set its own timeout.
+const defaultStepTimeout = 10 * time.Second
+
+// waitForPattern collects output from sess until re matches it, the timeout
+// elapses, the session exits or ctx is cancelled. It returns everything
+// collected and whether re matched.
+func waitForPattern(ctx context.Context, sess *Session, re *regexp.Regexp, timeout time.Duration) (string, bool) {
+	return waitForPatternSince(ctx, sess, re, -1, timeout)
+}
+
+// waitForPatternSince is waitForPattern matching only the output from offset
+// since on, e.g. what followed some input rather than the prompt it was
+// typed at. Output before it is still collected and returned.
+func waitForPatternSince(ctx context.Context, sess *Session, re *regexp.Regexp, since int64, timeout time.Duration) (string, bool) {
+	var collected strings.Builder
+	skip := max(since-sess.UnreadOffset(), 0)
+	matches := func() bool {
+		return re.MatchString(collected.String()[min(int(skip), collected.Len()):])
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		collected.WriteString(sess.ReadAndClear())
+		if matches() {
+			return collected.String(), true
+		}
+		select {
+		case <-ctx.Done():
+			return collected.String(), false
+		case <-deadline.C:
+			collected.WriteString(sess.ReadAndClear())
+			return collected.String(), matches()
+		case <-sess.exited:
+			collected.WriteString(sess.ReadAndClear())
+			return collected.String(), matches()
+		case <-ticker.C:
+		}
+	}
+}
+
+// expectPattern compiles interact_session's expect (literal text) or
+// expect_regex argument; it returns nil if neither is given.
+func expectPattern(text, expr string) (*regexp.Regexp, error) {
+	switch {
+	case text != "" && expr != "":
+		return nil, fmt.Errorf("pass either expect or expect_regex, not both")
+	case text != "":
+		return regexp.MustCompile(regexp.QuoteMeta(text)), nil
+	case expr != "":
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_regex: %v", err)
+		}
+		return re, nil
+	}
+	return nil, nil
+}
+
+// defaultPromptRe recognizes a typical shell prompt at the very end of the
+// output, used to tell that a command has finished.
+var defaultPromptRe = regexp.MustCompile(`[$#%>] ?$`)
+
+// interruptGrace is how long to wait for the prompt to come back after
+// interrupting a command, and again after killing it.
+const interruptGrace = 2 * time.Second
+
+// maxInterruptWait is the longest waitOrInterrupt runs past its timeout.
+const maxInterruptWait = 2 * interruptGrace
+
+// waitOrInterrupt waits up to timeout for re to match the output, like
+// waitForPattern. If it doesn't match and the session is still alive, the
+// command is interrupted with Ctrl+C so it can't leave the session unusable,
+// and the output up to the returning prompt is collected too. A command that
+// ignores Ctrl+C is killed (see killForeground). It returns the output,
+// whether the command timed out, the signal it was killed with, if any, and
+// the interactive prompt it was blocked on when it timed out, if any. Only
+// output from offset since on, where the command was entered, counts as it
+// finishing.
+func waitOrInterrupt(ctx context.Context, sess *Session, re *regexp.Regexp, since int64, timeout time.Duration) (string, bool, string, *awaitingInput) {
+	output, matched := waitForPatternSince(ctx, sess, re, since, timeout)
+	if matched || !sess.Alive() || ctx.Err() != nil {
+		return output, false, "", nil
+	}
+	// Once interrupted, the output ends with the shell's prompt instead
+	awaiting := detectInputPrompt(output)
+	if err := sess.SendInterrupt(); err != nil {
+		return output, true, "", awaiting
+	}
+	// The command has stopped once it reports in or the shell prompts again
+	stopped := regexp.MustCompile(`(?:` + re.String() + `)|` + defaultPromptRe.String())
+	rest, ok := waitForPattern(ctx, sess, stopped, interruptGrace)
+	output += rest
+	if ok || !sess.Alive() || ctx.Err() != nil {
+		return output, true, "", awaiting
+	}
+	killed, err := sess.killForeground()
+	if err != nil {
+		logger.Warn("failed to kill a command ignoring Ctrl+C", "session_id", sess.ID, "err", err)
+	}
+	if killed == "" {
+		return output, true, "", awaiting
+	}
+	rest, _ = waitForPattern(ctx, sess, stopped, interruptGrace)
+	return output + rest, true, killed, awaiting
+}
+
+// timeoutNote is the marker ending the output of a command that timed out,
+// naming the signal it was killed with if Ctrl+C wasn't enough.
+func timeoutNote(timeout time.Duration, killed string) string {
+	if killed != "" {
+		return fmt.Sprintf("[Command timed out after %s; sent Ctrl+C, then %s]", timeout, killed)
+	}
+	return fmt.Sprintf("[Command timed out after %s; sent Ctrl+C]", timeout)
+}
+
+// waitForPrompt waits up to d for the output written since offset since to
+// end in a new line showing prompt, with prompt starting at least commands
+// lines in all, i.e. for the commands typed to finish and the shell to
+// prompt again. It reports whether it did; it also returns if the session
+// exits or ctx is cancelled.
+func (s *Session) waitForPrompt(ctx context.Context, since int64, prompt string, commands int, d time.Duration) bool {
+	deadline := time.NewTimer(d)
+	defer deadline.Stop()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if s.promptAfter(since, prompt, commands) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return s.promptAfter(since, prompt, commands)
+		case <-s.exited:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// promptAfter reports whether the output since offset since ends in a new
+// line shaped like prompt, after at least commands such lines in all.
+func (s *Session) promptAfter(since int64, prompt string, commands int) bool {
+	s.bufMu.Lock()
+	data, _ := s.outputBuf.since(since)
+	lines := strings.Split(string(data), "\n")
+	s.bufMu.Unlock()
+	shape := shapeOf(prompt)
+	if len(lines) < 2 || !shape.ends(lines[len(lines)-1]) {
+		return false
+	}
+	// A prompt between commands of a multi-line input isn't the end yet
+	n := 0
+	for _, line := range lines[1:] {
+		if shape.starts(line) {
+			n++
+		}
+	}
+	return n >= commands
+}
+
+// promptShape is what stays the same between showings of a prompt that
+// embeds the working directory, a git branch or the time: its leading user
+// and host name, and the sigil and spacing it ends with.
+type promptShape struct {
+	prefix, suffix string
+}
+
+// shapeOf derives the shape of a prompt as seen.
+func shapeOf(prompt string) promptShape {
+	prompt = shownLine(prompt)
+	body := strings.TrimRight(prompt, " \t")
+	if body == "" {
+		return promptShape{}
+	}
+	_, size := utf8.DecodeLastRuneInString(body)
+	prefix := prompt[:strings.IndexFunc(prompt+"\x00", func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("@._-", r)
+	})]
+	if prefix == body {
+		prefix = "" // All of it could vary
+	}
+	return promptShape{prefix: prefix, suffix: prompt[len(body)-size:]}
+}
+
+// ends reports whether line is a prompt of this shape with nothing typed
+// after it.
+func (p promptShape) ends(line string) bool {
+	line = shownLine(line)
+	return p.suffix != "" && strings.HasPrefix(line, p.prefix) && strings.HasSuffix(line, p.suffix) && len(line) >= len(p.prefix)+len(p.suffix)
+}
+
+// starts reports whether line begins with a prompt of this shape, such as
+// the one a command was typed at.
+func (p promptShape) starts(line string) bool {
+	line = shownLine(line)
+	return p.suffix != "" && strings.HasPrefix(line, p.prefix) && strings.Contains(line[len(p.prefix):], p.suffix)
+}
+
+// shownLine is what a terminal line shows once carriage returns have
+// redrawn it, without escape sequences.
+func shownLine(line string) string {
+	line = strings.TrimRight(stripANSI(line), "\r")
+	return line[strings.LastIndexByte(line, '\r')+1:]
+}
+
+type expectStep struct {
+	Send    string
+	Expect  *regexp.Regexp
+	Timeout time.Duration
+}
+
+type expectStepResult struct {
+	Step    int     `json:"step"`
+	Send    string  `json:"send,omitempty"`
+	Expect  string  `json:"expect"`
+	Output  string  `json:"output"`
+	Matched bool    `json:"matched"`
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+type expectResult struct {
+	Completed bool               `json:"completed"`
+	Steps     []expectStepResult `json:"steps"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// parseExpectSteps validates the raw steps argument.
+func parseExpectSteps(raw any) ([]expectStep, error) {
+	list, ok := raw.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("steps must be a non-empty array")
+	}
+	steps := make([]expectStep, 0, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("step %d must be an object", i+1)
+		}
+		send, _ := obj["send"].(string)
+		expr, _ := obj["expect_regex"].(string)
+		if expr == "" {
+			return nil, fmt.Errorf("step %d: expect_regex is required", i+1)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: invalid expect_regex: %v", i+1, err)
+		}
+		timeout := defaultStepTimeout
+		if secs, ok := obj["timeout"].(float64); ok && secs > 0 {
+			timeout = time.Duration(secs * float64(time.Second))
+		}
+		steps = append(steps, expectStep{Send: send, Expect: re, Timeout: timeout})
+	}
+	return steps, nil
+}
+
+func expectHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	steps, err := parseExpectSteps(args.GetArguments()["steps"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	for _, step := range steps {
+		if step.Send != "" {
+			if err := sess.checkWritable(); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		if err := checkInputAllowed(ctx, sess.ID, step.Send); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	var total time.Duration
+	for _, step := range steps {
+		total += step.Timeout
+	}
+	defer reportProgress(ctx, args, sess, total)()
+	result := expectResult{Completed: true}
+	for i, step := range steps {
+		start := time.Now()
+		if step.Send != "" {
+			if err := sess.Write([]byte(step.Send)); err != nil {
+				result.Completed = false
+				result.Error = fmt.Sprintf("Step %d: write error: %v", i+1, err)
+				break
+			}
+		}
+		output, matched := waitForPattern(ctx, sess, step.Expect, step.Timeout)
+		result.Steps = append(result.Steps, expectStepResult{
+			Step:    i + 1,
+			Send:    step.Send,
+			Expect:  step.Expect.String(),
+			Output:  output,
+			Matched: matched,
+			Elapsed: time.Since(start).Seconds(),
+		})
+		if !matched {
+			result.Completed = false
+			switch {
+			case !sess.Alive():
+				result.Error = fmt.Sprintf("Step %d: session exited (%s) before /%s/ matched", i+1, sess.ExitSummary(), step.Expect)
+			case ctx.Err() != nil:
+				result.Error = fmt.Sprintf("Step %d: cancelled", i+1)
+			default:
+				result.Error = fmt.Sprintf("Step %d: timed out after %s waiting for /%s/", i+1, step.Timeout, step.Expect)
+			}
+			break
+		}
+	}
+
+	if wantJSON(args) {
+		return jsonResult(result), nil
+	}
+
+	var b strings.Builder
+	for _, r := range result.Steps {
+		status := "matched"
+		if !r.Matched {
+			status = "NOT matched"
+		}
+		fmt.Fprintf(&b, "--- Step %d: /%s/ %s (%.1fs) ---\n%s\n", r.Step, r.Expect, status, r.Elapsed, r.Output)
+	}
+	if result.Completed {
+		fmt.Fprintf(&b, "[All %d steps completed]", len(steps))
+	} else {
+		fmt.Fprintf(&b, "[%s]", result.Error)
+	}
+	return mcp.NewToolResultText(b.String()), nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestExpectSteps(t *testing.T) {
+	sess := startTestSession(t, "test-expect", "sh", "-c", `printf 'Continue? '; read a; echo "answer=$a"; printf 'Name: '; read n; echo "hello $n"; sleep 5`)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{
+		"session_id": sess.ID,
+		"steps": []any{
+			map[string]any{"expect_regex": `Continue\? $`, "timeout": 2.0},
+			map[string]any{"send": "y\n", "expect_regex": `Name: $`, "timeout": 2.0},
+			map[string]any{"send": "bob\n", "expect_regex": `hello bob`, "timeout": 2.0},
+			map[string]any{"expect_regex": `never`, "timeout": 0.3},
+		},
+	}
+	result, _ := expectHandler(context.Background(), req)
+	text := result.Content[0].(mcp.TextContent).Text
+
+	if !strings.Contains(text, "answer=y") || !strings.Contains(text, "hello bob") {
+		t.Errorf("Expected output from every step, got:\n%s", text)
+	}
+	if !strings.Contains(text, "Step 4: timed out") {
+		t.Errorf("Expected the last step to time out, got:\n%s", text)
+	}
+}
+
+func TestWaitForPatternSessionExit(t *testing.T) {
+	sess := startTestSession(t, "test-expect-exit", "sh", "-c", "echo bye")
+
+	start := time.Now()
+	output, matched := waitForPattern(context.Background(), sess, regexp.MustCompile("never"), 5*time.Second)
+	if matched {
+		t.Errorf("Expected no match")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Expected to return promptly when the session exits")
+	}
+	if !strings.Contains(output, "bye") {
+		t.Errorf("Expected the remaining output, got %q", output)
+	}
+}
+
+func TestInteractCommandTimeout(t *testing.T) {
+	sess := startTestSession(t, "test-command-timeout", "/bin/sh")
+	time.Sleep(200 * time.Millisecond)
+	sess.Clear()
+
+	run := func(input string) string {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": input, "command_timeout": "0.5"}
+		result, _ := interactSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	start := time.Now()
+	text := run("echo partial; sleep 30\n")
+	if !strings.Contains(text, "timed out") || !strings.Contains(text, "partial") {
+		t.Errorf("Expected partial output marked as timed out, got:\n%s", text)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Interrupt took too long: %v", elapsed)
+	}
+
+	// The interrupted session must still be usable
+	text = run("echo still-$((40+2))\n")
+	if !strings.Contains(text, "still-42") || strings.Contains(text, "timed out") {
+		t.Errorf("Expected the next command to complete normally, got:\n%s", text)
+	}
+
+	// A prompt left unread from before isn't the command finishing
+	callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": "\n", "wait_duration": "0"})
+	time.Sleep(200 * time.Millisecond)
+	text, _ = callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": "sleep 0.3; echo late-$((1))\n", "command_timeout": "5"})
+	if !strings.Contains(text, "late-1") || strings.Contains(text, "timed out") {
+		t.Errorf("Expected the wait to last until the command finished, got:\n%s", text)
+	}
+}
+
+func TestInteractExpect(t *testing.T) {
+	sess := startTestSession(t, "test-expect", "/bin/sh")
+	time.Sleep(200 * time.Millisecond)
+	sess.Clear()
+
+	run := func(args map[string]any) (string, bool) {
+		args["session_id"] = sess.ID
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := interactSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	// Returns once the text appears, well before the default 10s bound
+	start := time.Now()
+	text, _ := run(map[string]any{"input": "sleep 0.3; echo done-$((40+2))\n", "expect": "done-42"})
+	if !strings.Contains(text, "done-42") || strings.Contains(text, "not seen") {
+		t.Errorf("Expected the awaited output, got:\n%s", text)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expect should return on match, took %v", elapsed)
+	}
+
+	text, _ = run(map[string]any{"input": "echo ab-12; sleep 0.2; echo ab-345\n", "expect_regex": `ab-\d{3}`})
+	if !strings.Contains(text, "ab-345") {
+		t.Errorf("Expected output up to the regex match, got:\n%s", text)
+	}
+
+	text, _ = run(map[string]any{"input": "echo nope\n", "expect": "never", "wait_duration": "0.3", "format": "json"})
+	var res interactResult
+	if err := json.Unmarshal([]byte(text), &res); err != nil || res.Matched == nil || *res.Matched || !strings.Contains(res.Output, "nope") {
+		t.Errorf("Expected a JSON result marked as not matched, got:\n%s", text)
+	}
+
+	for _, args := range []map[string]any{
+		{"expect": "a", "expect_regex": "b"},
+		{"expect_regex": "("},
+		{"expect": "a", "command_timeout": "1"},
+	} {
+		if text, isErr := run(args); !isErr {
+			t.Errorf("Expected %v to be rejected, got: %s", args, text)
+		}
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	sess := startTestSession(t, "test-run-command", "/bin/sh")
+	time.Sleep(200 * time.Millisecond)
+
+	run := func(args map[string]any) runResult {
+		args["session_id"], args["format"] = sess.ID, "json"
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := runCommandHandler(context.Background(), req)
+		var res runResult
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &res); err != nil {
+			t.Fatalf("run_command failed: %s", result.Content[0].(mcp.TextContent).Text)
+		}
+		return res
+	}
+
+	res := run(map[string]any{"command": "echo hello; echo world"})
+	if res.ExitCode == nil || *res.ExitCode != 0 || res.Output != "hello\r\nworld\r\n" {
+		t.Errorf("Expected the bare output and exit code 0, got %+v", res)
+	}
+	res = run(map[string]any{"command": "printf partial; (exit 7)"})
+	if res.ExitCode == nil || *res.ExitCode != 7 || res.Output != "partial" {
+		t.Errorf("Expected output without a trailing newline and exit code 7, got %+v", res)
+	}
+	// Neither a background job nor a comment swallows the report
+	res = run(map[string]any{"command": "true &"})
+	if res.ExitCode == nil || *res.ExitCode != 0 || res.TimedOut {
+		t.Errorf("Expected a background command to report exit code 0, got %+v", res)
+	}
+	res = run(map[string]any{"command": "echo noted # a comment"})
+	if res.ExitCode == nil || *res.ExitCode != 0 || res.Output != "noted\r\n" {
+		t.Errorf("Expected a trailing comment to leave the report alone, got %+v", res)
+	}
+	res = run(map[string]any{"command": "sleep 30", "timeout": "0.3"})
+	if !res.TimedOut || res.ExitCode != nil {
+		t.Errorf("Expected a timeout without an exit code, got %+v", res)
+	}
+	if res.AwaitingInput != nil {
+		t.Errorf("Expected no input prompt, got %+v", res.AwaitingInput)
+	}
+	// A command blocked on a prompt says so, though it's interrupted too
+	res = run(map[string]any{"command": "printf 'Password: '; read -r reply", "timeout": "0.3"})
+	if !res.TimedOut || res.AwaitingInput == nil || res.AwaitingInput.Type != PromptPassword {
+		t.Errorf("Expected a timeout awaiting a password, got %+v", res)
+	}
+	// The interrupted shell is still usable
+	res = run(map[string]any{"command": "false"})
+	if res.ExitCode == nil || *res.ExitCode != 1 || res.TimedOut {
+		t.Errorf("Expected exit code 1 after the interrupt, got %+v", res)
+	}
+
+	// A command ignoring Ctrl+C is killed, and the shell survives that too
+	res = run(map[string]any{"command": `sh -c 'trap "" INT; sleep 30'`, "timeout": "0.3"})
+	if !res.TimedOut || res.Killed != "SIGKILL" {
+		t.Errorf("Expected the command to be killed, got %+v", res)
+	}
+	res = run(map[string]any{"command": "echo alive"})
+	if res.ExitCode == nil || *res.ExitCode != 0 || res.Output != "alive\r\n" {
+		t.Errorf("Expected the shell to survive the kill, got %+v", res)
+	}
+}
+
+func TestPromptShape(t *testing.T) {
+	shape := shapeOf("alice@web01:~/src (main)$ ")
+	for line, want := range map[string]bool{
+		"alice@web01:~/src (main)$ ":        true,
+		"alice@web01:/var/log$ ":            true,
+		"\x1b[32malice@web01\x1b[0m:/tmp$ ": true,
+		"alice@web01:/tmp$ ls":              false,
+		"bob@db01:/tmp$ ":                   false,
+		"> ":                                false,
+	} {
+		if got := shape.ends(line); got != want {
+			t.Errorf("ends(%q) = %v, want %v", line, got, want)
+		}
+	}
+	if !shape.starts("alice@web01:/tmp$ ls -l") {
+		t.Errorf("Expected a prompt with a command typed after it to start a line")
+	}
+
+	for line, want := range map[string]string{
+		"login banner\r\n[12:01:03] $ ": "[12:01:03] $ ",
+		"echo 'a\r\n> ":                 "",
+		"$ $ ":                          "",
+	} {
+		sess := &Session{}
+		if sess.notePrompt(line, defaultPromptRe); sess.Prompt() != want {
+			t.Errorf("notePrompt(%q) learned %q, want %q", line, sess.Prompt(), want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// parseFlags applies the command-line flags in args on top of cfg, which
+// holds the config file and environment settings; flags take precedence
+// over both. --config reads another config file first, so the other flags
+// still win. Errors are reported to stderr; flag.ErrHelp means -h was given.
+func parseFlags(cfg Config, args []string, stderr io.Writer) (Config, error) {
+	fs := flag.NewFlagSet("mcpssh", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: mcpssh [flags]\n\nServes SSH and local shell sessions over MCP, on stdio by default. Flags override the\nconfig file and the MCPSSH_* environment variables.\n\n")
+		fs.PrintDefaults()
+	}
+	var (
+		configFile    = fs.String("config", "", "YAML config file (MCPSSH_CONFIG; default ~/.config/mcpssh/config.yaml)")
+		transport     = fs.String("transport", cfg.SSHTransport, "default SSH transport, exec or native (MCPSSH_SSH_TRANSPORT)")
+		hostKeyPolicy = fs.String("host-key-policy", cfg.HostKeyPolicy, "default host key policy: strict, accept-new or off (MCPSSH_HOST_KEY_POLICY)")
+		maxSessions   = fs.Int("max-sessions", cfg.MaxSessions, "most live sessions at once, 0 for no limit (MCPSSH_MAX_SESSIONS)")
+		evictIdle     = fs.Bool("evict-idle", cfg.EvictIdle, "at -max-sessions, close the least recently used session instead of refusing a new one (MCPSSH_EVICT_IDLE)")
+		defaultWait   = fs.Float64("default-wait", cfg.DefaultWait.Seconds(), "seconds to wait for output when a call gives no wait_duration (MCPSSH_DEFAULT_WAIT)")
+		maxWait       = fs.Float64("max-wait", cfg.MaxWait.Seconds(), "upper bound in seconds on wait_duration and command_timeout (MCPSSH_MAX_WAIT)")
+		idleTimeout   = fs.Float64("idle-timeout", cfg.IdleTimeout.Seconds(), "close sessions unused for this many seconds, 0 to disable (MCPSSH_IDLE_TIMEOUT)")
+		allowedHosts  = fs.String("allowed-hosts", strings.Join(cfg.AllowedHosts, ","), "comma-separated glob patterns of permitted hosts (MCPSSH_ALLOWED_HOSTS)")
+		policyFile    = fs.String("policy-file", cfg.PolicyFile, "YAML file of allow, deny and confirm rules for session input (MCPSSH_POLICY_FILE)")
+		readOnly      = fs.Bool("read-only", cfg.ReadOnly, "make every session read-only, so agents can watch output but never type (MCPSSH_READ_ONLY)")
+		backing       = fs.String("backing", cfg.Backing, "run remote shells inside tmux or screen by default, so they survive restarts (MCPSSH_BACKING)")
+		stateFile     = fs.String("state-file", cfg.StateFile, "JSON file keeping session metadata across restarts (MCPSSH_STATE_FILE)")
+		transcriptDir = fs.String("transcript-dir", cfg.TranscriptDir, "write a transcript of every session's input and output to this directory (MCPSSH_TRANSCRIPT_DIR)")
+		transcriptFmt = fs.String("transcript-format", cfg.TranscriptFormat, "transcript format: text, or asciicast for asciinema v2 recordings (MCPSSH_TRANSCRIPT_FORMAT)")
+		auditFile     = fs.String("audit-file", cfg.AuditFile, "append a JSON line per tool call to this file (MCPSSH_AUDIT_FILE)")
+		logFile       = fs.String("log-file", cfg.LogFile, "append logs to this file instead of stderr (MCPSSH_LOG_FILE)")
+		logLevel      = fs.String("log-level", cfg.LogLevel, "minimum log level: debug, info, warn or error (MCPSSH_LOG_LEVEL)")
+		serveMode     = fs.String("serve", cfg.Serve, "serve MCP over stdio, streamable http or sse (MCPSSH_SERVE)")
+		listen        = fs.String("listen", cfg.Listen, "address to listen on with -serve http or sse (MCPSSH_LISTEN)")
+		authTokenFile = fs.String("auth-token-file", cfg.AuthTokenFile, "file holding the bearer token HTTP clients must present (MCPSSH_AUTH_TOKEN_FILE)")
+		tlsCert       = fs.String("tls-cert", cfg.TLSCert, "serve HTTP over TLS with this certificate (MCPSSH_TLS_CERT)")
+		tlsKey        = fs.String("tls-key", cfg.TLSKey, "private key of -tls-cert (MCPSSH_TLS_KEY)")
+		tlsClientCA   = fs.String("tls-client-ca", cfg.TLSClientCA, "require client certificates signed by this CA (MCPSSH_TLS_CLIENT_CA)")
+	)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err // Already reported by fs
+	}
+	fail := func(err error) (Config, error) {
+		fmt.Fprintf(stderr, "mcpssh: %v\n", err)
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if *configFile != "" {
+		os.Setenv("MCPSSH_CONFIG", *configFile)
+		if cfg = loadConfig(); configErr != nil {
+			return fail(configErr)
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "transport":
+			if *transport != TransportExec && *transport != TransportNative {
+				err = fmt.Errorf("invalid -transport %q (want %s or %s)", *transport, TransportExec, TransportNative)
+			}
+			cfg.SSHTransport = *transport
+		case "host-key-policy":
+			if !validHostKeyPolicy(*hostKeyPolicy) {
+				err = fmt.Errorf("invalid -host-key-policy %q", *hostKeyPolicy)
+			}
+			cfg.HostKeyPolicy = *hostKeyPolicy
+		case "max-sessions":
+			if *maxSessions < 0 {
+				err = fmt.Errorf("-max-sessions must not be negative (0 disables it)")
+			}
+			cfg.MaxSessions = *maxSessions
+		case "evict-idle":
+			cfg.EvictIdle = *evictIdle
+		case "default-wait":
+			if *defaultWait < 0 {
+				err = fmt.Errorf("-default-wait must not be negative")
+			}
+			cfg.DefaultWait = time.Duration(*defaultWait * float64(time.Second))
+		case "max-wait":
+			if *maxWait <= 0 {
+				err = fmt.Errorf("-max-wait must be positive")
+			}
+			cfg.MaxWait = time.Duration(*maxWait * float64(time.Second))
+		case "idle-timeout":
+			if *idleTimeout < 0 {
+				err = fmt.Errorf("-idle-timeout must not be negative (0 disables it)")
+			}
+			cfg.IdleTimeout = time.Duration(*idleTimeout * float64(time.Second))
+		case "allowed-hosts":
+			cfg.AllowedHosts = splitList(*allowedHosts)
+		case "policy-file":
+			cfg.PolicyFile = *policyFile
+		case "read-only":
+			cfg.ReadOnly = *readOnly
+		case "backing":
+			if !validBacking(*backing) {
+				err = fmt.Errorf("invalid -backing %q (want %s or %s)", *backing, BackingTmux, BackingScreen)
+			}
+			cfg.Backing = *backing
+		case "state-file":
+			cfg.StateFile = *stateFile
+		case "transcript-dir":
+			cfg.TranscriptDir = *transcriptDir
+		case "transcript-format":
+			if !validTranscriptFormat(*transcriptFmt) {
+				err = fmt.Errorf("invalid -transcript-format %q (want %s or %s)", *transcriptFmt, TranscriptText, TranscriptAsciicast)
+			}
+			cfg.TranscriptFormat = *transcriptFmt
+		case "audit-file":
+			cfg.AuditFile = *auditFile
+		case "log-file":
+			cfg.LogFile = *logFile
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		case "serve":
+			if !validServeMode(*serveMode) {
+				err = fmt.Errorf("invalid -serve %q (want %s, %s or %s)", *serveMode, ServeStdio, ServeHTTP, ServeSSE)
+			}
+			cfg.Serve = *serveMode
+		case "listen":
+			cfg.Listen = *listen
+		case "auth-token-file":
+			cfg.AuthTokenFile = *authTokenFile
+		case "tls-cert":
+			cfg.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.TLSKey = *tlsKey
+		case "tls-client-ca":
+			cfg.TLSClientCA = *tlsClientCA
+		}
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFlags(t *testing.T) {
+	base := loadConfig()
+	base.LogLevel = "warn" // As if from the environment
+
+	cfg, err := parseFlags(base, []string{
+		"--transport", "native",
+		"--max-sessions=5",
+		"--default-wait", "1.5",
+		"-log-file", "/tmp/mcpssh.log",
+		"--allowed-hosts", "web*,db",
+	}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags failed: %v", err)
+	}
+	if cfg.SSHTransport != TransportNative || cfg.MaxSessions != 5 || cfg.DefaultWait != 1500*time.Millisecond ||
+		cfg.LogFile != "/tmp/mcpssh.log" || !slices.Equal(cfg.AllowedHosts, []string{"web*", "db"}) {
+		t.Errorf("Flags not applied: %+v", cfg)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("Expected settings without a flag to be kept, got log level %q", cfg.LogLevel)
+	}
+
+	for _, args := range [][]string{
+		{"--transport", "telnet"},
+		{"--host-key-policy", "sometimes"},
+		{"--max-sessions", "-1"},
+		{"--max-wait", "0"},
+		{"--default-wait", "soon"},
+		{"--no-such-flag"},
+		{"stray"},
+	} {
+		if _, err := parseFlags(base, args, io.Discard); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+	if _, err := parseFlags(base, []string{"-h"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected -h to return flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestParseFlagsConfig(t *testing.T) {
+	t.Setenv("MCPSSH_CONFIG", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("max_wait: 60\nmax_sessions: 3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The other flags override the file named by --config
+	cfg, err := parseFlags(loadConfig(), []string{"--max-sessions", "8", "--config", path}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags failed: %v", err)
+	}
+	if cfg.ConfigFile != path || cfg.MaxWait != time.Minute || cfg.MaxSessions != 8 {
+		t.Errorf("Expected max_wait from the file and max_sessions from the flag, got %+v", cfg)
+	}
+
+	if _, err := parseFlags(loadConfig(), []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, io.Discard); err == nil {
+		t.Errorf("Expected a missing --config file to be rejected")
+	}
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Port forward kinds.
+const (
+	ForwardLocal  = "local"  // ssh -L: a local port reaches a host:port from the session's host
+	ForwardRemote = "remote" // ssh -R: a port on the session's host reaches a host:port from here
+	ForwardSOCKS  = "socks"  // ssh -D: a local SOCKS proxy reaches any host:port from the session's host
+)
+
+// remoteForwardTimeout bounds the wait for an ssh -R process to report
+// whether the remote host accepted the forward.
+const remoteForwardTimeout = 30 * time.Second
+
+// forward is a port forward tied to a session. It lives until closed with
+// close_forward or until its session is closed; a reconnected session keeps
+// its forwards, since each connection looks the session up afresh.
+type forward struct {
+	ID        string
+	SessionID string
+	Kind      string
+	Listen    string // Address accepting connections, on the session's host for ForwardRemote
+	Target    string // Address they are relayed to
+	CreatedAt time.Time
+
+	ln     net.Listener
+	proc   *exec.Cmd     // ssh -R process relaying instead of ln, whose connections aren't seen
+	exited chan struct{} // Closed once proc has exited
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Open connections, closed with the forward
+	total  int                   // Connections accepted so far
+	closed bool
+}
+
+// forwardManager tracks the open port forwards.
+type forwardManager struct {
+	mu       sync.Mutex
+	forwards map[string]*forward
+	seq      int
+}
+
+var forwards = &forwardManager{forwards: make(map[string]*forward)}
+
+// add registers f under a new ID and starts accepting connections, each of
+// which is handed to relay. A forward run by an ssh process has no relay and
+// is only watched for the process exiting.
+func (fm *forwardManager) add(f *forward, relay func(f *forward, c net.Conn)) {
+	fm.mu.Lock()
+	fm.seq++
+	f.ID = fmt.Sprintf("fwd-%d", fm.seq)
+	f.CreatedAt = time.Now()
+	f.conns = make(map[net.Conn]struct{})
+	fm.forwards[f.ID] = f
+	fm.mu.Unlock()
+	logger.Info("port forward opened", "forward_id", f.ID, "session_id", f.SessionID, "kind", f.Kind, "listen", f.Listen, "target", f.Target)
+
+	if f.proc != nil {
+		go func() {
+			<-f.exited
+			fm.remove(f.ID)
+		}()
+		return
+	}
+	go func() {
+		for {
+			c, err := f.ln.Accept()
+			if err != nil {
+				fm.remove(f.ID) // Closed, or the listener failed
+				return
+			}
+			if !f.track(c) {
+				c.Close()
+				return
+			}
+			go func() {
+				defer f.untrack(c)
+				relay(f, c)
+			}()
+		}
+	}()
+}
+
+func (f *forward) track(c net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[c] = struct{}{}
+	f.total++
+	return true
+}
+
+func (f *forward) untrack(c net.Conn) {
+	c.Close()
+	f.mu.Lock()
+	delete(f.conns, c)
+	f.mu.Unlock()
+}
+
+// stats returns the number of open and of all connections so far.
+func (f *forward) stats() (open, total int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.conns), f.total
+}
+
+// close stops accepting and drops the open connections.
+func (f *forward) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	if f.proc != nil {
+		f.proc.Process.Kill()
+		return
+	}
+	f.ln.Close()
+	for c := range f.conns {
+		c.Close()
+	}
+}
+
+// remove closes and unregisters a forward, reporting whether it existed.
+func (fm *forwardManager) remove(id string) bool {
+	fm.mu.Lock()
+	f, ok := fm.forwards[id]
+	delete(fm.forwards, id)
+	fm.mu.Unlock()
+	if ok {
+		f.close()
+		logger.Info("port forward closed", "forward_id", id, "session_id", f.SessionID)
+	}
+	return ok
+}
+
+// removeSession closes every forward of a session.
+func (fm *forwardManager) removeSession(sessID string) {
+	for _, f := range fm.list(sessID) {
+		fm.remove(f.ID)
+	}
+}
+
+// list returns the forwards of sessID (or all if empty), oldest first.
+func (fm *forwardManager) list(sessID string) []*forward {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	var list []*forward
+	for _, f := range fm.forwards {
+		if sessID == "" || f.SessionID == sessID {
+			list = append(list, f)
+		}
+	}
+	slices.SortFunc(list, func(a, b *forward) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return list
+}
+
+// dialVia relays c to target as reached from the host of session sessID:
+// over a new channel of a native connection, or through an ssh -W process
+// with the session's options (sharing its connection when connection
+// sharing is on). If connected isn't nil it is called before relaying,
+// once target is known to be reached (native) or right away (ssh -W).
+func dialVia(sessID, target string, c net.Conn, connected func() error) error {
+	sess, ok := manager.Get(sessID)
+	if !ok || !sess.Alive() {
+		return fmt.Errorf("session %s is not connected", sessID)
+	}
+	if sess.native != nil {
+		rc, err := sess.native.client.Dial("tcp", target)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if connected != nil {
+			if err := connected(); err != nil {
+				return err
+			}
+		}
+		pipe(c, rc)
+		return nil
+	}
+	opts := *sess.SSH
+	opts.PTYMode = PTYDisable
+	opts.StdioForward = target
+	args, err := buildSSHArgs(opts)
+	if err != nil {
+		return err
+	}
+	path, err := resolveSSHPath()
+	if err != nil {
+		return err
+	}
+	if connected != nil {
+		if err := connected(); err != nil {
+			return err
+		}
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout = c, c
+	return cmd.Run()
+}
+
+// pipe copies between a and b until either side is done.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+}
+
+// forwardTarget validates a host and port into a host:port address.
+func forwardTarget(host string, port int) (string, error) {
+	if port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid port %d", port)
+	}
+	if err := validateToken("host", host); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// forwardSession looks up the SSH session a forward is requested for, or
+// returns the error result.
+func forwardSession(args mcp.CallToolRequest) (*Session, *mcp.CallToolResult) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return nil, mcp.NewToolResultError("Session not found")
+	}
+	if _, docker := dockerContainer(sess.Host); docker {
+		return nil, mcp.NewToolResultError("Port forwarding needs an SSH session; publish the container's ports with docker instead")
+	}
+	if _, _, kube := kubePod(sess.Host); kube {
+		return nil, mcp.NewToolResultError("Port forwarding needs an SSH session; use kubectl port-forward for pods")
+	}
+	if isSerialHost(sess.Host) {
+		return nil, mcp.NewToolResultError("Port forwarding needs an SSH session; a serial console has no network connection")
+	}
+	if isTelnetHost(sess.Host) {
+		return nil, mcp.NewToolResultError("Port forwarding needs an SSH session; telnet can't forward ports")
+	}
+	if sess.SSH == nil {
+		return nil, mcp.NewToolResultError("Port forwarding needs an SSH session; local sessions already run on this machine")
+	}
+	if !sess.Alive() {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason()))
+	}
+	return sess, nil
+}
+
+// listenLocal listens on the local_port requested, or a free one, on the
+// loopback interface, or returns the error result.
+func listenLocal(args mcp.CallToolRequest) (net.Listener, *mcp.CallToolResult) {
+	localPort := args.GetInt("local_port", 0)
+	if localPort < 0 || localPort > 65535 {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("invalid local_port %d", localPort))
+	}
+	// Loopback only: anyone who can connect gets into the remote network
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to listen: %v", err))
+	}
+	return ln, nil
+}
+
+func forwardPortHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, errResult := forwardSession(args)
+	if errResult != nil {
+		return errResult, nil
+	}
+	target, err := forwardTarget(args.GetString("remote_host", "localhost"), args.GetInt("remote_port", 0))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	ln, errResult := listenLocal(args)
+	if errResult != nil {
+		return errResult, nil
+	}
+	f := &forward{SessionID: sess.ID, Kind: ForwardLocal, Listen: ln.Addr().String(), Target: target, ln: ln}
+	forwards.add(f, func(f *forward, c net.Conn) {
+		if err := dialVia(f.SessionID, f.Target, c, nil); err != nil {
+			logger.Warn("port forward connection failed", "forward_id", f.ID, "target", f.Target, "err", err)
+		}
+	})
+	port := ln.Addr().(*net.TCPAddr).Port
+	if wantJSON(args) {
+		return jsonResult(describeForward(f)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Forwarding %s to %s via session %s. Forward ID: %s\nLocal port: %d",
+		f.Listen, f.Target, sess.Label(), f.ID, port)), nil
+}
+
+func reverseForwardHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// Lets the remote host reach the server's own network, which is local
+	// access
+	if err := checkLocalAllowed(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("reverse_forward_port is unavailable: %v", err)), nil
+	}
+	sess, errResult := forwardSession(args)
+	if errResult != nil {
+		return errResult, nil
+	}
+	target, err := forwardTarget(args.GetString("local_host", "localhost"), args.GetInt("local_port", 0))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	remotePort := args.GetInt("remote_port", 0)
+	if remotePort < 0 || remotePort > 65535 {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid remote_port %d", remotePort)), nil
+	}
+	f := &forward{SessionID: sess.ID, Kind: ForwardRemote, Target: target}
+	if sess.native != nil {
+		// Loopback only, like ssh -R without GatewayPorts
+		f.ln, err = sess.native.client.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(remotePort)))
+	} else {
+		f.proc, f.exited, remotePort, err = startRemoteForward(sess, remotePort, target)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to forward a port on %s: %v", sess.Label(), err)), nil
+	}
+	if f.ln != nil {
+		remotePort = f.ln.Addr().(*net.TCPAddr).Port
+	}
+	f.Listen = net.JoinHostPort("127.0.0.1", strconv.Itoa(remotePort))
+	forwards.add(f, func(f *forward, c net.Conn) {
+		rc, err := net.Dial("tcp", f.Target)
+		if err != nil {
+			logger.Warn("port forward connection failed", "forward_id", f.ID, "target", f.Target, "err", err)
+			return
+		}
+		defer rc.Close()
+		pipe(c, rc)
+	})
+	if wantJSON(args) {
+		return jsonResult(describeForward(f)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Forwarding %s on %s to %s. Forward ID: %s\nRemote port: %d",
+		f.Listen, sess.Label(), f.Target, f.ID, remotePort)), nil
+}
+
+// startRemoteForward starts an ssh -R process forwarding remotePort (0 for
+// one picked by the remote host) on the session's host to target, and waits
+// until the remote host has accepted it. It returns the process, a channel
+// closed once it has exited and the remote port.
+func startRemoteForward(sess *Session, remotePort int, target string) (*exec.Cmd, chan struct{}, int, error) {
+	opts := *sess.SSH
+	opts.PTYMode = PTYDisable
+	// A connection of its own, so that ending the process ends the forward;
+	// one added through a shared connection would live on in its master
+	opts.ControlPath = ""
+	opts.RemoteForward = fmt.Sprintf("%d:%s", remotePort, target)
+	args, err := buildSSHArgs(opts)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	path, err := resolveSSHPath()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	watch := &remoteForwardWatch{requested: remotePort, ready: make(chan error, 1)}
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = watch
+	if err := cmd.Start(); err != nil {
+		return nil, nil, 0, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case err = <-watch.ready:
+	case <-exited:
+		err = fmt.Errorf("ssh exited: %s", watch.lastLine())
+	case <-time.After(remoteForwardTimeout):
+		err = fmt.Errorf("no answer from the remote host within %s", remoteForwardTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, nil, 0, err
+	}
+	return cmd, exited, watch.port(), nil
+}
+
+var (
+	remoteForwardAllocated = regexp.MustCompile(`Allocated port (\d+) for remote forward`)
+	remoteForwardFailed    = regexp.MustCompile(`remote forward failure|remote port forwarding failed`)
+)
+
+// remoteForwardWatch reads the stderr of an ssh -R process for the outcome
+// of the forward, sending it to ready once.
+type remoteForwardWatch struct {
+	requested int // Remote port asked for; 0 waits for the allocated one
+	ready     chan error
+
+	mu        sync.Mutex
+	partial   []byte // Unterminated line
+	last      string // Last line that isn't debug output, for errors
+	allocated int
+	answered  bool
+}
+
+func (w *remoteForwardWatch) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+		if line != "" && !strings.HasPrefix(line, "debug") {
+			w.last = line
+		}
+		if w.answered {
+			continue
+		}
+		switch m := remoteForwardAllocated.FindStringSubmatch(line); {
+		case m != nil:
+			w.allocated, _ = strconv.Atoi(m[1])
+			w.answer(nil)
+		case remoteForwardFailed.MatchString(line):
+			w.answer(fmt.Errorf("the remote host refused the forward: %s", line))
+		case w.requested != 0 && strings.Contains(line, "remote forward success"):
+			w.answer(nil)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *remoteForwardWatch) answer(err error) {
+	w.answered = true
+	w.ready <- err
+}
+
+func (w *remoteForwardWatch) lastLine() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last == "" {
+		return "no output"
+	}
+	return w.last
+}
+
+// port returns the remote port the forward listens on.
+func (w *remoteForwardWatch) port() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.requested != 0 {
+		return w.requested
+	}
+	return w.allocated
+}
+
+type forwardResult struct {
+	ForwardID       string    `json:"forward_id"`
+	SessionID       string    `json:"session_id"`
+	Kind            string    `json:"kind"`
+	Listen          string    `json:"listen"`
+	Target          string    `json:"target,omitempty"`
+	OpenConnections int       `json:"open_connections"`
+	Connections     int       `json:"connections"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func describeForward(f *forward) forwardResult {
+	open, total := f.stats()
+	return forwardResult{ForwardID: f.ID, SessionID: f.SessionID, Kind: f.Kind, Listen: f.Listen, Target: f.Target,
+		OpenConnections: open, Connections: total, CreatedAt: f.CreatedAt}
+}
+
+func listForwardsHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var sessID string
+	if id := args.GetString("session_id", ""); id != "" {
+		sess, ok := manager.Lookup(id)
+		if !ok {
+			return mcp.NewToolResultError("Session not found"), nil
+		}
+		sessID = sess.ID
+	}
+	list := forwards.list(sessID)
+	if wantJSON(args) {
+		results := make([]forwardResult, len(list))
+		for i, f := range list {
+			results[i] = describeForward(f)
+		}
+		return jsonResult(results), nil
+	}
+	if len(list) == 0 {
+		return mcp.NewToolResultText("No port forwards."), nil
+	}
+	var b strings.Builder
+	for _, f := range list {
+		d := describeForward(f)
+		target := d.Target
+		if target == "" {
+			target = "any" // SOCKS
+		}
+		fmt.Fprintf(&b, "%s: %s %s -> %s (session %s, %d open / %d total connections)\n",
+			d.ForwardID, d.Kind, d.Listen, target, d.SessionID, d.OpenConnections, d.Connections)
+	}
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+func closeForwardHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id := args.GetString("forward_id", "")
+	if !forwards.remove(id) {
+		return mcp.NewToolResultError(fmt.Sprintf("Port forward %q not found", id)), nil
+	}
+	return mcp.NewToolResultText("Port forward closed"), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSHForward stands in for ssh -W: it greets with the target, then echoes.
+func fakeSSHForward(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ssh")
+	body := "#!/bin/sh\nwhile [ \"$1\" != \"-W\" ]; do shift; done\necho \"to $2\"\nexec cat\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.SSHPath
+	t.Cleanup(func() { config.SSHPath = saved })
+	config.SSHPath = script
+}
+
+func TestForwardPort(t *testing.T) {
+	fakeSSHForward(t)
+	sess := &Session{ID: "test-forward", Host: "web01", SSH: &SSHOptions{Host: "web01"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	if err := manager.Add(sess); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Remove(sess.ID)
+
+	for _, args := range []map[string]any{
+		{"session_id": "test-forward", "remote_port": 0},
+		{"session_id": "test-forward", "remote_port": 80, "remote_host": "-oProxyCommand=x"},
+		{"session_id": "test-forward", "remote_port": 80, "local_port": 70000},
+		{"session_id": "missing", "remote_port": 80},
+	} {
+		if text, isErr := callTool(forwardPortHandler, args); !isErr {
+			t.Errorf("%v: expected an error, got %s", args, text)
+		}
+	}
+
+	text, isErr := callTool(forwardPortHandler, map[string]any{"session_id": "test-forward", "remote_port": 5432})
+	if isErr || !strings.Contains(text, "Forward ID: fwd-") {
+		t.Fatalf("Expected a forward, got: %s", text)
+	}
+	id := strings.Fields(text[strings.Index(text, "fwd-"):])[0]
+	listen := forwards.list(sess.ID)[0].Listen
+
+	c, err := net.Dial("tcp", listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	if line, _ := r.ReadString('\n'); line != "to localhost:5432\n" {
+		t.Errorf("Expected the connection to reach localhost:5432, got %q", line)
+	}
+	c.Write([]byte("ping\n"))
+	if line, _ := r.ReadString('\n'); line != "ping\n" {
+		t.Errorf("Expected the data to be relayed, got %q", line)
+	}
+
+	if text, _ := callTool(listForwardsHandler, map[string]any{"session_id": "test-forward"}); !strings.Contains(text, id+": local "+listen+" -> localhost:5432") || !strings.Contains(text, "1 open / 1 total") {
+		t.Errorf("Expected the forward to be listed, got: %s", text)
+	}
+	if text, isErr := callTool(closeForwardHandler, map[string]any{"forward_id": id}); isErr {
+		t.Errorf("Expected the forward to close, got: %s", text)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Errorf("Expected the open connection to be dropped")
+	}
+	if c, err := net.Dial("tcp", listen); err == nil {
+		c.Close()
+		t.Errorf("Expected the port to be closed")
+	}
+	if _, isErr := callTool(closeForwardHandler, map[string]any{"forward_id": id}); !isErr {
+		t.Errorf("Expected an error closing the forward twice")
+	}
+
+	// Closing the session closes its forwards
+	callTool(forwardPortHandler, map[string]any{"session_id": "test-forward", "remote_port": 80})
+	manager.Remove(sess.ID)
+	if list := forwards.list(sess.ID); len(list) != 0 {
+		t.Errorf("Expected the session's forwards to be closed, got %d", len(list))
+	}
+}
+
+// fakeSSHReverse stands in for ssh -N -R, answering like OpenSSH at
+// LogLevel=DEBUG1: port 1 is refused, 0 gets port 40000 and others are
+// accepted. It records the forward asked for.
+func fakeSSHReverse(t *testing.T) (record string) {
+	dir := t.TempDir()
+	record = filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "ssh")
+	body := `#!/bin/sh
+while [ "$1" != "-R" ]; do shift; done
+echo "$2" >> ` + record + `
+case "$2" in
+1:*) echo "Error: remote port forwarding failed for listen port 1" >&2; exit 255 ;;
+0:*) echo "debug1: remote forward success for: listen 0:40000, connect ${2#0:}" >&2
+     echo "Allocated port 40000 for remote forward to ${2#0:}" >&2 ;;
+*) echo "debug1: remote forward success for: listen $2" >&2 ;;
+esac
+exec sleep 30
+`
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.SSHPath
+	t.Cleanup(func() { config.SSHPath = saved })
+	config.SSHPath = script
+	return record
+}
+
+func TestReverseForwardPort(t *testing.T) {
+	record := fakeSSHReverse(t)
+	sess := &Session{ID: "test-reverse", Host: "web01", SSH: &SSHOptions{Host: "web01", ControlPath: "/tmp/cm"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	if err := manager.Add(sess); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Remove(sess.ID)
+
+	if text, isErr := callTool(reverseForwardHandler, map[string]any{"session_id": "test-reverse", "local_port": 3000, "remote_port": 1}); !isErr || !strings.Contains(text, "refused the forward") {
+		t.Errorf("Expected the refused forward to fail, got: %s", text)
+	}
+	text, isErr := callTool(reverseForwardHandler, map[string]any{"session_id": "test-reverse", "local_port": 3000})
+	if isErr || !strings.Contains(text, "Remote port: 40000") {
+		t.Fatalf("Expected the allocated port, got: %s", text)
+	}
+	if text, isErr := callTool(reverseForwardHandler, map[string]any{"session_id": "test-reverse", "local_port": 3000, "local_host": "db", "remote_port": 8080}); isErr || !strings.Contains(text, "Forwarding 127.0.0.1:8080 on test-reverse to db:3000") {
+		t.Fatalf("Expected the requested port, got: %s", text)
+	}
+	// A gateway without local access mustn't expose the server's network
+	saved := config
+	config.AllowLocal = false
+	text, isErr = callTool(reverseForwardHandler, map[string]any{"session_id": "test-reverse", "local_port": 22})
+	config = saved
+	if !isErr || !strings.Contains(text, "local sessions are disabled") {
+		t.Errorf("Expected the forward to be refused without local access, got: %s", text)
+	}
+	calls, _ := os.ReadFile(record)
+	if string(calls) != "1:localhost:3000\n0:localhost:3000\n8080:db:3000\n" {
+		t.Errorf("Unexpected forwards asked for: %q", calls)
+	}
+
+	list := forwards.list(sess.ID)
+	if len(list) != 2 || list[0].Kind != ForwardRemote {
+		t.Fatalf("Expected two remote forwards, got %d", len(list))
+	}
+	if text, _ := callTool(listForwardsHandler, map[string]any{}); !strings.Contains(text, list[1].ID+": remote 127.0.0.1:8080 -> db:3000") {
+		t.Errorf("Expected the forward to be listed, got: %s", text)
+	}
+	proc := list[0].proc
+	callTool(closeForwardHandler, map[string]any{"forward_id": list[0].ID})
+	select {
+	case <-list[0].exited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the ssh process to be ended")
+	}
+	if proc.ProcessState == nil {
+		t.Errorf("Expected the ssh process to have exited")
+	}
+	manager.Remove(sess.ID)
+	if list := forwards.list(sess.ID); len(list) != 0 {
+		t.Errorf("Expected the session's forwards to be closed, got %d", len(list))
+	}
+}
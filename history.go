@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// History returns the lines of the session's output log: everything it
+// printed, read or not, as far back as the log reaches. A first line cut
+// short by the log limit is left out, and so is a trailing partial line
+// (such as a prompt).
+func (s *Session) History() []string {
+	s.bufMu.Lock()
+	data, start := s.outputBuf.since(0)
+	text := string(data[:max(bytes.LastIndexByte(data, '\n'), 0)])
+	s.bufMu.Unlock()
+
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if start > 0 {
+		lines = lines[1:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+func getHistoryHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	n := args.GetInt("last_n_lines", 100)
+	if n <= 0 || n > maxTailLines {
+		return mcp.NewToolResultError(fmt.Sprintf("last_n_lines must be between 1 and %d", maxTailLines)), nil
+	}
+	var grep *regexp.Regexp
+	if expr := args.GetString("grep", ""); expr != "" {
+		var err error
+		if grep, err = regexp.Compile(expr); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid grep: %v", err)), nil
+		}
+	}
+
+	lines := sess.History()
+	if args.GetBool("strip_ansi", sess.stripANSI) {
+		for i, line := range lines {
+			lines[i] = stripANSI(line)
+		}
+	}
+	if grep != nil {
+		lines = slices.DeleteFunc(lines, func(line string) bool { return !grep.MatchString(line) })
+	}
+	if len(lines) == 0 {
+		if grep != nil {
+			return mcp.NewToolResultText("(No matching lines in the history)"), nil
+		}
+		return mcp.NewToolResultText("(No history yet)"), nil
+	}
+	var note string
+	if len(lines) > n {
+		note = fmt.Sprintf("[Last %d of %d lines]\n", n, len(lines))
+		lines = lines[len(lines)-n:]
+	}
+	return mcp.NewToolResultText(note + strings.Join(lines, "\n")), nil
+}
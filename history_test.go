@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetHistory(t *testing.T) {
+	sess := &Session{ID: "test-history", Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	sess.outputBuf.limit = 200
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+
+	if text, _ := callTool(getHistoryHandler, map[string]any{"session_id": sess.ID}); text != "(No history yet)" {
+		t.Errorf("Expected no history, got: %s", text)
+	}
+	sess.outputBuf.WriteString("$ make\r\ncc -c a.c\r\n\x1b[31ma.c:3: error: x\x1b[0m\r\n")
+	sess.ReadAndClear() // Read output stays in the history
+	sess.outputBuf.WriteString("cc -c b.c\r\nb.c:9: error: y\r\n$ ")
+
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{}, "$ make\ncc -c a.c\n\x1b[31ma.c:3: error: x\x1b[0m\ncc -c b.c\nb.c:9: error: y"},
+		{map[string]any{"grep": "error", "strip_ansi": true}, "a.c:3: error: x\nb.c:9: error: y"},
+		{map[string]any{"grep": "error", "last_n_lines": 1}, "[Last 1 of 2 lines]\nb.c:9: error: y"},
+		{map[string]any{"grep": "warning"}, "(No matching lines in the history)"},
+	} {
+		tc.args["session_id"] = sess.ID
+		if text, _ := callTool(getHistoryHandler, tc.args); text != tc.want {
+			t.Errorf("%v: expected %q, got %q", tc.args, tc.want, text)
+		}
+	}
+	if text, isErr := callTool(getHistoryHandler, map[string]any{"session_id": sess.ID, "grep": "(x"}); !isErr || !strings.Contains(text, "Invalid grep") {
+		t.Errorf("Expected an invalid pattern to be rejected, got: %s", text)
+	}
+
+	// Past the limit the oldest lines go, without a cut-off first line
+	sess.outputBuf.WriteString(strings.Repeat("0123456789\r\n", 20))
+	if lines := sess.History(); len(lines) != 16 || lines[0] != "0123456789" {
+		t.Errorf("Expected the last 16 whole lines, got %q", lines)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key verification policies, mapping to ssh's StrictHostKeyChecking.
+const (
+	HostKeyStrict    = "strict"     // Only hosts already in known_hosts
+	HostKeyAcceptNew = "accept-new" // Record unknown hosts, refuse changed keys
+	HostKeyOff       = "off"        // No verification at all
+)
+
+func validHostKeyPolicy(policy string) bool {
+	return policy == HostKeyStrict || policy == HostKeyAcceptNew || policy == HostKeyOff
+}
+
+// hostKeyArgs returns the ssh options implementing policy; empty means
+// accept-new.
+func hostKeyArgs(policy string) ([]string, error) {
+	switch policy {
+	case HostKeyStrict:
+		return []string{"-o", "StrictHostKeyChecking=yes"}, nil
+	case "", HostKeyAcceptNew:
+		return []string{"-o", "StrictHostKeyChecking=accept-new"}, nil
+	case HostKeyOff:
+		// Also skip known_hosts entirely, or a changed key would still be
+		// refused for some auth methods and nag on every connection
+		return []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}, nil
+	}
+	return nil, fmt.Errorf("invalid host key policy %q (want %s, %s or %s)", policy, HostKeyStrict, HostKeyAcceptNew, HostKeyOff)
+}
+
+// newHostKeyRe matches ssh's notice that it recorded an unknown host's key.
+var newHostKeyRe = regexp.MustCompile(`Permanently added '([^']+)'`)
+
+// execNewHostKeys reports the fingerprints of host keys the ssh binary
+// recorded while producing output, looked up with ssh-keygen in the
+// known_hosts files ssh uses for opts.
+func execNewHostKeys(opts *SSHOptions, output string) []string {
+	if opts == nil || cmp.Or(opts.HostKeyPolicy, HostKeyAcceptNew) != HostKeyAcceptNew {
+		return nil
+	}
+	matches := newHostKeyRe.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	files := knownHostsFiles(opts)
+	var keys []string
+	for _, m := range matches {
+		name := m[1]
+		found := false
+		for _, file := range files {
+			out, err := exec.Command("ssh-keygen", "-l", "-F", name, "-f", file).Output()
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(out), "\n") {
+				if fields := strings.Fields(line); len(fields) == 3 && !strings.HasPrefix(line, "#") {
+					keys = append(keys, fmt.Sprintf("%s %s %s", name, fields[1], fields[2]))
+					found = true
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, name+" (fingerprint unavailable)")
+		}
+	}
+	return keys
+}
+
+// knownHostsFiles asks ssh which user known_hosts files apply to opts.
+func knownHostsFiles(opts *SSHOptions) []string {
+	args, err := buildSSHArgs(*opts)
+	if err != nil {
+		return nil
+	}
+	sshPath, err := resolveSSHPath()
+	if err != nil {
+		return nil
+	}
+	out, err := exec.Command(sshPath, append([]string{"-G"}, args...)...).Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if files, ok := strings.CutPrefix(line, "userknownhostsfile "); ok {
+			return strings.Fields(files)
+		}
+	}
+	return nil
+}
+
+// knownHostsMu serializes appends to known_hosts by the native client.
+var knownHostsMu sync.Mutex
+
+// knownHostsPath is the known_hosts file of the native client.
+func knownHostsPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// nativeHostKeyCallback verifies host keys for the native client according
+// to policy, against knownHostsPath. Keys accepted and recorded under
+// accept-new are reported to accepted as "host TYPE SHA256:...".
+func nativeHostKeyCallback(policy string, accepted func(string)) ssh.HostKeyCallback {
+	if policy == HostKeyOff {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	path := knownHostsPath()
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+		known, err := knownhosts.New(path)
+		if err == nil {
+			err = known(hostname, remote, key)
+		} else if errors.Is(err, os.ErrNotExist) {
+			err = &knownhosts.KeyError{} // No file yet: every host is unknown
+		}
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err // Verified, changed key, or unreadable file
+		}
+		if policy == HostKeyStrict {
+			return fmt.Errorf("host key for %s is not in %s (host_key_policy strict)", hostname, path)
+		}
+		if err := appendKnownHost(path, hostname, key); err != nil {
+			return fmt.Errorf("failed to record host key: %w", err)
+		}
+		accepted(fmt.Sprintf("%s %s %s", knownhosts.Normalize(hostname), keyTypeName(key), ssh.FingerprintSHA256(key)))
+		return nil
+	}
+}
+
+// appendKnownHost records a host key, creating ~/.ssh as ssh would.
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// keyTypeName renders a key type the way ssh-keygen -l does, e.g. ED25519.
+func keyTypeName(key ssh.PublicKey) string {
+	name := strings.TrimPrefix(key.Type(), "ssh-")
+	if strings.HasPrefix(name, "ecdsa") {
+		return "ECDSA"
+	}
+	return strings.ToUpper(name)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// authToken returns the bearer token HTTP clients must present: the
+// contents of config.AuthTokenFile if set, else config.AuthToken. Empty
+// means no token is required.
+func authToken() (string, error) {
+	if config.AuthTokenFile == "" {
+		return config.AuthToken, nil
+	}
+	data, err := os.ReadFile(config.AuthTokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("auth token file %s is empty", config.AuthTokenFile)
+	}
+	return token, nil
+}
+
+// requireToken wraps h so that only requests bearing token get through.
+// An empty token lets every request through.
+func requireToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			logger.Warn("rejected unauthenticated request", "remote", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcpssh"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serverTLSConfig returns the TLS settings for the HTTP transports, or nil
+// to serve plain HTTP. With config.TLSClientCA set, clients must present a
+// certificate signed by it (mutual TLS).
+func serverTLSConfig() (*tls.Config, error) {
+	if config.TLSCert == "" && config.TLSKey == "" {
+		if config.TLSClientCA != "" {
+			return nil, errors.New("a TLS client CA needs a server certificate and key")
+		}
+		return nil, nil
+	}
+	if config.TLSCert == "" || config.TLSKey == "" {
+		return nil, errors.New("both a TLS certificate and key are needed")
+	}
+	cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if config.TLSClientCA != "" {
+		pem, err := os.ReadFile(config.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TLSClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// loopbackAddr reports whether the listen address addr only accepts local
+// connections. An empty host (":8080") listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return loopbackHost(host)
+}
+
+// loopbackHost reports whether host names the loopback interface.
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// rejectForeignRequests wraps h to turn away requests a web page open in
+// the user's browser could make, e.g. by rebinding its DNS name to
+// 127.0.0.1: on a loopback listen address the Host header must name the
+// loopback interface, and a request carrying an Origin must come from
+// there or from the server itself.
+func rejectForeignRequests(listen string, h http.Handler) http.Handler {
+	local := loopbackAddr(listen)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		if local && !loopbackHost(host) {
+			logger.Warn("rejected request for a foreign host", "remote", r.RemoteAddr, "host", r.Host)
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || (!loopbackHost(u.Hostname()) && u.Host != r.Host) {
+				logger.Warn("rejected cross-origin request", "remote", r.RemoteAddr, "origin", origin)
+				http.Error(w, "forbidden origin", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := requireToken("s3cret", ok)
+	for _, tt := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("POST", "/mcp", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("Authorization %q: expected status %d, got %d", tt.header, tt.want, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	requireToken("", ok).ServeHTTP(rec, httptest.NewRequest("POST", "/mcp", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected no token to let requests through, got status %d", rec.Code)
+	}
+}
+
+func TestRejectForeignRequests(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range []struct {
+		listen, host, origin string
+		want                 int
+	}{
+		{"127.0.0.1:8080", "127.0.0.1:8080", "", http.StatusOK},
+		{"127.0.0.1:8080", "localhost:8080", "http://localhost:6274", http.StatusOK},
+		{"127.0.0.1:8080", "[::1]:8080", "", http.StatusOK},
+		{"127.0.0.1:8080", "evil.example.com:8080", "", http.StatusForbidden},
+		{"127.0.0.1:8080", "127.0.0.1:8080", "http://evil.example.com", http.StatusForbidden},
+		{"0.0.0.0:8443", "mcp.example.com:8443", "", http.StatusOK},
+		{"0.0.0.0:8443", "mcp.example.com:8443", "https://mcp.example.com:8443", http.StatusOK},
+		{"0.0.0.0:8443", "mcp.example.com:8443", "https://evil.example.com", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/mcp", nil)
+		req.Host = tt.host
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		rec := httptest.NewRecorder()
+		rejectForeignRequests(tt.listen, ok).ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("listen %s, Host %s, Origin %q: expected status %d, got %d", tt.listen, tt.host, tt.origin, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("from-file\n"), 0o600)
+
+	config.AuthToken, config.AuthTokenFile = "from-env", path
+	if token, err := authToken(); err != nil || token != "from-file" {
+		t.Errorf("Expected the token file to win, got %q, %v", token, err)
+	}
+	os.WriteFile(path, []byte("\n"), 0o600)
+	if _, err := authToken(); err == nil {
+		t.Errorf("Expected an empty token file to be rejected")
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	config.TLSCert, config.TLSKey, config.TLSClientCA = "", "", ""
+	if cfg, err := serverTLSConfig(); cfg != nil || err != nil {
+		t.Errorf("Expected plain HTTP without a certificate, got %v, %v", cfg, err)
+	}
+	config.TLSCert = "cert.pem"
+	if _, err := serverTLSConfig(); err == nil {
+		t.Errorf("Expected a certificate without a key to be rejected")
+	}
+	config.TLSCert, config.TLSClientCA = "", "ca.pem"
+	if _, err := serverTLSConfig(); err == nil {
+		t.Errorf("Expected a client CA without a certificate to be rejected")
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.5:8080":  false,
+		"bogus":          false,
+	} {
+		if got := loopbackAddr(addr); got != want {
+			t.Errorf("loopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
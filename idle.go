@@ -0,0 +1,84 @@
+package main
+
+import "time"
+
+// Dead reasons of sessions closed for being idle.
+const (
+	idleReason    = "idle timeout"                                 // Closed by the idle reaper
+	evictedReason = "evicted to make room under the session limit" // Closed by MCPSSH_EVICT_IDLE
+)
+
+// markUsed records that a tool call referred to the session.
+func (s *Session) markUsed() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// LastUsed returns when a tool call last referred to the session, or its
+// creation time if none has. Unlike LastActive, output alone doesn't count:
+// a forgotten 'tail -f' is still abandoned.
+func (s *Session) LastUsed() time.Time {
+	if ns := s.lastUsed.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return s.CreatedAt
+}
+
+// ReapIdle closes every session not marked keep_alive that no tool call has
+// referred to for timeout, and returns how many it closed.
+func (sm *SessionManager) ReapIdle(timeout time.Duration) int {
+	cutoff := time.Now().Add(-timeout)
+	sm.mu.RLock()
+	var idle []*Session
+	for _, sess := range sm.sessions {
+		if !sess.keepAlive && sess.LastUsed().Before(cutoff) {
+			idle = append(idle, sess)
+		}
+	}
+	sm.mu.RUnlock()
+
+	closed := 0
+	for _, sess := range idle {
+		// Recheck: it may have been used or replaced since the scan. Not
+		// through Lookup, which would count as a use
+		sm.mu.RLock()
+		current := sm.sessions[sess.ID] == sess
+		sm.mu.RUnlock()
+		if !current || !sess.LastUsed().Before(cutoff) {
+			continue
+		}
+		sess.markDead(idleReason)
+		if sm.Remove(sess.ID) {
+			logger.Info("closed idle session", "session_id", sess.ID, "idle", time.Since(sess.LastUsed()).Round(time.Second))
+			closed++
+		}
+	}
+	return closed
+}
+
+// leastRecentlyUsed returns the live session not marked keep_alive that a
+// tool call referred to longest ago, or nil if there is none. The caller
+// must hold sm.mu.
+func (sm *SessionManager) leastRecentlyUsed() *Session {
+	var oldest *Session
+	for _, sess := range sm.sessions {
+		if sess.keepAlive || !sess.Alive() {
+			continue
+		}
+		if oldest == nil || sess.LastUsed().Before(oldest.LastUsed()) {
+			oldest = sess
+		}
+	}
+	return oldest
+}
+
+// startIdleReaper runs ReapIdle in the background, checking often enough
+// that sessions outlive the timeout by at most a tenth of it (within 1s to
+// 1m).
+func startIdleReaper(timeout time.Duration) {
+	interval := min(max(timeout/10, time.Second), time.Minute)
+	go func() {
+		for range time.Tick(interval) {
+			manager.ReapIdle(timeout)
+		}
+	}()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestReapIdle(t *testing.T) {
+	newSession := func(id string, keepAlive bool) *Session {
+		sess := &Session{ID: id, Host: "local", Cmd: exec.Command("true"), CreatedAt: time.Now().Add(-time.Hour), keepAlive: keepAlive, done: make(chan struct{}), exited: make(chan struct{})}
+		f, err := os.Open(os.DevNull) // Stands in for the PTY, which Close closes
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Ptmx = f
+		if err := manager.Add(sess); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { manager.Remove(id) })
+		return sess
+	}
+	idle := newSession("test-idle", false)
+	kept := newSession("test-idle-keep", true)
+	used := newSession("test-idle-used", false)
+	// Output doesn't count as use; a lookup by a tool does
+	idle.Touch()
+	manager.Lookup("test-idle-used")
+
+	manager.ReapIdle(30 * time.Minute)
+	if _, ok := manager.Lookup("test-idle"); ok {
+		t.Errorf("Expected the idle session to be closed")
+	}
+	if idle.DeadReason() != idleReason {
+		t.Errorf("Expected dead reason %q, got %q", idleReason, idle.DeadReason())
+	}
+	if _, ok := manager.Lookup("test-idle-keep"); !ok || !kept.Alive() {
+		t.Errorf("Expected the keep_alive session to survive")
+	}
+	if _, ok := manager.Lookup("test-idle-used"); !ok || !used.Alive() {
+		t.Errorf("Expected the recently used session to survive")
+	}
+}
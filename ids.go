@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Session ID schemes, selected with MCPSSH_ID_SCHEME.
+const (
+	IDSchemeUUID       = "uuid"       // 3f2b9c1e-... (default)
+	IDSchemeSequential = "sequential" // sess-1, sess-2, ...
+	IDSchemeHost       = "host"       // web01-ab12
+)
+
+func validIDScheme(scheme string) bool {
+	return scheme == IDSchemeUUID || scheme == IDSchemeSequential || scheme == IDSchemeHost
+}
+
+// newID generates a session ID that is not in use as an ID or a name.
+// Caller must hold sm.mu.
+func (sm *SessionManager) newID(host string) string {
+	for {
+		var id string
+		switch config.IDScheme {
+		case IDSchemeSequential:
+			sm.seq++
+			id = fmt.Sprintf("sess-%d", sm.seq)
+		case IDSchemeHost:
+			id = hostIDPrefix(host) + "-" + randomHex(2)
+		default:
+			id = uuid.New().String()
+		}
+		if !sm.nameTaken(id, "") {
+			return id
+		}
+	}
+}
+
+// hostIDPrefix derives a short, ID-safe prefix from a host: the first label
+// of the host name, without any user@ part.
+func hostIDPrefix(host string) string {
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	host = strings.Trim(host, "[]")
+	if !isIPv6(host) {
+		if i := strings.IndexByte(host, '.'); i > 0 && !isIPv4(host) {
+			host = host[:i]
+		}
+	}
+	prefix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, host)
+	if prefix == "" {
+		return "sess"
+	}
+	return prefix
+}
+
+func isIPv4(s string) bool {
+	return strings.Count(s, ".") == 3 && strings.Trim(s, "0123456789.") == ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
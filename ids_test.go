@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSessionIDSchemes(t *testing.T) {
+	orig := config.IDScheme
+	defer func() { config.IDScheme = orig }()
+
+	tests := []struct {
+		scheme string
+		host   string
+		want   *regexp.Regexp
+	}{
+		{IDSchemeUUID, "web01", regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)},
+		{IDSchemeSequential, "web01", regexp.MustCompile(`^sess-\d+$`)},
+		{IDSchemeHost, "deploy@web01.example.com", regexp.MustCompile(`^web01-[0-9a-f]{4}$`)},
+		{IDSchemeHost, "10.0.0.5", regexp.MustCompile(`^10-0-0-5-[0-9a-f]{4}$`)},
+		{IDSchemeHost, "[fe80::1]", regexp.MustCompile(`^fe80--1-[0-9a-f]{4}$`)},
+		{IDSchemeHost, "local", regexp.MustCompile(`^local-[0-9a-f]{4}$`)},
+	}
+	for _, tt := range tests {
+		config.IDScheme = tt.scheme
+		sm := &SessionManager{sessions: make(map[string]*Session)}
+		sess := &Session{Host: tt.host}
+		if err := sm.Add(sess); err != nil {
+			t.Fatalf("%s: Add failed: %v", tt.scheme, err)
+		}
+		if !tt.want.MatchString(sess.ID) {
+			t.Errorf("%s(%q): ID %q does not match %s", tt.scheme, tt.host, sess.ID, tt.want)
+		}
+		if got, ok := sm.Lookup(sess.ID); !ok || got != sess {
+			t.Errorf("%s: Lookup(%q) failed", tt.scheme, sess.ID)
+		}
+	}
+}
+
+func TestSequentialIDsSkipTakenNames(t *testing.T) {
+	orig := config.IDScheme
+	defer func() { config.IDScheme = orig }()
+	config.IDScheme = IDSchemeSequential
+
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+	sm.Add(&Session{ID: "x", name: "sess-1"})
+	sess := &Session{}
+	sm.Add(sess)
+	if sess.ID != "sess-2" {
+		t.Errorf("Expected sess-1 to be skipped since it is a name, got %q", sess.ID)
+	}
+	if err := sm.Add(&Session{ID: "sess-2"}); err == nil {
+		t.Errorf("Expected duplicate explicit ID to be rejected")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// kubeHostPrefix marks a start_session host as a Kubernetes pod:
+// "k8s:web-0" or, outside the current namespace, "k8s:prod/web-0".
+const kubeHostPrefix = "k8s:"
+
+// validKubeNameRe matches namespace, pod and container names (RFC 1123
+// labels and subdomains), which also keeps them from reading as options.
+var validKubeNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// kubePod returns the namespace ("" for kubectl's current one) and pod a
+// "k8s:[<namespace>/]<pod>" host names, and whether host is one.
+func kubePod(host string) (namespace, pod string, ok bool) {
+	rest, ok := strings.CutPrefix(host, kubeHostPrefix)
+	if !ok {
+		return "", "", false
+	}
+	if namespace, pod, found := strings.Cut(rest, "/"); found {
+		return namespace, pod, true
+	}
+	return "", rest, true
+}
+
+// containerHost reports whether host runs in a container, through docker or
+// kubectl, rather than on an SSH destination or locally.
+func containerHost(host string) bool {
+	_, docker := dockerContainer(host)
+	_, _, kube := kubePod(host)
+	return docker || kube
+}
+
+// resolveKubectlPath returns the configured kubectl binary, checking that
+// it exists and is executable.
+func resolveKubectlPath() (string, error) {
+	path, err := exec.LookPath(config.KubectlPath)
+	if err != nil {
+		return "", fmt.Errorf("kubectl binary %q is not usable (check MCPSSH_KUBECTL_PATH): %v", config.KubectlPath, err)
+	}
+	return path, nil
+}
+
+// kubectlExec builds a kubectl exec of argv in the pod host names, in
+// container if set, with a terminal if tty is set.
+func kubectlExec(host, container string, tty bool, argv ...string) (*exec.Cmd, error) {
+	namespace, pod, _ := kubePod(host)
+	for _, name := range []string{namespace, pod, container} {
+		if name != "" && !validKubeNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid Kubernetes name %q", name)
+		}
+	}
+	if pod == "" {
+		return nil, fmt.Errorf("host %q names no pod", host)
+	}
+	path, err := resolveKubectlPath()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	if container != "" {
+		args = append(args, "-c", container)
+	}
+	args = append(args, pod, "--")
+	return exec.Command(path, append(args, argv...)...), nil
+}
+
+// kubeCommand builds the kubectl exec process for a pod session, running
+// command or, if it is nil, sh. kubectl exec passes no environment, so TERM
+// is set with env(1) in the pod.
+func kubeCommand(host, container, term string, command []string) (*exec.Cmd, error) {
+	if command == nil {
+		command = []string{"sh"}
+	}
+	return kubectlExec(host, container, true, append([]string{"env", "TERM=" + term}, command...)...)
+}
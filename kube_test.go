@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeKubectl points MCPSSH_KUBECTL_PATH at a stand-in that drops the
+// kubectl exec options and runs the command after "--" locally.
+func fakeKubectl(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "kubectl")
+	body := "#!/bin/sh\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.KubectlPath
+	t.Cleanup(func() { config.KubectlPath = saved })
+	config.KubectlPath = script
+}
+
+func TestKubeSession(t *testing.T) {
+	fakeKubectl(t)
+	for want, args := range map[string]map[string]any{
+		"only available for k8s:<pod> hosts": {"host": "web01", "namespace": "prod", "dry_run": true},
+		"already in namespace":               {"host": "k8s:dev/web-0", "namespace": "prod", "dry_run": true},
+		"invalid Kubernetes name":            {"host": "k8s:-it", "dry_run": true},
+		"env isn't available":                {"host": "k8s:web-0", "env": map[string]any{"A": "1"}, "dry_run": true},
+		"only available for SSH sessions":    {"host": "k8s:web-0", "backing": "tmux", "dry_run": true},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": "k8s:web-0", "namespace": "prod", "container": "app", "dry_run": true})
+	if isErr || !strings.Contains(text, "exec -i -t -n prod -c app web-0 -- env TERM=xterm-256color sh") {
+		t.Errorf("Expected kubectl exec in the pod's container, got: %s", text)
+	}
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "k8s:prod/web-0", "name": "kube-test", "container": "app"}); isErr {
+		t.Fatalf("Failed to start the pod session: %s", text)
+	}
+	sess, _ := manager.Lookup("kube-test")
+	defer manager.Remove(sess.ID)
+	if sess.SSH != nil || sess.PodContainer != "app" {
+		t.Errorf("Expected a pod session with container app and no SSH options, got %+v", sess)
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "kube-test", "input": "echo term=$TERM\n", "wait_duration": "1"}); !strings.Contains(text, "term=xterm-256color") {
+		t.Errorf("Expected the shell to get TERM, got: %s", text)
+	}
+	sess.Close()
+	<-sess.exited
+	if text, isErr := callTool(restartShellHandler, map[string]any{"session_id": "kube-test"}); isErr || !strings.Contains(text, "Shell restarted") {
+		t.Errorf("Expected restart_shell to relaunch the pod shell, got: %s", text)
+	}
+	if again, _ := manager.Lookup("kube-test"); again == sess || !again.Alive() || again.PodContainer != "app" {
+		t.Errorf("Expected a live pod session in its place, got %+v", again)
+	}
+	restored := restoredSession(sessionRecord{Host: "k8s:prod/web-0", PodContainer: "app"})
+	if restored.SSH != nil || restored.PodContainer != "app" {
+		t.Errorf("Expected a restored pod session to keep its container, got %+v", restored)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// logger writes structured diagnostics to stderr. Stdout carries the MCP
+// protocol in stdio mode, so nothing else may ever be written there.
+var logger = newLogger(os.Stderr, config.LogLevel)
+
+// newLogger returns a text logger at the named level (debug, info, warn or
+// error), falling back to info for an unknown level.
+func newLogger(w io.Writer, level string) *slog.Logger {
+	var lvl slog.Level
+	invalid := lvl.UnmarshalText([]byte(level)) != nil
+	if invalid {
+		lvl = slog.LevelInfo
+	}
+	l := slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lvl}))
+	if invalid && level != "" {
+		l.Warn("unknown log level, using info", "MCPSSH_LOG_LEVEL", level)
+	}
+	return l
+}
+
+// toolLoggingMiddleware logs every tool call at debug level and failed
+// calls at warn level, with the session they targeted.
+func toolLoggingMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+
+		attrs := []any{"tool", req.Params.Name, "duration", time.Since(start)}
+		if id := req.GetString("session_id", ""); id != "" {
+			attrs = append(attrs, "session_id", id)
+		}
+		switch {
+		case err != nil:
+			logger.Warn("tool call failed", append(attrs, "err", err)...)
+		case result != nil && result.IsError:
+			logger.Warn("tool call failed", append(attrs, "err", resultText(result))...)
+		default:
+			logger.Debug("tool call", attrs...)
+		}
+		return result, err
+	}
+}
+
+// resultText joins the text content of a tool result.
+func resultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
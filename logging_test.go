@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, "warn")
+	l.Info("hidden")
+	l.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only warn-level output, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	l = newLogger(&buf, "loud")
+	if !strings.Contains(buf.String(), "unknown log level") {
+		t.Errorf("Expected a warning about the invalid level, got:\n%s", buf.String())
+	}
+	l.Info("info is the fallback")
+	if !strings.Contains(buf.String(), "info is the fallback") {
+		t.Errorf("Expected info-level output after fallback, got:\n%s", buf.String())
+	}
+}
+
+func TestToolLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	saved := logger
+	logger = newLogger(&buf, "info")
+	defer func() { logger = saved }()
+
+	handler := toolLoggingMiddleware(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError("Session not found"), nil
+	})
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "interact_session"
+	req.Params.Arguments = map[string]any{"session_id": "abc"}
+	handler(context.Background(), req)
+
+	out := buf.String()
+	for _, want := range []string{"level=WARN", "tool=interact_session", "session_id=abc", `err="Session not found"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in log line, got:\n%s", want, out)
+		}
+	}
+}
@@ -2,78 +2,751 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"maps"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/creack/pty"
-	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
 // Session represents a running SSH (or shell) process
 type Session struct {
-	ID        string
-	Cmd       *exec.Cmd
-	Ptmx      *os.File
-	CreatedAt time.Time
+	ID           string
+	name         string            // Optional human-friendly alias, unique among active sessions; set under the manager lock, guarded by bufMu
+	Tags         []string          // Free-form labels for grouping, guarded by the manager lock
+	Host         string            // Host as requested, or "local"
+	SSH          *SSHOptions       // Options the ssh command was built from; nil for local sessions
+	Term         string            // TERM advertised to the program; ssh forwards it to the remote PTY
+	Command      []string          // Program run instead of a shell, with its arguments; nil for a shell
+	PodContainer string            // Container within a k8s:<pod> host's pod; "" for its default
+	Env          map[string]string // Variables set with start_session's env; never saved or shown, as they may hold secrets
+	Cmd          *exec.Cmd
+	Ptmx         *os.File
+	CreatedAt    time.Time
 
 	// Output buffering
-	outputBuf bytes.Buffer
-	bufMu     sync.Mutex
-	done      chan struct{}
-	exited    chan struct{}
+	outputBuf     outputBuffer
+	bufMu         sync.Mutex
+	lastActive    time.Time       // Last output received or input sent, guarded by bufMu
+	lastOutput    time.Time       // Last output received, guarded by bufMu
+	throttle      *outputThrottle // Optional flood control applied by the reader, guarded by bufMu
+	writeMu       sync.Mutex      // Serializes writes so concurrent inputs don't interleave
+	writeChunk    int             // Default paste pacing: write input in chunks of this many bytes (0 = all at once)
+	writeDelay    time.Duration   // Default pause between paced chunks
+	stripANSI     bool            // Default for removing escape sequences from returned output
+	keepAlive     bool            // Exempt from the idle reaper
+	readOnly      bool            // Output may be read but nothing is sent to the session
+	autoReconnect bool            // Reconnect on the next interact_session after the connection drops
+	restoreCwd    bool            // After an automatic reconnect, cd back to the last reported directory
+	notifyOutput  bool            // Announce unread output to clients with a logging notification
+	transcript    *transcript     // Audit log of input and output; nil if disabled
+	lastUsed      atomic.Int64    // UnixNano of the last tool call referring to the session; 0 if none
+	restored      bool            // Loaded from saved state after a restart; never had a process
+	prompt        string          // Last prompt seen at the end of interact output, guarded by bufMu
+	cwd           string          // Directory the shell last reported with OSC 7, guarded by bufMu
+	rows, cols    int             // Terminal size as last set, guarded by bufMu
+	partialInput  string          // Input after the last line break sent, guarded by bufMu
+	done          chan struct{}
+	exited        chan struct{}
+
+	// Lifecycle; every close goes through a sync.Once so that Remove, the
+	// reader and concurrent handlers can race without a double-close panic
+	deadReason string // Why the session stopped; written before exited is closed
+	stopOnce   sync.Once
+	exitOnce   sync.Once
+	reapOnce   sync.Once
+	exitCode   *int // Set once the process is reaped, guarded by bufMu
+
+	native *nativeConn // Built-in SSH client connection; nil when Cmd runs in a PTY
+	telnet *telnetConn // Telnet connection of a telnet:<host> session
 }
 
 // SessionManager manages multiple sessions
 type SessionManager struct {
 	sessions map[string]*Session
+	names    map[string]string // Session name to ID, so name lookups don't scan
 	mu       sync.RWMutex
+	seq      int // Last number handed out by the sequential ID scheme
 }
 
 var manager = &SessionManager{
 	sessions: make(map[string]*Session),
 }
 
+// Config holds server-wide settings, read from MCPSSH_* environment variables.
+type Config struct {
+	ControlMaster    bool          // Share one SSH connection per host across sessions
+	ControlPersist   string        // How long an idle master connection is kept open
+	ReadBufferSize   int           // Initial PTY read chunk size in bytes
+	SSHPath          string        // ssh binary, resolved via PATH if not absolute
+	SSHConfigFile    string        // Explicit ssh config (-F); empty uses ~/.ssh/config
+	DockerPath       string        // docker binary for docker:<container> sessions
+	KubectlPath      string        // kubectl binary for k8s:<pod> sessions
+	AliveInterval    int           // Default seconds between SSH keepalive probes; 0 leaves it to ssh_config
+	AliveCountMax    int           // Default unanswered keepalive probes before disconnecting; 0 for ssh's 3
+	MaxOutputBytes   int           // Default cap on output returned per interaction; 0 disables
+	MaxBufferBytes   int           // Unread output kept per session before the oldest is dropped; 0 disables
+	IDScheme         string        // How session IDs are generated: uuid, sequential or host
+	MaxWait          time.Duration // Upper bound on wait_duration and command_timeout
+	LogLevel         string        // Minimum level logged to stderr: debug, info, warn or error
+	AllowedHosts     []string      // Glob patterns of permitted remote hosts; empty permits all
+	AllowLocal       bool          // Whether host=local shell sessions may be started
+	DenyPatterns     string        // Regular expression of input that must never be sent
+	DenylistFile     string        // File of further deny patterns, one per line
+	PolicyFile       string        // YAML file of allow/deny/confirm rules for input
+	ReadOnly         bool          // Every session is read-only: output can be watched, nothing typed
+	Backing          string        // Default start_session backing: tmux, screen or none
+	MaxInputFile     int           // Largest input_file interact_session will send, in bytes
+	StateFile        string        // JSON file persisting session metadata across restarts; empty disables
+	SSHTransport     string        // Default transport for SSH sessions: exec or native
+	MaxDownload      int           // Largest file download_file returns inline, in bytes
+	HostKeyPolicy    string        // Default host key verification: strict, accept-new or off
+	IdleTimeout      time.Duration // Close sessions unused for this long; 0 disables
+	ConfigFile       string        // Config file the settings were read from, if any
+	TranscriptDir    string        // Directory session transcripts are written to; empty disables
+	TranscriptFormat string        // Transcript file format: text or asciicast
+	AuditFile        string        // JSON lines file recording every tool call; empty disables
+	MaxSessions      int           // Most live sessions at once; 0 means unlimited
+	EvictIdle        bool          // At MaxSessions, close the least recently used session instead of refusing
+	NotifyOutput     bool          // Default for start_session's notify_output
+	DefaultWait      time.Duration // wait_duration used when a call doesn't give one
+	LogFile          string        // File logs are appended to instead of stderr
+	Serve            string        // How MCP is served: stdio, http or sse
+	Listen           string        // Address the HTTP transports listen on
+	AuthToken        string        // Bearer token HTTP clients must present; empty requires none
+	AuthTokenFile    string        // File holding the bearer token, instead of AuthToken
+	TLSCert          string        // Certificate the HTTP transports serve TLS with
+	TLSKey           string        // Private key of TLSCert
+	TLSClientCA      string        // CA bundle client certificates must be signed by (mutual TLS)
+}
+
+var config = loadConfig()
+
+func loadConfig() Config {
+	cfg := Config{
+		ControlPersist:   "10m",
+		ReadBufferSize:   32 * 1024,
+		SSHPath:          "ssh",
+		DockerPath:       "docker",
+		KubectlPath:      "kubectl",
+		MaxOutputBytes:   64 * 1024,
+		MaxBufferBytes:   8 << 20,
+		IDScheme:         IDSchemeUUID,
+		MaxWait:          300 * time.Second,
+		LogLevel:         "info",
+		AllowLocal:       true,
+		MaxInputFile:     1 << 20,
+		SSHTransport:     TransportExec,
+		MaxDownload:      1 << 20,
+		HostKeyPolicy:    HostKeyAcceptNew,
+		DefaultWait:      500 * time.Millisecond,
+		TranscriptFormat: TranscriptText,
+		Serve:            ServeStdio,
+		Listen:           "127.0.0.1:8080",
+	}
+	// The environment overrides the config file
+	configErr = loadConfigFile(&cfg)
+	cfg.ControlMaster = envBool("MCPSSH_CONTROL_MASTER", cfg.ControlMaster)
+	cfg.ReadBufferSize = envInt("MCPSSH_READ_BUFFER_SIZE", cfg.ReadBufferSize)
+	cfg.MaxWait = time.Duration(envInt("MCPSSH_MAX_WAIT", int(cfg.MaxWait/time.Second))) * time.Second
+	cfg.IdleTimeout = time.Duration(envInt("MCPSSH_IDLE_TIMEOUT", int(cfg.IdleTimeout/time.Second))) * time.Second
+	cfg.AliveInterval = envInt("MCPSSH_SERVER_ALIVE_INTERVAL", cfg.AliveInterval)
+	cfg.AliveCountMax = envInt("MCPSSH_SERVER_ALIVE_COUNT_MAX", cfg.AliveCountMax)
+	if v, err := strconv.Atoi(os.Getenv("MCPSSH_MAX_OUTPUT_BYTES")); err == nil && v >= 0 {
+		cfg.MaxOutputBytes = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MCPSSH_MAX_BUFFER_BYTES")); err == nil && v >= 0 {
+		cfg.MaxBufferBytes = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MCPSSH_MAX_SESSIONS")); err == nil && v >= 0 {
+		cfg.MaxSessions = v
+	}
+	cfg.EvictIdle = envBool("MCPSSH_EVICT_IDLE", cfg.EvictIdle)
+	cfg.NotifyOutput = envBool("MCPSSH_NOTIFY_OUTPUT", cfg.NotifyOutput)
+	if d := parseSeconds(os.Getenv("MCPSSH_DEFAULT_WAIT"), -1); d >= 0 {
+		cfg.DefaultWait = d
+	}
+	if v := os.Getenv("MCPSSH_LOG_FILE"); v != "" {
+		cfg.LogFile = v
+	}
+	if v := os.Getenv("MCPSSH_TRANSCRIPT_DIR"); v != "" {
+		cfg.TranscriptDir = v
+	}
+	if v := os.Getenv("MCPSSH_TRANSCRIPT_FORMAT"); v != "" {
+		cfg.TranscriptFormat = v
+	}
+	if v := os.Getenv("MCPSSH_AUDIT_FILE"); v != "" {
+		cfg.AuditFile = v
+	}
+	if v := os.Getenv("MCPSSH_SERVE"); v != "" {
+		cfg.Serve = v
+	}
+	if v := os.Getenv("MCPSSH_LISTEN"); v != "" {
+		cfg.Listen = v
+	}
+	if v := os.Getenv("MCPSSH_AUTH_TOKEN"); v != "" {
+		cfg.AuthToken = v
+	}
+	if v := os.Getenv("MCPSSH_AUTH_TOKEN_FILE"); v != "" {
+		cfg.AuthTokenFile = v
+	}
+	if v := os.Getenv("MCPSSH_TLS_CERT"); v != "" {
+		cfg.TLSCert = v
+	}
+	if v := os.Getenv("MCPSSH_TLS_KEY"); v != "" {
+		cfg.TLSKey = v
+	}
+	if v := os.Getenv("MCPSSH_TLS_CLIENT_CA"); v != "" {
+		cfg.TLSClientCA = v
+	}
+	if v := os.Getenv("MCPSSH_CONTROL_PERSIST"); v != "" {
+		cfg.ControlPersist = v
+	}
+	if v := os.Getenv("MCPSSH_SSH_PATH"); v != "" {
+		cfg.SSHPath = v
+	}
+	if v := os.Getenv("MCPSSH_DOCKER_PATH"); v != "" {
+		cfg.DockerPath = v
+	}
+	if v := os.Getenv("MCPSSH_KUBECTL_PATH"); v != "" {
+		cfg.KubectlPath = v
+	}
+	if v := os.Getenv("MCPSSH_SSH_CONFIG"); v != "" {
+		cfg.SSHConfigFile = v
+	}
+	if v := os.Getenv("MCPSSH_ID_SCHEME"); v != "" {
+		cfg.IDScheme = v
+	}
+	if v := os.Getenv("MCPSSH_LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+	if v := os.Getenv("MCPSSH_ALLOWED_HOSTS"); v != "" {
+		cfg.AllowedHosts = splitList(v)
+	}
+	cfg.AllowLocal = envBool("MCPSSH_ALLOW_LOCAL", cfg.AllowLocal)
+	if envBool("MCPSSH_DISABLE_LOCAL", false) {
+		cfg.AllowLocal = false // Production mode: run purely as an SSH gateway
+	}
+	if v := os.Getenv("MCPSSH_DENY_PATTERNS"); v != "" {
+		cfg.DenyPatterns = v
+	}
+	if v := os.Getenv("MCPSSH_DENYLIST_FILE"); v != "" {
+		cfg.DenylistFile = v
+	}
+	if v := os.Getenv("MCPSSH_POLICY_FILE"); v != "" {
+		cfg.PolicyFile = v
+	}
+	cfg.ReadOnly = envBool("MCPSSH_READ_ONLY", cfg.ReadOnly)
+	if v := os.Getenv("MCPSSH_BACKING"); v != "" {
+		cfg.Backing = v
+	}
+	cfg.MaxInputFile = envInt("MCPSSH_MAX_INPUT_FILE_BYTES", cfg.MaxInputFile)
+	if v := os.Getenv("MCPSSH_STATE_FILE"); v != "" {
+		cfg.StateFile = v
+	}
+	cfg.MaxDownload = envInt("MCPSSH_MAX_DOWNLOAD_BYTES", cfg.MaxDownload)
+	if v := os.Getenv("MCPSSH_HOST_KEY_POLICY"); v != "" {
+		cfg.HostKeyPolicy = v
+	}
+	if v := os.Getenv("MCPSSH_SSH_TRANSPORT"); v != "" {
+		cfg.SSHTransport = v
+	}
+	return cfg
+}
+
+// envInt parses a positive integer environment variable, returning def if unset or invalid.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// envBool parses a boolean environment variable, returning def if unset or invalid.
+func envBool(name string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// formatOption is shared by tools that can return either prose or JSON.
+var formatOption = mcp.WithString("format",
+	mcp.Description("Result format: 'text' (default) or 'json' for a structured payload."),
+	mcp.Enum("text", "json"),
+)
+
+// binaryEncodingOption is shared by tools returning terminal output, which
+// may not be text.
+var binaryEncodingOption = mcp.WithString("binary_encoding",
+	mcp.Description("How output that isn't text (invalid UTF-8 or NUL bytes, e.g. from 'cat' of a binary file) is returned: 'base64' (default), 'hex', or 'none' to return it as is, with invalid bytes replaced. Encoded output is marked and reported as 'encoding' in JSON; max_output_bytes applies before encoding."),
+	mcp.Enum(EncodingBase64, EncodingHex, EncodingNone),
+)
+
 func main() {
-	s := server.NewMCPServer("SSH-Session-Manager", "2.0.0")
+	env := config
+	var err error
+	if config, err = parseFlags(config, os.Args[1:], os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if config.LogFile != "" {
+		f, err := os.OpenFile(config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			logger.Error("cannot open log file", "path", config.LogFile, "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logger = newLogger(f, config.LogLevel)
+	} else if config.LogLevel != env.LogLevel {
+		logger = newLogger(os.Stderr, config.LogLevel)
+	}
+	state = newStateStore(config.StateFile)
+
+	// A safety control that silently fails to load is worse than none
+	if configErr != nil {
+		logger.Error("invalid config file", "err", configErr)
+		os.Exit(1)
+	}
+	if config.ConfigFile != "" {
+		logger.Info("loaded config file", "path", config.ConfigFile)
+	}
+	if !validTranscriptFormat(config.TranscriptFormat) {
+		logger.Error("invalid transcript format", "format", config.TranscriptFormat)
+		os.Exit(1)
+	}
+	if !validBacking(config.Backing) {
+		logger.Error("invalid backing", "backing", config.Backing)
+		os.Exit(1)
+	}
+	if !validIDScheme(config.IDScheme) {
+		logger.Error("invalid ID scheme", "id_scheme", config.IDScheme)
+		os.Exit(1)
+	}
+	if config.AuditFile != "" {
+		// Compliance may depend on it, so don't run without it
+		if audit, err = openAuditLog(config.AuditFile); err != nil {
+			logger.Error("cannot open audit log", "path", config.AuditFile, "err", err)
+			os.Exit(1)
+		}
+	}
+	if denylist, err = loadDenylist(config.DenyPatterns, config.DenylistFile); err != nil {
+		logger.Error("invalid command denylist", "err", err)
+		os.Exit(1)
+	}
+	if policy, err = loadPolicy(config.PolicyFile); err != nil {
+		logger.Error("invalid command policy", "err", err)
+		os.Exit(1)
+	}
+	if n, err := state.Restore(manager); err != nil {
+		logger.Warn("failed to restore session state", "err", err)
+	} else if n > 0 {
+		logger.Info("restored sessions from saved state; reconnect_session revives them", "count", n)
+	}
+	if config.IdleTimeout > 0 {
+		startIdleReaper(config.IdleTimeout)
+	}
+
+	err = serve(newServer())
+	if err != nil {
+		logger.Error("server error", "err", err)
+	}
+	shutdown()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// newServer returns the MCP server with every tool registered.
+func newServer() *server.MCPServer {
+	resources := newResourceWatcher()
+	s := server.NewMCPServer("SSH-Session-Manager", "2.0.0",
+		server.WithResourceCapabilities(false, true),
+		server.WithLogging(), // Output notifications
+		server.WithHooks(resources.hooks()),
+		server.WithToolHandlerMiddleware(toolMetricsMiddleware),
+		server.WithToolHandlerMiddleware(toolLoggingMiddleware),
+		server.WithToolHandlerMiddleware(auditMiddleware),
+		server.WithElicitation(), // Policy confirmations
+	)
 
 	// Tool: Start Session
 	s.AddTool(mcp.NewTool("start_session",
 		mcp.WithDescription("Start a new SSH session (or shell command). Returns a session_id. Provide the SSH host alias or destination directly."),
-		mcp.WithString("host", mcp.Required(), mcp.Description("SSH host alias (e.g. from ~/.ssh/config) or valid SSH destination. Use 'local' to run a local shell.")),
+		mcp.WithString("host", mcp.Required(), mcp.Description("SSH host alias (e.g. from ~/.ssh/config) or valid SSH destination. Use 'local' to run a local shell, or 'docker:<container>' for a shell in a running container (docker exec), or 'k8s:<pod>' (or 'k8s:<namespace>/<pod>') for one in a Kubernetes pod (kubectl exec), or 'serial:<device>[?baud=<rate>]' (e.g. 'serial:/dev/ttyUSB0?baud=9600') for a serial console (default baud 115200), or 'telnet:<host>[:<port>]' for a telnet-only device (default port 23).")),
+		mcp.WithString("namespace", mcp.Description("Namespace of a k8s:<pod> host's pod. Default: kubectl's current namespace.")),
+		mcp.WithString("container", mcp.Description("Container within a k8s:<pod> host's pod, for pods running more than one. Default: the pod's default container.")),
+		mcp.WithString("name", mcp.Description("Optional human-friendly name for the session (e.g. 'prod-db'). Must be unique; can be used in place of the session_id.")),
+		mcp.WithArray("tags", mcp.WithStringItems(), mcp.Description("Optional tags for grouping sessions (e.g. ['web', 'prod']).")),
+		mcp.WithString("user", mcp.Description("Remote user name. Ignored if host already contains user@.")),
+		mcp.WithNumber("port", mcp.Description("Remote SSH port. Defaults to the ssh config / port 22.")),
+		mcp.WithString("prompt_regex", mcp.Description("Consider the session ready as soon as the output matches this regular expression (e.g. '\\$ $'). Useful for slow MFA or banner logins.")),
+		mcp.WithString("ready_quiet", mcp.Description("Consider the session ready once output has been quiet this long (in seconds). Default 0.3s. Ignored when prompt_regex is set.")),
+		mcp.WithString("ready_timeout", mcp.Description("Upper bound on waiting for readiness (in seconds). Default 10s.")),
+		mcp.WithString("initial_wait", mcp.Description("Instead of waiting for readiness, wait exactly this long (in seconds) before returning the initial output.")),
+		mcp.WithString("output_filter", mcp.Description("Flood control for streaming output: 'none' (default), 'coalesce' to collapse runs of identical lines, or 'rate' to drop lines above max_lines_per_sec with an '[N lines omitted]' summary."), mcp.Enum(FilterNone, FilterCoalesce, FilterRate)),
+		mcp.WithNumber("max_lines_per_sec", mcp.Description("Line rate limit for output_filter=rate. Default 200.")),
+		mcp.WithNumber("retries", mcp.Description("Retry a connection that fails immediately with a transient error (connection refused, timed out, name resolution failure) up to this many times. Authentication and host key failures are never retried. Default 0.")),
+		mcp.WithString("retry_delay", mcp.Description("Delay between connection attempts (in seconds). Default 2s.")),
+		mcp.WithNumber("write_chunk_size", mcp.Description("Default paste pacing for interact_session on this session: write input in chunks of this many bytes. Default 0 (write all at once).")),
+		mcp.WithString("write_chunk_delay", mcp.Description("Default pause between paced chunks (in seconds). Default 0.01s.")),
+		mcp.WithBoolean("dry_run", mcp.Description("Only build and return the command that would be run; no session is started.")),
+		mcp.WithString("command", mcp.Description("Program to run in the terminal instead of a shell, e.g. 'python3', 'psql' or 'gdb'. Locally it is looked up in PATH; over SSH it runs on the host. The session ends when the program exits.")),
+		mcp.WithArray("args", mcp.WithStringItems(), mcp.Description("Arguments for command, e.g. [\"-i\"]. Each is passed as one argument; over SSH they are quoted for the remote shell.")),
+		mcp.WithString("cwd", mcp.Description("Directory a local shell starts in, e.g. the project directory; a leading ~/ is expanded. Default: the server's working directory. Local sessions only.")),
+		mcp.WithObject("env", mcp.Description("Environment variables to set in the shell, as names to string values, e.g. {\"LANG\": \"C.UTF-8\"}. Local shells get them all; over SSH they are passed with SendEnv, and the server only sets those its AcceptEnv allows. Values are never saved or shown, so they can hold tokens."), mcp.AdditionalProperties(map[string]any{"type": "string"})),
+		mcp.WithString("term", mcp.Description("Terminal type (TERM) for the session; ssh forwards it to the remote shell. Default 'xterm-256color'. Use e.g. 'dumb' to discourage colors and cursor movement.")),
+		mcp.WithBoolean("strip_ansi", mcp.Description("Remove colors, cursor movement and other terminal escape sequences from output returned by interact_session, run_command and tail_session. Default false; can be overridden per call.")),
+		mcp.WithBoolean("keep_alive", mcp.Description("Exempt the session from the idle timeout (MCPSSH_IDLE_TIMEOUT), e.g. for a long-running job checked on rarely.")),
+		mcp.WithBoolean("notify_output", mcp.Description("Send the client a logging notification when output arrives that no tool call has read, e.g. a background job finishing, so it needn't poll with empty interact_session calls. Default from MCPSSH_NOTIFY_OUTPUT, normally off.")),
+		mcp.WithBoolean("auto_reconnect", mcp.Description("If the SSH connection drops (rather than the shell exiting), reconnect under the same session ID on the next interact_session, marking the break in its output, instead of reporting the session exited. SSH sessions only.")),
+		mcp.WithBoolean("restore_cwd", mcp.Description("With auto_reconnect, cd back to the directory the shell last reported after reconnecting. Needs a shell that reports its directory with OSC 7 at each prompt, as many do.")),
+		mcp.WithBoolean("read_only", mcp.Description("Observation mode: output can be read, but input, signals, run_command, expect sends and uploads are rejected. For watching logs or consoles, e.g. a host alias whose ssh_config RemoteCommand runs 'journalctl -f'. Always on if the server runs with --read-only.")),
+		mcp.WithNumber("rows", mcp.Description("Terminal height in lines. Default 24. Can be changed later with resize_session.")),
+		mcp.WithNumber("cols", mcp.Description("Terminal width in columns. Default 80; raise it for wide tables and full-screen programs.")),
+		mcp.WithString("backing", mcp.Description("Run the remote shell inside 'tmux' or 'screen' on the host, so it keeps running if the connection drops or the server restarts; reconnect_session (or start_session with reattach) attaches to it again. close_session ends it. Default from MCPSSH_BACKING, normally none."), mcp.Enum(BackingTmux, BackingScreen)),
+		mcp.WithString("reattach", mcp.Description("Name of a tmux (or, with backing 'screen', screen) session on the host to attach to, e.g. one left running by an earlier server. Implies backing 'tmux' unless given. A session of that name is started if there is none.")),
+		mcp.WithString("pty_mode", mcp.Description("Remote PTY allocation: 'force' (default, ssh -tt) for interactive shells, 'request' (-t), or 'disable' (-T) for echo-free scripted output."), mcp.Enum(PTYForce, PTYRequest, PTYDisable)),
+		mcp.WithString("password", mcp.Description("Password for hosts that require password (or keyboard-interactive) authentication. Uses the native transport, so the password is sent by the built-in client and never typed into the PTY; it is kept in memory for reconnect_session only.")),
+		mcp.WithArray("jump_hosts", mcp.WithStringItems(), mcp.Description("Bastion hosts to connect through, in order, each as [user@]host[:port] (ssh -J). Each must be permitted by MCPSSH_ALLOWED_HOSTS.")),
+		mcp.WithNumber("server_alive_interval", mcp.Description("Seconds between keepalive probes over the SSH connection (ServerAliveInterval), so an idle session through a NAT or firewall isn't silently dropped between turns, and a dead link ends the session instead of hanging it. Default from MCPSSH_SERVER_ALIVE_INTERVAL, normally unset (ssh_config decides). SSH sessions only.")),
+		mcp.WithNumber("server_alive_count_max", mcp.Description("Unanswered keepalive probes before the connection is dropped (ServerAliveCountMax). Default from MCPSSH_SERVER_ALIVE_COUNT_MAX, normally ssh's 3.")),
+		mcp.WithString("host_key_policy", mcp.Description("Host key verification: 'strict' (host must already be in known_hosts), 'accept-new' (record unknown hosts, refuse changed keys) or 'off'. Default from MCPSSH_HOST_KEY_POLICY, normally 'accept-new'. Newly accepted keys are reported with their fingerprint."), mcp.Enum(HostKeyStrict, HostKeyAcceptNew, HostKeyOff)),
+		mcp.WithString("identity_file", mcp.Description("Private key file to authenticate with (ssh -i, with IdentitiesOnly), instead of the keys from ssh_config and the agent. A leading ~/ is expanded.")),
+		mcp.WithString("passphrase", mcp.Description("Passphrase of an encrypted identity_file. Uses the native transport, since the ssh binary would prompt for it; kept in memory for reconnect_session only.")),
+		mcp.WithString("transport", mcp.Description("How to connect: 'exec' runs the local ssh binary (honouring ~/.ssh/config), 'native' uses the built-in SSH client (ssh-agent and default keys, no ssh binary or ssh_config needed). Default from MCPSSH_SSH_TRANSPORT, normally 'exec'."), mcp.Enum(TransportExec, TransportNative)),
+		formatOption,
 	), startSessionHandler)
 
 	// Tool: Interact Session
 	s.AddTool(mcp.NewTool("interact_session",
 		mcp.WithDescription("Write input to the session and/or read pending output."),
-		mcp.WithString("session_id", mcp.Required()),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
 		mcp.WithString("input", mcp.Description("Command or text to send to the terminal (e.g. 'ls -la\n'). Optional.")),
-		mcp.WithString("wait_duration", mcp.Description("Time to wait for output after sending input (in seconds). Default 0.5s. Set higher for slow commands.")),
+		mcp.WithString("input_file", mcp.Description("Path of a file on the server whose contents are sent as the input, e.g. a prepared script. Use instead of input; capped at 1 MiB by default. Consider write_chunk_size for large files.")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for output after sending input (in seconds). Default 0.5s unless the server sets --default-wait. Set higher for slow commands; capped at 300s by default. 0 returns immediately with whatever is already buffered (fire and forget, or polling on your own schedule).")),
+		mcp.WithNumber("max_output_bytes", mcp.Description("Return at most this many bytes of output, keeping the most recent. Defaults to the server limit (64 KiB); 0 means unlimited.")),
+		mcp.WithBoolean("line_mode", mcp.Description("Only return complete lines; a trailing partial line stays buffered for the next read. Note that prompts without a newline are held back too.")),
+		mcp.WithBoolean("wait_for_prompt", mcp.Description("Once a command is entered (input ending in a newline), return as soon as the session's prompt comes back instead of waiting the full wait_duration, which stays the upper bound (default true). Needs the prompt to be known: it is learned from the output after login and after each command, and matched by its shape, so a prompt showing the working directory or git branch still counts.")),
+		mcp.WithNumber("since_offset", mcp.Description("Read the output from this offset on instead of the unread output, without clearing anything: 0 for everything still kept, or the next_offset of an earlier read to resume. Readers using offsets don't take output from each other and can re-read after a lost response. Not combinable with expect or command_timeout.")),
+		mcp.WithBoolean("clear", mcp.Description("Clear the output returned from the buffer (default true). false peeks: the output stays buffered and is returned again by the next read, e.g. to retry after a lost response. Not combinable with expect or command_timeout.")),
+		mcp.WithBoolean("strip_echo", mcp.Description("Remove the terminal's echo of the input from the start of the output, so the command doesn't appear twice.")),
+		mcp.WithString("sudo_password", mcp.Description("If a '[sudo] password' prompt appears while waiting, type this password once. It is never echoed back in the result.")),
+		mcp.WithBoolean("send_eof", mcp.Description("Send EOF (Ctrl+D) after the input, e.g. to finish 'cat > file' or leave a REPL. EOF only takes effect at the start of a line, so end input with a newline.")),
+		mcp.WithNumber("write_chunk_size", mcp.Description("Paste pacing: write the input in chunks of this many bytes with a pause in between, for slow or flaky links that drop characters on large pastes. Defaults to the session's setting; 0 writes everything at once.")),
+		mcp.WithString("write_chunk_delay", mcp.Description("Pause between paced chunks (in seconds). Defaults to the session's setting, or 0.01s.")),
+		mcp.WithString("anchor", mcp.Description("Prepend an anchor so it's clear where this interaction's output starts: 'prompt' repeats the prompt the input was typed at (as a terminal shows it; falls back to a separator until a prompt has been seen), 'separator' adds a marker line. Default 'none'."), mcp.Enum(AnchorNone, AnchorPrompt, AnchorSeparator)),
+		mcp.WithString("command_timeout", mcp.Description("Instead of waiting a fixed wait_duration, wait up to this long (in seconds) for the command to finish, i.e. for prompt_regex to match. If it doesn't, Ctrl+C is sent to interrupt it and the partial output is returned marked as timed out.")),
+		mcp.WithString("prompt_regex", mcp.Description("Regular expression marking command completion for command_timeout. Defaults to a shell prompt ending in '$', '#', '%' or '>'.")),
+		mcp.WithBoolean("strip_ansi", mcp.Description("Remove terminal escape sequences (colors, cursor movement) from the output. Defaults to the session's setting.")),
+		mcp.WithString("expect", mcp.Description("Instead of waiting a fixed wait_duration, return as soon as the output contains this text. wait_duration becomes the upper bound (default 10s); if the text doesn't appear in time, the output so far is returned marked as not matched. Nothing is interrupted.")),
+		mcp.WithString("expect_regex", mcp.Description("Like expect, but a regular expression.")),
+		binaryEncodingOption,
+		formatOption,
 	), interactSessionHandler)
 
+	// Tool: Send Signal
+	s.AddTool(mcp.NewTool("send_signal",
+		mcp.WithDescription("Send a signal to the command running in the foreground of a session, e.g. to stop a runaway 'tail -f' without killing the session. For SSH sessions the signal is typed as its control character, so only INT (Ctrl+C), QUIT (Ctrl+\\) and TSTP (Ctrl+Z) are available; local sessions also accept TERM, KILL and HUP."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("signal", mcp.Description("Signal to send. Default INT."), mcp.Enum("INT", "QUIT", "TSTP", "TERM", "KILL", "HUP")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for output after signalling, e.g. the returning prompt (in seconds). Default 0.5s.")),
+	), sendSignalHandler)
+
+	// Tool: Run Command
+	s.AddTool(mcp.NewTool("run_command",
+		mcp.WithDescription("Run a shell command in a session, wait for it to finish and return its output and exit code. Requires a POSIX shell (sh, bash, zsh...) at the prompt; for REPLs or interactive programs use interact_session. Output buffered before the call is discarded."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("command", mcp.Required(), mcp.Description("Command line to run, e.g. 'systemctl restart nginx'. Must be a complete command (no trailing '&' or comment).")),
+		mcp.WithString("timeout", mcp.Description("Seconds to wait for the command to finish. Default 30. A command still running then is interrupted with Ctrl+C and reported as timed out, without an exit code.")),
+		mcp.WithNumber("max_output_bytes", mcp.Description("Return at most this many bytes of output, keeping the most recent. Defaults to the server limit (64 KiB); 0 means unlimited.")),
+		mcp.WithBoolean("strip_ansi", mcp.Description("Remove terminal escape sequences (colors, cursor movement) from the output. Defaults to the session's setting.")),
+		binaryEncodingOption,
+		formatOption,
+	), runCommandHandler)
+
+	// Tool: Tail Session
+	s.AddTool(mcp.NewTool("tail_session",
+		mcp.WithDescription("Return the last N complete lines of a session's buffered output without consuming it."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithNumber("lines", mcp.Description("Number of lines to return. Default 20.")),
+		mcp.WithBoolean("strip_ansi", mcp.Description("Remove terminal escape sequences (colors, cursor movement) from the output. Defaults to the session's setting.")),
+	), tailSessionHandler)
+
+	// Tool: Get History
+	s.AddTool(mcp.NewTool("get_history",
+		mcp.WithDescription("Search or page back through everything a session printed, including output already read, e.g. to find an error message that scrolled by. Returns complete lines from the session's output log, which keeps the most recent output up to the server's buffer limit."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithNumber("last_n_lines", mcp.Description("Return at most this many lines, the most recent (after grep). Default 100.")),
+		mcp.WithString("grep", mcp.Description("Only return lines matching this regular expression (RE2 syntax), e.g. '(?i)error'.")),
+		mcp.WithBoolean("strip_ansi", mcp.Description("Remove terminal escape sequences (colors, cursor movement) before matching and returning lines. Defaults to the session's setting.")),
+	), getHistoryHandler)
+
+	// Tool: Restart Shell
+	s.AddTool(mcp.NewTool("restart_shell",
+		mcp.WithDescription("Relaunch the shell of a 'local', 'docker:', 'k8s:', 'serial:' or 'telnet:' session in a fresh terminal, keeping its session ID, name and tags. Use after the shell exited (e.g. an accidental 'exit'); a running shell is killed first."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for the new shell's prompt (in seconds). Default 0.5s.")),
+	), restartShellHandler)
+
+	// Tool: Reconnect Session
+	s.AddTool(mcp.NewTool("reconnect_session",
+		mcp.WithDescription("Revive a dead session under the same session ID, name and tags by relaunching its ssh connection (or local shell) with the original options. Sessions restored from saved state after a server restart must be reconnected before use."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for the login output (in seconds). Default 0.5s.")),
+	), reconnectSessionHandler)
+
+	// Tool: List Sessions
+	s.AddTool(mcp.NewTool("list_sessions",
+		mcp.WithDescription("List the open sessions with their host, creation and last activity times and whether they are still alive. Use this to recover a lost session ID."),
+		mcp.WithString("tag", mcp.Description("Only list sessions carrying this tag.")),
+		formatOption,
+	), listSessionsHandler)
+
+	// Tool: Upload File
+	s.AddTool(mcp.NewTool("upload_file",
+		mcp.WithDescription("Copy a file to the host of a session over a separate channel, not through the terminal, so binary content arrives intact. Prefer this over pasting files with heredocs."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("remote_path", mcp.Required(), mcp.Description("Destination path on the session's host; relative paths are relative to the login directory. Overwritten if it exists.")),
+		mcp.WithString("local_path", mcp.Description("File on the server to upload. Unavailable when local sessions are disabled.")),
+		mcp.WithString("content_base64", mcp.Description("Inline file content, base64-encoded, instead of local_path.")),
+		mcp.WithString("mode", mcp.Description("Octal permissions to set on the uploaded file, e.g. '0755' for a script.")),
+	), uploadFileHandler)
+
+	// Tool: Download File
+	s.AddTool(mcp.NewTool("download_file",
+		mcp.WithDescription("Fetch a file from the host of a session over a separate channel, not through the terminal. Returns the content (text as is, binary as base64) or saves it to local_path."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("remote_path", mcp.Required(), mcp.Description("File on the session's host; relative paths are relative to the login directory.")),
+		mcp.WithString("local_path", mcp.Description("Save the file here on the server instead of returning it; no size limit. Unavailable when local sessions are disabled.")),
+		formatOption,
+	), downloadFileHandler)
+
+	// Tool: Forward Port
+	s.AddTool(mcp.NewTool("forward_port",
+		mcp.WithDescription("Open a local port forward (like ssh -L) through a session: connections to the returned port on 127.0.0.1 reach remote_host:remote_port as seen from the session's host, e.g. a database or web UI behind it. It lasts until close_forward or until the session is closed."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("SSH session ID or name.")),
+		mcp.WithNumber("remote_port", mcp.Required(), mcp.Description("Port to reach, e.g. 5432.")),
+		mcp.WithString("remote_host", mcp.Description("Host to reach, resolved on the session's host. Default 'localhost', the host itself.")),
+		mcp.WithNumber("local_port", mcp.Description("Local port to listen on. Default 0 picks a free one, which is returned.")),
+		formatOption,
+	), forwardPortHandler)
+
+	// Tool: Reverse Forward Port
+	s.AddTool(mcp.NewTool("reverse_forward_port",
+		mcp.WithDescription("Open a remote port forward (like ssh -R) through a session: connections to remote_port on the loopback interface of the session's host reach local_host:local_port as seen from this machine, e.g. to expose a local dev server or package mirror to the remote host. It lasts until close_forward or until the session is closed. Unavailable when local sessions are disabled."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("SSH session ID or name.")),
+		mcp.WithNumber("local_port", mcp.Required(), mcp.Description("Port to reach on this side, e.g. 3000.")),
+		mcp.WithString("local_host", mcp.Description("Host to reach, resolved on this machine. Default 'localhost'.")),
+		mcp.WithNumber("remote_port", mcp.Description("Port to listen on, on the session's host. Default 0 lets the remote host pick a free one, which is returned.")),
+		formatOption,
+	), reverseForwardHandler)
+
+	// Tool: Start SOCKS Proxy
+	s.AddTool(mcp.NewTool("start_socks_proxy",
+		mcp.WithDescription("Start a SOCKS5 proxy (like ssh -D) through a session on 127.0.0.1: each connection made through it reaches the host:port it asks for as seen from the session's host, so local tools (curl --proxy socks5h://..., browsers, database clients) can use the remote network. Returns the port; it lasts until close_forward or until the session is closed."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("SSH session ID or name.")),
+		mcp.WithNumber("local_port", mcp.Description("Local port to listen on. Default 0 picks a free one, which is returned.")),
+		formatOption,
+	), startSOCKSProxyHandler)
+
+	// Tool: List Forwards
+	s.AddTool(mcp.NewTool("list_forwards",
+		mcp.WithDescription("List the open port forwards and SOCKS proxies, with their ports, targets and connection counts."),
+		mcp.WithString("session_id", mcp.Description("Only list the forwards of this session.")),
+		formatOption,
+	), listForwardsHandler)
+
+	// Tool: Close Forward
+	s.AddTool(mcp.NewTool("close_forward",
+		mcp.WithDescription("Close a port forward or SOCKS proxy and the connections through it; the session stays open."),
+		mcp.WithString("forward_id", mcp.Required(), mcp.Description("Forward ID, as returned by forward_port, reverse_forward_port or start_socks_proxy.")),
+	), closeForwardHandler)
+
+	// Tool: Resize Session
+	s.AddTool(mcp.NewTool("resize_session",
+		mcp.WithDescription("Change the terminal size of a session. The running program is notified (SIGWINCH) and full-screen programs redraw to fit."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithNumber("rows", mcp.Description("Terminal height in lines. Defaults to the current height.")),
+		mcp.WithNumber("cols", mcp.Description("Terminal width in columns. Defaults to the current width.")),
+	), resizeSessionHandler)
+
 	// Tool: Close Session
 	s.AddTool(mcp.NewTool("close_session",
 		mcp.WithDescription("Terminate a session."),
-		mcp.WithString("session_id", mcp.Required()),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithBoolean("keep_backing", mcp.Description("For sessions with a tmux or screen backing, leave it running on the host so start_session with reattach can pick it up later. By default it is ended too.")),
 	), closeSessionHandler)
 
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
-	}
+	// Tool: Rename Session
+	s.AddTool(mcp.NewTool("rename_session",
+		mcp.WithDescription("Set or change the human-friendly name of a session. Pass an empty name to clear it."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or current name.")),
+		mcp.WithString("name", mcp.Description("New unique name for the session.")),
+	), renameSessionHandler)
+
+	// Tool: Check Session
+	s.AddTool(mcp.NewTool("check_session",
+		mcp.WithDescription("Check whether a session is still alive without sending input or consuming its buffered output."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		formatOption,
+	), checkSessionHandler)
+
+	// Tool: Clear Buffer
+	s.AddTool(mcp.NewTool("clear_buffer",
+		mcp.WithDescription("Discard a session's buffered output without reading it, optionally sending newlines to get a fresh prompt. Use this to get back to a known state after an aborted or messy interaction."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithNumber("newlines", mcp.Description("Number of newlines to send after clearing (e.g. 1 or 2 to redraw the prompt). Default 0.")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for the fresh prompt after sending newlines (in seconds). Default 0.5s.")),
+	), clearBufferHandler)
+
+	// Tool: Expect
+	s.AddTool(mcp.NewTool("expect",
+		mcp.WithDescription("Run a send/expect script against a session: for each step, send the input and wait until the output matches expect_regex. Stops at the first step that times out."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithArray("steps", mcp.Required(), mcp.Description("Steps to run in order."), mcp.Items(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"send":         map[string]any{"type": "string", "description": "Input to send (e.g. 'y\n'). May be empty to only wait."},
+				"expect_regex": map[string]any{"type": "string", "description": "Regular expression the output must match before moving on."},
+				"timeout":      map[string]any{"type": "number", "description": "Seconds to wait for a match. Default 10."},
+			},
+			"required": []string{"expect_regex"},
+		})),
+		formatOption,
+	), expectHandler)
+
+	// Tool: Describe Session
+	s.AddTool(mcp.NewTool("describe_session",
+		mcp.WithDescription("Return all known metadata for a session: host, ssh command, terminal size, timestamps, status and buffered output size."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		formatOption,
+	), describeSessionHandler)
+
+	// Tool: Broadcast
+	s.AddTool(mcp.NewTool("broadcast",
+		mcp.WithDescription("Send the same input to several sessions at once and collect each one's output."),
+		mcp.WithArray("session_ids", mcp.WithStringItems(), mcp.Description("Session IDs or names to send the input to.")),
+		mcp.WithString("tag", mcp.Description("Send to every session carrying this tag, in addition to any session_ids.")),
+		mcp.WithString("input", mcp.Required(), mcp.Description("Command or text to send to every terminal (e.g. 'uptime\n').")),
+		mcp.WithString("wait_duration", mcp.Description("Time to wait for output after sending input (in seconds). Default 0.5s.")),
+		formatOption,
+	), broadcastHandler)
+
+	// Tool: Close All Sessions
+	s.AddTool(mcp.NewTool("close_all_sessions",
+		mcp.WithDescription("Terminate every active session, or only those carrying a tag."),
+		mcp.WithString("tag", mcp.Description("Only close sessions carrying this tag.")),
+	), closeAllSessionsHandler)
+
+	// Tool: Add Tag
+	s.AddTool(mcp.NewTool("add_tag",
+		mcp.WithDescription("Add a tag to a session."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("tag", mcp.Required()),
+	), addTagHandler)
+
+	// Tool: Remove Tag
+	s.AddTool(mcp.NewTool("remove_tag",
+		mcp.WithDescription("Remove a tag from a session."),
+		mcp.WithString("session_id", mcp.Required(), mcp.Description("Session ID or name.")),
+		mcp.WithString("tag", mcp.Required()),
+	), removeTagHandler)
+
+	// Resources: every session's output, listed and updated by the watcher
+	s.AddResourceTemplate(mcp.NewResourceTemplate(resourceScheme+"{id}"+resourceOutputSuffix, "Session output",
+		mcp.WithTemplateDescription("Unread terminal output of a session, by ID or name; reading it doesn't consume it."),
+		mcp.WithTemplateMIMEType("text/plain"),
+	), readSessionResource)
+	resources.srv = s
+	go resources.watch()
+
+	return s
+}
+
+// shutdown closes all sessions and tears down shared SSH connections. Saved
+// state is frozen first so the sessions can be restored on the next start.
+func shutdown() {
+	state.Freeze()
+	manager.RemoveAll("")
+	controlMasters.Close()
 }
 
 // --- Logic Implementation ---
 
-func (sm *SessionManager) Add(sess *Session) {
+// Add registers a session. If sess.ID is empty, a unique ID is generated
+// according to the configured scheme.
+func (sm *SessionManager) Add(sess *Session) error {
+	defer state.Save(sm) // Runs after the unlock below
+	var evicted *Session
+	defer func() { // Also after the unlock
+		if evicted != nil {
+			evicted.markDead(evictedReason)
+			sm.closeRemoved(evicted)
+			logger.Info("evicted the least recently used session to stay within the session limit", "session_id", evicted.ID, "idle", time.Since(evicted.LastUsed()).Round(time.Second))
+		}
+	}()
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	if sess.ID == "" {
+		sess.ID = sm.newID(sess.Host)
+	} else if sm.nameTaken(sess.ID, "") {
+		return fmt.Errorf("session ID %q is already in use", sess.ID)
+	}
+	if name := sess.Name(); name != "" && sm.nameTaken(name, sess.ID) {
+		return fmt.Errorf("session name %q is already in use", name)
+	}
+	if config.MaxSessions > 0 && sm.liveCount() >= config.MaxSessions {
+		if !config.EvictIdle {
+			return fmt.Errorf("too many sessions: the limit of %d live sessions is reached; close one first", config.MaxSessions)
+		}
+		if evicted = sm.leastRecentlyUsed(); evicted == nil {
+			return fmt.Errorf("too many sessions: the limit of %d live sessions is reached and none can be evicted (all are keep_alive); close one first", config.MaxSessions)
+		}
+		sm.unregister(evicted)
+	}
 	sm.sessions[sess.ID] = sess
+	sm.setName(sess, sess.Name())
+	metrics.sessionsCreated.Add(1)
+	logger.Info("session started", "session_id", sess.ID, "host", sess.Host)
+	return nil
+}
+
+// liveCount returns how many sessions are still running. Dead ones (e.g.
+// restored from the state file) hold no process and don't count toward
+// MaxSessions. The caller must hold sm.mu.
+func (sm *SessionManager) liveCount() int {
+	n := 0
+	for _, sess := range sm.sessions {
+		if sess.Alive() {
+			n++
+		}
+	}
+	return n
 }
 
 func (sm *SessionManager) Get(id string) (*Session, bool) {
@@ -83,23 +756,256 @@ func (sm *SessionManager) Get(id string) (*Session, bool) {
 	return sess, ok
 }
 
-func (sm *SessionManager) Remove(id string) {
+// Lookup resolves a session by its ID or, failing that, by its name.
+func (sm *SessionManager) Lookup(idOrName string) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sess, ok := sm.sessions[idOrName]
+	if !ok {
+		if id, named := sm.names[idOrName]; named {
+			sess, ok = sm.sessions[id], true
+		}
+	}
+	if ok {
+		sess.markUsed() // Handlers look sessions up, so this tracks use for the idle reaper
+	}
+	return sess, ok
+}
+
+// Rename changes the name of a session, enforcing uniqueness.
+func (sm *SessionManager) Rename(id, name string) error {
+	defer state.Save(sm)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sess, ok := sm.sessions[id]
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+	if name != "" && sm.nameTaken(name, id) {
+		return fmt.Errorf("session name %q is already in use", name)
+	}
+	sm.setName(sess, name)
+	return nil
+}
+
+// setName names a registered session and keeps the name index in step.
+// Caller must hold sm.mu.
+func (sm *SessionManager) setName(sess *Session, name string) {
+	if old := sess.Name(); old != "" && sm.names[old] == sess.ID {
+		delete(sm.names, old)
+	}
+	sess.bufMu.Lock()
+	sess.name = name
+	sess.bufMu.Unlock()
+	if name == "" {
+		return
+	}
+	if sm.names == nil {
+		sm.names = make(map[string]string)
+	}
+	sm.names[name] = sess.ID
+}
+
+// nameTaken reports whether name is used by another session, either as its
+// name or its ID. Caller must hold sm.mu.
+func (sm *SessionManager) nameTaken(name, exceptID string) bool {
+	if _, ok := sm.sessions[name]; ok && name != exceptID {
+		return true
+	}
+	id, ok := sm.names[name]
+	return ok && id != exceptID
+}
+
+// IDs returns a snapshot of the IDs of all active sessions.
+func (sm *SessionManager) IDs() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	ids := make([]string, 0, len(sm.sessions))
+	for id := range sm.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Remove terminates a session, reporting whether it was still registered.
+// Only the caller that unregisters the session tears it down.
+func (sm *SessionManager) Remove(id string) bool {
+	sm.mu.Lock()
+	sess, ok := sm.sessions[id]
+	if ok {
+		sm.unregister(sess)
+	}
+	sm.mu.Unlock()
+	if !ok {
+		return false
+	}
+	sm.closeRemoved(sess)
+	return true
+}
+
+// unregister drops sess from the manager. The caller must hold sm.mu, and
+// then call closeRemoved without it.
+func (sm *SessionManager) unregister(sess *Session) {
+	if name := sess.Name(); sm.names[name] == sess.ID {
+		delete(sm.names, name)
+	}
+	delete(sm.sessions, sess.ID)
+}
+
+// closeRemoved closes a session that was unregistered, and its port
+// forwards.
+func (sm *SessionManager) closeRemoved(sess *Session) {
+	forwards.removeSession(sess.ID)
+	sess.transcript.note("session closed")
+	sess.Close()
+	sess.transcript.close()
+	logger.Info("session removed", "session_id", sess.ID)
+	state.Save(sm)
+}
+
+// Replace swaps a fresh session in for old under the same ID, carrying over
+// the name and tags. It fails if old is no longer registered (e.g. it was
+// closed concurrently). The old session is closed outside the lock.
+func (sm *SessionManager) Replace(old, fresh *Session) bool {
+	sm.mu.Lock()
+	if sm.sessions[old.ID] != old {
+		sm.mu.Unlock()
+		return false
+	}
+	fresh.ID = old.ID
+	fresh.name = old.Name()
+	fresh.Tags = old.Tags
+	sm.sessions[old.ID] = fresh
+	sm.mu.Unlock()
+	old.Close()
+	logger.Info("session replaced", "session_id", old.ID, "host", fresh.Host)
+	state.Save(sm)
+	return true
+}
+
+// ConnectedTo returns the live SSH sessions whose destination matches dest.
+func (sm *SessionManager) ConnectedTo(dest string) []*Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var matches []*Session
+	for _, sess := range sm.sessions {
+		if sess.SSH != nil && sess.SSH.Destination() == dest && sess.Alive() {
+			matches = append(matches, sess)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *Session) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return matches
+}
+
+// Tagged returns a snapshot of the IDs of sessions carrying tag.
+func (sm *SessionManager) Tagged(tag string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var ids []string
+	for id, sess := range sm.sessions {
+		if slices.Contains(sess.Tags, tag) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// List returns a snapshot of the registered sessions (or, if tag is
+// non-empty, those carrying tag), oldest first.
+func (sm *SessionManager) List(tag string) []*Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, sess := range sm.sessions {
+		if tag == "" || slices.Contains(sess.Tags, tag) {
+			sessions = append(sessions, sess)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return sessions
+}
+
+// AddTag adds tag to a session if it isn't already present.
+func (sm *SessionManager) AddTag(id, tag string) error {
+	defer state.Save(sm)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	if sess, ok := sm.sessions[id]; ok {
-		close(sess.done) // Stop the reader
-		sess.Ptmx.Close()
-		if sess.Cmd.Process != nil {
-			sess.Cmd.Process.Kill()
+	sess, ok := sm.sessions[id]
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+	if !slices.Contains(sess.Tags, tag) {
+		sess.Tags = append(sess.Tags, tag)
+	}
+	return nil
+}
+
+// RemoveTag removes tag from a session, reporting whether it was present.
+func (sm *SessionManager) RemoveTag(id, tag string) (bool, error) {
+	defer state.Save(sm)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sess, ok := sm.sessions[id]
+	if !ok {
+		return false, fmt.Errorf("session not found")
+	}
+	i := slices.Index(sess.Tags, tag)
+	if i < 0 {
+		return false, nil
+	}
+	sess.Tags = slices.Delete(slices.Clone(sess.Tags), i, i+1)
+	return true, nil
+}
+
+// TagsOf returns a copy of a session's tags.
+func (sm *SessionManager) TagsOf(sess *Session) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return slices.Clone(sess.Tags)
+}
+
+// RemoveAll terminates every session that existed when it was called (or,
+// if tag is non-empty, every such session carrying tag) and returns how many
+// it closed. Sessions started concurrently are left alone.
+func (sm *SessionManager) RemoveAll(tag string) int {
+	ids := sm.IDs()
+	if tag != "" {
+		ids = sm.Tagged(tag)
+	}
+	closed := 0
+	for _, id := range ids {
+		if sm.Remove(id) {
+			closed++
 		}
-		delete(sm.sessions, id)
 	}
+	return closed
 }
 
+// maxReadBufferSize caps how far the reader grows its chunk during bursts.
+const maxReadBufferSize = 1 << 20
+
 // startReader constantly reads from PTY and appends to buffer
 func (s *Session) startReader() {
-	buf := make([]byte, 8192)
-	defer close(s.exited) // Signal that process exited
+	size := config.ReadBufferSize
+	if size <= 0 {
+		size = 32 * 1024
+	}
+	buf := make([]byte, size)
+	s.bufMu.Lock()
+	s.outputBuf.limit = config.MaxBufferBytes
+	s.bufMu.Unlock()
+
+	reason := "closed"
+	defer func() {
+		s.markDead(reason) // Signal that process exited
+		s.reap()
+		attrs := []any{"session_id", s.ID, "reason", reason}
+		if code := s.ExitCode(); code != nil {
+			attrs = append(attrs, "exit_code", *code)
+		}
+		s.transcript.note("session exited (%s)", s.ExitSummary())
+		logger.Info("session exited", attrs...)
+	}()
 
 	for {
 		select {
@@ -108,13 +1014,38 @@ func (s *Session) startReader() {
 		default:
 			n, err := s.Ptmx.Read(buf)
 			if n > 0 {
+				metrics.bytesRead.Add(int64(n))
+				s.transcript.output(buf[:n])
 				s.bufMu.Lock()
-				s.outputBuf.Write(buf[:n])
+				before := s.outputBuf.total
+				if s.throttle != nil {
+					s.throttle.write(&s.outputBuf, buf[:n], time.Now())
+				} else {
+					s.outputBuf.Write(buf[:n])
+				}
+				metrics.bytesDropped.Add(s.outputBuf.total - before)
+				if dir, ok := lastCwdReport(buf[:n]); ok {
+					s.cwd = dir
+				}
+				s.lastActive = time.Now()
+				s.lastOutput = s.lastActive
 				s.bufMu.Unlock()
+
+				// A full read means more is likely pending (e.g. 'cat bigfile');
+				// grow the chunk so bursts drain in fewer reads and lock rounds.
+				if n == len(buf) && len(buf) < maxReadBufferSize {
+					buf = make([]byte, min(2*len(buf), maxReadBufferSize))
+				}
 			}
 			if err != nil {
-				if err != io.EOF {
-					// Log error if needed, or just exit
+				select {
+				case <-s.done:
+					// Closed by Remove; keep the "closed" reason
+				default:
+					reason = readErrorReason(err)
+					if reason != "EOF" {
+						logger.Warn("session read error", "session_id", s.ID, "err", err)
+					}
 				}
 				return
 			}
@@ -122,116 +1053,2311 @@ func (s *Session) startReader() {
 	}
 }
 
-// ReadAndClear returns the current buffer content and clears it.
-func (s *Session) ReadAndClear() string {
-	s.bufMu.Lock()
-	defer s.bufMu.Unlock()
-	out := s.outputBuf.String()
-	s.outputBuf.Reset()
-	return out
+// readErrorReason describes why a PTY read ended the session.
+func readErrorReason(err error) string {
+	// Linux reports EIO on the master once the child side of the PTY is closed
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.EIO) {
+		return "EOF"
+	}
+	return "read error: " + err.Error()
 }
 
-// --- Handlers ---
+// stop tells the reader to finish and closes the PTY. Safe to call repeatedly.
+func (s *Session) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.Ptmx.Close()
+	})
+}
 
-func startSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	host := args.GetString("host", "")
-	if host == "" {
-		return mcp.NewToolResultError("Host argument is required"), nil
+// Close stops the session, kills its process (or drops its connection) and
+// waits for it to exit.
+func (s *Session) Close() {
+	s.stop()
+	if s.native != nil {
+		s.native.close()
+		s.reap()
+	} else if s.telnet != nil {
+		s.telnet.close()
+	} else if s.Cmd.Process != nil {
+		s.Cmd.Process.Kill()
+		s.reap() // Reap the process so its exit status is available
 	}
+}
 
-	var c *exec.Cmd
-	if host == "local" {
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			shell = "/bin/bash"
+// markDead records why the session stopped and closes exited, exactly once.
+func (s *Session) markDead(reason string) {
+	s.exitOnce.Do(func() {
+		s.deadReason = reason
+		close(s.exited)
+		metrics.SessionDied(reason)
+	})
+}
+
+// reap waits for the process and records its exit code. It may be called
+// from several goroutines; only the first one calls Cmd.Wait.
+func (s *Session) reap() {
+	s.reapOnce.Do(func() {
+		if s.native != nil {
+			code := s.native.exitCode()
+			s.bufMu.Lock()
+			s.exitCode = code
+			s.bufMu.Unlock()
+			return
 		}
-		c = exec.Command(shell)
-	} else {
-		// Use -tt to force PTY, BatchMode to fail fast on auth issues
-		c = exec.Command("ssh", "-tt", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=no", host)
-	}
+		if s.Cmd.Process == nil {
+			return
+		}
+		s.Cmd.Wait()
+		if s.Cmd.ProcessState != nil {
+			code := s.Cmd.ProcessState.ExitCode()
+			s.bufMu.Lock()
+			s.exitCode = &code
+			s.bufMu.Unlock()
+		}
+	})
+}
 
-	// Start PTY
-	ptmx, err := pty.Start(c)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to start session: %v", err)), nil
+// DeadReason returns why the session stopped, or "" while it is alive.
+func (s *Session) DeadReason() string {
+	select {
+	case <-s.exited:
+		return s.deadReason
+	default:
+		return ""
 	}
+}
 
-	// Create Session
-	sessID := uuid.New().String()
-	sess := &Session{
-		ID:        sessID,
-		Cmd:       c,
-		Ptmx:      ptmx,
-		CreatedAt: time.Now(),
-		done:      make(chan struct{}),
-		exited:    make(chan struct{}),
+// ExitSummary describes how a dead session ended, e.g. "EOF, exit code 0".
+func (s *Session) ExitSummary() string {
+	summary := s.DeadReason()
+	if code := s.ExitCode(); code != nil {
+		summary += fmt.Sprintf(", exit code %d", *code)
 	}
+	return summary
+}
 
-	// Start background reader
-	go sess.startReader()
+// ReadAndClear returns the current buffer content and clears it, except for
+// a character still arriving (see wholeRunes).
+func (s *Session) ReadAndClear() string {
+	out, _ := s.read(true, false)
+	return out
+}
 
-	manager.Add(sess)
+// wholeRunes trims data to end with a whole UTF-8 character, so that one
+// split across PTY reads is returned by the next read instead of broken in
+// two. Once the session has exited nothing more will arrive, and data is
+// returned as is. The caller must hold bufMu.
+func (s *Session) wholeRunes(data []byte) []byte {
+	if !s.Alive() {
+		return data
+	}
+	return data[:len(data)-incompleteRuneLen(data)]
+}
 
-	// Wait a bit for initial banner/login output
-	time.Sleep(1 * time.Second)
-	initialOutput := sess.ReadAndClear()
+// Terminal control characters for the default VEOF (Ctrl+D) and VINTR
+// (Ctrl+C) settings.
+const (
+	eofChar  = 0x04
+	intrChar = 0x03
+)
 
-	// Check if process exited immediately (e.g. connection error)
-	select {
-	case <-sess.exited:
-		manager.Remove(sessID)
-		return mcp.NewToolResultError(fmt.Sprintf("Session started but exited immediately (SSH error?):\n%s", initialOutput)), nil
-	default:
-		// Session is healthy
+// Write sends data to the PTY, serialized with other writers.
+func (s *Session) Write(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.transcript.input(data) // First, so it precedes the echo
+	n, err := s.Ptmx.Write(data)
+	metrics.bytesWritten.Add(int64(n))
+	if err != nil {
+		return err
 	}
+	s.Touch()
+	return nil
+}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Session started. ID: %s\n\nOutput:\n%s", sessID, initialOutput)), nil
+// WriteSecret writes data like Write, but the transcript only records that
+// something was sent, e.g. a password.
+func (s *Session) WriteSecret(data []byte, what string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.transcript.note("sent %s (%d bytes, redacted)", what, len(data))
+	n, err := s.Ptmx.Write(data)
+	metrics.bytesWritten.Add(int64(n))
+	if err != nil {
+		return err
+	}
+	s.Touch()
+	return nil
 }
 
-func interactSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	sessID := args.GetString("session_id", "")
-	input := args.GetString("input", "")
-	waitSecStr := args.GetString("wait_duration", "0.5")
+// SendEOF signals end-of-input to the foreground program without closing the PTY.
+func (s *Session) SendEOF() error {
+	return s.Write([]byte{eofChar})
+}
 
-	sess, ok := manager.Get(sessID)
-	if !ok {
-		return mcp.NewToolResultError("Session not found"), nil
-	}
+// defaultWriteChunkDelay is the pause between paced chunks when only a chunk
+// size is given.
+const defaultWriteChunkDelay = 10 * time.Millisecond
 
-	// Check if process is alive
+// WritePaced writes data in chunks of at most chunk bytes with a pause in
+// between, like a terminal emulator's paste pacing, so a slow link or a
+// small remote input buffer doesn't drop characters. The whole paste holds
+// the write lock so other inputs can't be spliced into it. A chunk of 0
+// writes everything at once.
+func (s *Session) WritePaced(data []byte, chunk int, delay time.Duration) error {
+	if chunk <= 0 || len(data) <= chunk {
+		return s.Write(data)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		s.transcript.input(data[:n])
+		written, err := s.Ptmx.Write(data[:n])
+		metrics.bytesWritten.Add(int64(written))
+		if err != nil {
+			return err
+		}
+		s.Touch()
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-s.done:
+			return os.ErrClosed
+		}
+	}
+	return nil
+}
+
+// waitOrExit waits for d but returns as soon as the session exits or ctx is
+// cancelled, reporting whether the session exited.
+func (s *Session) waitOrExit(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return !s.Alive()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.exited:
+		return true
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	return false
+}
+
+// SendInterrupt sends Ctrl+C, which the terminal turns into SIGINT for the
+// foreground process group.
+func (s *Session) SendInterrupt() error {
+	return s.Write([]byte{intrChar})
+}
+
+// ReadCompleteLines returns buffered output up to and including the last
+// newline, leaving any trailing partial line buffered for the next read.
+func (s *Session) ReadCompleteLines() string {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.throttle != nil {
+		s.throttle.flush(&s.outputBuf)
+	}
+	i := bytes.LastIndexByte(s.outputBuf.Bytes(), '\n')
+	if i < 0 {
+		return ""
+	}
+	return string(s.outputBuf.Next(i + 1))
+}
+
+// Clear discards the buffered output without reading it and returns how many
+// bytes were dropped. The reader appends under bufMu, so a chunk arriving
+// concurrently lands either entirely before or entirely after the clear.
+func (s *Session) Clear() int {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.throttle != nil {
+		s.throttle.reset()
+	}
+	n := s.outputBuf.Len()
+	s.outputBuf.Reset()
+	s.outputBuf.takeDropped() // Whatever overflowed is moot now
+	return n
+}
+
+// Tail returns up to the last n complete lines of the buffered output,
+// without their line endings and without clearing the buffer. A trailing
+// partial line (such as a prompt) is not included.
+func (s *Session) Tail(n int) []string {
+	s.bufMu.Lock()
+	data := s.outputBuf.Bytes()
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 || n <= 0 {
+		s.bufMu.Unlock()
+		return nil
+	}
+	// Walk back from the end so a large buffer isn't split entirely
+	start := end
+	for count := 0; count < n; count++ {
+		start = bytes.LastIndexByte(data[:start], '\n')
+		if start < 0 {
+			break
+		}
+	}
+	text := string(data[start+1 : end])
+	s.bufMu.Unlock()
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// read returns the buffered output, all of it (up to the last whole
+// character) or (lineMode) up to the last newline, clearing what it returns
+// unless clear is false, and the output offset just past it.
+func (s *Session) read(clear, lineMode bool) (string, int64) {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if clear && s.throttle != nil {
+		s.throttle.flush(&s.outputBuf)
+	}
+	data := s.outputBuf.Bytes()
+	if lineMode {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	} else {
+		data = s.wholeRunes(data)
+	}
+	out := string(data)
+	next := s.outputBuf.end() - int64(s.outputBuf.Len()-len(data))
+	switch {
+	case clear && len(data) < s.outputBuf.Len():
+		s.outputBuf.Next(len(data))
+	case clear:
+		s.outputBuf.Reset()
+	}
+	return out, next
+}
+
+// ReadSince returns the output from offset off on, all of it or (lineMode)
+// up to the last newline, without clearing anything. It also returns the
+// offset just past it and how many bytes from off on were already dropped.
+func (s *Session) ReadSince(off int64, lineMode bool) (out string, next, lost int64) {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.throttle != nil {
+		s.throttle.flush(&s.outputBuf)
+	}
+	data, start := s.outputBuf.since(off)
+	if lineMode {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	} else {
+		data = s.wholeRunes(data)
+	}
+	return string(data), start + int64(len(data)), max(start-off, 0)
+}
+
+// UnreadOffset returns the output offset of the first unread byte.
+func (s *Session) UnreadOffset() int64 {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.outputBuf.end() - int64(s.outputBuf.Len())
+}
+
+// OutputOffset returns the offset just past the session's output so far.
+func (s *Session) OutputOffset() int64 {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.outputBuf.end()
+}
+
+// Peek returns the buffered output, up to the last whole character, without
+// clearing it.
+func (s *Session) Peek() string {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return string(s.wholeRunes(s.outputBuf.Bytes()))
+}
+
+// Touch records activity on the session (e.g. input being sent).
+func (s *Session) Touch() {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	s.lastActive = time.Now()
+}
+
+// LastActive returns the time of the last input or output on the session.
+func (s *Session) LastActive() time.Time {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.lastActive.IsZero() {
+		return s.CreatedAt
+	}
+	return s.lastActive
+}
+
+// LastOutput returns the time output was last received (zero if never).
+func (s *Session) LastOutput() time.Time {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.lastOutput
+}
+
+// TakeDropped returns how many unread output bytes were discarded because
+// the buffer was full since the last call.
+func (s *Session) TakeDropped() int64 {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.outputBuf.takeDropped()
+}
+
+// DroppedTotal returns how many unread output bytes the session has
+// discarded because its buffer was full.
+func (s *Session) DroppedTotal() int64 {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.outputBuf.total
+}
+
+// Buffered returns the number of output bytes waiting to be read.
+func (s *Session) Buffered() int {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.outputBuf.Len()
+}
+
+// Name returns the session's name, or "" if it has none.
+func (s *Session) Name() string {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.name
+}
+
+// Label returns the session ID, annotated with its name if it has one.
+func (s *Session) Label() string {
+	name := s.Name()
+	if name == "" {
+		return s.ID
+	}
+	return fmt.Sprintf("%s (name: %s)", s.ID, name)
+}
+
+// ExitCode returns the process exit code once the session has been reaped.
+func (s *Session) ExitCode() *int {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.exitCode
+}
+
+// Alive reports whether the session's process is still running.
+func (s *Session) Alive() bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// --- Handlers ---
+
+type startResult struct {
+	SessionID     string `json:"session_id"`
+	Name          string `json:"name,omitempty"`
+	Host          string `json:"host"`
+	InitialOutput string `json:"initial_output"`
+	Exited        bool   `json:"exited"`
+	Ready         string `json:"ready"` // Which readiness condition ended the wait
+	Attempts      int    `json:"attempts"`
+
+	Warning          string   `json:"warning,omitempty"`
+	ExistingSessions []string `json:"existing_sessions,omitempty"`
+	NewHostKeys      []string `json:"new_host_keys,omitempty"` // "host TYPE SHA256:..." of keys accepted under accept-new
+}
+
+type dryRunResult struct {
+	Host      string   `json:"host"`
+	Command   []string `json:"command"`
+	Transport string   `json:"transport,omitempty"`
+}
+
+// interactResult is interact_session's structured content, and its whole
+// result with format=json.
+type interactResult struct {
+	Output              string `json:"output"`
+	Encoding            string `json:"encoding,omitempty"` // How Output is encoded if it isn't text: base64 or hex
+	SessionAlive        bool   `json:"session_alive"`
+	Exited              bool   `json:"exited"`
+	DeadReason          string `json:"dead_reason,omitempty"`
+	ExitCode            *int   `json:"exit_code"`
+	Bytes               int    `json:"bytes"`
+	Truncated           bool   `json:"truncated"`
+	DroppedBytes        int    `json:"dropped_bytes,omitempty"`
+	OutputStillArriving bool   `json:"output_still_arriving"`
+	TimedOut            bool   `json:"timed_out,omitempty"`
+	Killed              string `json:"killed,omitempty"`               // Signal sent after Ctrl+C didn't stop the command
+	Matched             *bool  `json:"matched,omitempty"`              // Whether expect/expect_regex matched, when given
+	BufferDroppedBytes  int64  `json:"buffer_dropped_bytes,omitempty"` // Unread output lost to the buffer limit before this read
+	Prompt              string `json:"prompt,omitempty"`               // The anchor prompt, with anchor=prompt
+	Peeked              bool   `json:"peeked,omitempty"`               // With clear=false: the output is still buffered
+	NextOffset          int64  `json:"next_offset"`                    // Output offset just past this output, for since_offset
+
+	AwaitingInput *awaitingInput `json:"awaiting_input,omitempty"` // The prompt the output ends with, if the command is blocked on one
+}
+
+type checkResult struct {
+	SessionID     string    `json:"session_id"`
+	Name          string    `json:"name,omitempty"`
+	Alive         bool      `json:"alive"`
+	DeadReason    string    `json:"dead_reason,omitempty"`
+	ExitCode      *int      `json:"exit_code,omitempty"`
+	LastActive    time.Time `json:"last_active"`
+	IdleSeconds   float64   `json:"idle_seconds"`
+	BufferedBytes int       `json:"buffered_bytes"`
+}
+
+type listEntry struct {
+	SessionID   string    `json:"session_id"`
+	Name        string    `json:"name,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Host        string    `json:"host"`
+	Destination string    `json:"destination"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastActive  time.Time `json:"last_active"`
+	Alive       bool      `json:"alive"`
+	DeadReason  string    `json:"dead_reason,omitempty"`
+}
+
+type listResult struct {
+	Sessions []listEntry `json:"sessions"`
+}
+
+// shellQuoteArgs renders argv as a copy-pasteable shell command line.
+func shellQuoteArgs(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		if a != "" && !strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]{}~#!%") {
+			quoted[i] = a
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// wantJSON reports whether the caller asked for a structured JSON result.
+func wantJSON(args mcp.CallToolRequest) bool {
+	return args.GetString("format", "text") == "json"
+}
+
+// jsonResult marshals v into a text tool result.
+func jsonResult(v any) *mcp.CallToolResult {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to encode result: %v", err))
+	}
+	return mcp.NewToolResultText(string(data))
+}
+
+// structuredJSONResult is jsonResult with v also attached as the result's
+// structured content, for tools that return it whatever the format.
+func structuredJSONResult(v any) *mcp.CallToolResult {
+	result := jsonResult(v)
+	if !result.IsError {
+		result.StructuredContent = v
+	}
+	return result
+}
+
+func startSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	host := args.GetString("host", "")
+	if host == "" {
+		return mcp.NewToolResultError("Host argument is required"), nil
+	}
+	var serial serialPort
+	isSerial := isSerialHost(host)
+	if isSerial {
+		var err error
+		if serial, err = parseSerialHost(host); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	var telnetDest telnetTarget
+	isTelnet := isTelnetHost(host)
+	if isTelnet {
+		var err error
+		if telnetDest, err = parseTelnetHost(host); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	namespace, pod, isKube := kubePod(host)
+	podContainer := args.GetString("container", "")
+	if (args.GetString("namespace", "") != "" || podContainer != "") && !isKube {
+		return mcp.NewToolResultError("namespace and container are only available for k8s:<pod> hosts"), nil
+	}
+	if ns := args.GetString("namespace", ""); ns != "" {
+		if namespace != "" && namespace != ns {
+			return mcp.NewToolResultError(fmt.Sprintf("host %q is already in namespace %q", host, namespace)), nil
+		}
+		host = kubeHostPrefix + ns + "/" + pod
+	}
+	name := args.GetString("name", "")
+	tags, err := parseTags(args.GetStringSlice("tags", nil))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if name != "" {
+		if _, exists := manager.Lookup(name); exists {
+			return mcp.NewToolResultError(fmt.Sprintf("Session name %q is already in use", name)), nil
+		}
+	}
+	throttle, err := newOutputThrottle(args.GetString("output_filter", FilterNone), args.GetInt("max_lines_per_sec", 200))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var promptRe *regexp.Regexp
+	if expr := args.GetString("prompt_regex", ""); expr != "" {
+		if promptRe, err = regexp.Compile(expr); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid prompt_regex: %v", err)), nil
+		}
+	}
+	writeChunk := args.GetInt("write_chunk_size", 0)
+	if writeChunk < 0 {
+		return mcp.NewToolResultError("write_chunk_size must not be negative"), nil
+	}
+	writeDelay := parseSeconds(args.GetString("write_chunk_delay", ""), defaultWriteChunkDelay)
+	term := args.GetString("term", defaultTerm)
+	if !validTermRe.MatchString(term) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid term %q", term)), nil
+	}
+	env, err := parseEnv(args.GetArguments()["env"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(env) > 0 && isSerial {
+		return mcp.NewToolResultError("env isn't available for serial sessions; there is no process to pass it to"), nil
+	}
+	if len(env) > 0 && isTelnet {
+		return mcp.NewToolResultError("env isn't available for telnet sessions; export the variables after logging in"), nil
+	}
+	if len(env) > 0 && isKube {
+		return mcp.NewToolResultError("env isn't available for k8s sessions, since kubectl exec passes no environment; export the variables after connecting"), nil
+	}
+	rows, cols := args.GetInt("rows", defaultRows), args.GetInt("cols", defaultCols)
+	if err := checkTermSize(rows, cols); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	password := args.GetString("password", "")
+	passphrase := args.GetString("passphrase", "")
+	transport := args.GetString("transport", config.SSHTransport)
+	if password != "" || passphrase != "" {
+		// The ssh binary runs in BatchMode and could only get a secret by
+		// having it typed into the PTY
+		if args.GetString("transport", "") == TransportExec {
+			secret := "password"
+			if password == "" {
+				secret = "passphrase"
+			}
+			return mcp.NewToolResultError(secret + " requires the native transport; omit transport or set it to 'native'"), nil
+		}
+		transport = TransportNative
+	}
+	hostKeyPolicy := args.GetString("host_key_policy", config.HostKeyPolicy)
+	if !validHostKeyPolicy(hostKeyPolicy) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid host_key_policy %q (use 'strict', 'accept-new' or 'off')", hostKeyPolicy)), nil
+	}
+	aliveInterval := args.GetInt("server_alive_interval", 0)
+	aliveCountMax := args.GetInt("server_alive_count_max", 0)
+	if aliveInterval < 0 || aliveCountMax < 0 {
+		return mcp.NewToolResultError("server_alive_interval and server_alive_count_max must not be negative"), nil
+	}
+	if (aliveInterval > 0 || aliveCountMax > 0) && !isSSHHost(host) {
+		return mcp.NewToolResultError("server_alive_interval and server_alive_count_max are only available for SSH sessions"), nil
+	}
+	autoReconnect, restoreCwd := args.GetBool("auto_reconnect", false), args.GetBool("restore_cwd", false)
+	if autoReconnect && !isSSHHost(host) {
+		return mcp.NewToolResultError("auto_reconnect is only available for SSH sessions"), nil
+	}
+	if restoreCwd && !autoReconnect {
+		return mcp.NewToolResultError("restore_cwd requires auto_reconnect"), nil
+	}
+	identityFile := args.GetString("identity_file", "")
+	if passphrase != "" && identityFile == "" {
+		return mcp.NewToolResultError("passphrase requires identity_file"), nil
+	}
+	if transport != TransportExec && transport != TransportNative {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid transport %q (use 'exec' or 'native')", transport)), nil
+	}
+
+	backing := args.GetString("backing", "")
+	reattach := args.GetString("reattach", "")
+	if reattach != "" && backing == "" {
+		backing = BackingTmux
+	}
+	container, isDocker := dockerContainer(host)
+	if (host == "local" || containerHost(host) || isSerial || isTelnet) && backing != "" {
+		return mcp.NewToolResultError("backing and reattach are only available for SSH sessions"), nil
+	}
+	var command []string
+	if program := args.GetString("command", ""); program != "" {
+		if isSerial || isTelnet {
+			return mcp.NewToolResultError("command isn't available for serial or telnet sessions; the device's console is the program"), nil
+		}
+		if backing != "" {
+			return mcp.NewToolResultError("command can't be combined with backing or reattach"), nil
+		}
+		command = append([]string{program}, args.GetStringSlice("args", nil)...)
+	} else if len(args.GetStringSlice("args", nil)) > 0 {
+		return mcp.NewToolResultError("args requires command"), nil
+	}
+	cwd := args.GetString("cwd", "")
+	if cwd != "" {
+		if host != "local" {
+			return mcp.NewToolResultError("cwd is only available for local sessions; cd after connecting instead"), nil
+		}
+		if cwd, err = resolveLocalDir(cwd); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	if command == nil {
+		// A configured default backing only wraps shells
+		backing = cmp.Or(backing, config.Backing)
+	}
+
+	jumpHosts := args.GetStringSlice("jump_hosts", nil)
+	if host == "local" {
+		err = checkLocalAllowed()
+	} else if containerHost(host) {
+		err = checkContainerAllowed(host)
+	} else if isSerial {
+		err = checkSerialAllowed(serial)
+	} else if isTelnet {
+		err = checkHostAllowed(telnetDest.Host)
+	} else {
+		err = checkHostAllowed(host)
+		for _, spec := range jumpHosts {
+			if err == nil {
+				err = checkJumpHostAllowed(spec)
+			}
+		}
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// A program and its arguments are as much a command as typed input
+	if command != nil {
+		if err := checkInputAllowed(ctx, cmp.Or(args.GetString("name", ""), host), shellQuoteArgs(command)); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	var c *exec.Cmd
+	var sshOpts *SSHOptions
+	if host == "local" {
+		if command != nil {
+			if _, err := exec.LookPath(command[0]); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("command %q not found: %v", command[0], err)), nil
+			}
+			c = exec.Command(command[0], command[1:]...)
+		} else {
+			c = localShellCommand()
+		}
+		c.Dir = cwd
+	} else if isDocker {
+		if c, err = dockerCommand(container, command, env); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else if isKube {
+		if c, err = kubeCommand(host, podContainer, term, command); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	} else if isSerial || isTelnet {
+		c = &exec.Cmd{} // No process: openSession opens the device or connects
+	} else {
+		opts := SSHOptions{
+			Host:       host,
+			User:       args.GetString("user", ""),
+			Port:       args.GetInt("port", 0),
+			PTYMode:    args.GetString("pty_mode", PTYForce),
+			Transport:  transport,
+			Password:   password,
+			Passphrase: passphrase,
+			JumpHosts:  jumpHosts,
+
+			HostKeyPolicy: hostKeyPolicy,
+			AliveInterval: cmp.Or(aliveInterval, config.AliveInterval),
+			AliveCountMax: cmp.Or(aliveCountMax, config.AliveCountMax),
+			Env:           env,
+			Command:       command,
+			Backing:       backing,
+		}
+		if backing != "" {
+			opts.BackingSession = cmp.Or(reattach, newBackingName(name))
+		}
+		if identityFile != "" {
+			if opts.IdentityFile, err = resolveIdentityFile(identityFile); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		if c, err = sshCommand(&opts); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		sshOpts = &opts
+	}
+	setTerm(c, term)
+	if host == "local" {
+		setEnv(c, env)
+	}
+
+	if args.GetBool("dry_run", false) {
+		if wantJSON(args) {
+			return jsonResult(dryRunResult{Host: host, Command: c.Args, Transport: transport}), nil
+		}
+		if sshOpts != nil && transport == TransportNative {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run, no session started. Would connect to %s with the built-in SSH client.", sshOpts.Destination())), nil
+		}
+		if isSerial {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run, no session started. Would open %s at %d baud.", serial.Device, serial.Baud)), nil
+		}
+		if isTelnet {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run, no session started. Would connect to %s with telnet.", telnetDest)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Dry run, no session started. Command:\n%s", shellQuoteArgs(c.Args))), nil
+	}
+
+	retries := args.GetInt("retries", 0)
+	if retries < 0 {
+		return mcp.NewToolResultError("retries must not be negative"), nil
+	}
+	if sshOpts == nil {
+		retries = 0 // Only ssh connections fail transiently
+	}
+	retryDelay := parseSeconds(args.GetString("retry_delay", ""), 2*time.Second)
+
+	var sess *Session
+	var ready, initialOutput string
+	attempts := 0
+	for {
+		attempts++
+		if attempts > 1 {
+			if c.Path != "" {
+				c = cloneCmd(c)
+			}
+			throttle, _ = newOutputThrottle(args.GetString("output_filter", FilterNone), args.GetInt("max_lines_per_sec", 200))
+		}
+
+		// Start PTY, or connect with the built-in client
+		ptmx, native, telnet, err := openSession(host, c, sshOpts, term, rows, cols)
+		if err != nil {
+			// The native client reports connection failures here rather than as output
+			if attempts <= retries && retryableSSHError(err.Error()) {
+				logger.Info("retrying connection", "host", host, "attempt", attempts, "delay", retryDelay)
+				select {
+				case <-time.After(retryDelay):
+					continue
+				case <-ctx.Done():
+				}
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to start session: %v", err)), nil
+		}
+
+		// Create Session
+		sess = &Session{
+			name:          name,
+			Tags:          tags,
+			Host:          host,
+			SSH:           sshOpts,
+			Term:          term,
+			Command:       command,
+			PodContainer:  podContainer,
+			Env:           env,
+			Cmd:           c,
+			Ptmx:          ptmx,
+			CreatedAt:     time.Now(),
+			throttle:      throttle,
+			writeChunk:    writeChunk,
+			writeDelay:    writeDelay,
+			stripANSI:     args.GetBool("strip_ansi", false),
+			keepAlive:     args.GetBool("keep_alive", false),
+			autoReconnect: autoReconnect,
+			restoreCwd:    restoreCwd,
+			notifyOutput:  args.GetBool("notify_output", config.NotifyOutput),
+			readOnly:      config.ReadOnly || args.GetBool("read_only", false),
+			transcript:    newTranscript(),
+			rows:          rows,
+			cols:          cols,
+			done:          make(chan struct{}),
+			exited:        make(chan struct{}),
+			native:        native,
+			telnet:        telnet,
+		}
+
+		if err := manager.Add(sess); err != nil {
+			sess.Close()
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		sess.transcript.open(sess)
+		auditSession(ctx, sess)
+
+		// Start background reader
+		go sess.startReader()
+
+		// Wait for the initial banner/login output
+		if fixed := args.GetString("initial_wait", ""); fixed != "" {
+			time.Sleep(parseSeconds(fixed, time.Second))
+			ready = readyFixed
+		} else {
+			quiet := parseSeconds(args.GetString("ready_quiet", ""), 300*time.Millisecond)
+			timeout := parseSeconds(args.GetString("ready_timeout", ""), 10*time.Second)
+			ready = waitReady(sess, promptRe, quiet, timeout)
+		}
+		initialOutput = sess.ReadAndClear()
+		sess.notePrompt(initialOutput, cmp.Or(promptRe, defaultPromptRe))
+
+		// Check if process exited immediately (e.g. connection error)
+		select {
+		case <-sess.exited:
+			manager.Remove(sess.ID)
+			if attempts <= retries && retryableSSHError(initialOutput) {
+				logger.Info("retrying connection", "host", host, "attempt", attempts, "delay", retryDelay)
+				select {
+				case <-time.After(retryDelay):
+					continue
+				case <-ctx.Done():
+				}
+			}
+			if wantJSON(args) {
+				result := jsonResult(startResult{SessionID: sess.ID, Name: name, Host: host, InitialOutput: initialOutput, Exited: true, Ready: readyExited, Attempts: attempts})
+				result.IsError = true
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Session started but exited immediately (SSH error?) after %s:\n%s", pluralAttempts(attempts), initialOutput)), nil
+		default:
+			// Session is healthy
+		}
+		break
+	}
+
+	sessID := sess.ID
+
+	newHostKeys := execNewHostKeys(sshOpts, initialOutput)
+	if sess.native != nil {
+		newHostKeys = sess.native.newHostKeys
+	}
+
+	// Advise (without failing) when this host already has a live session
+	var warning string
+	var existing []string
+	if sshOpts != nil {
+		for _, other := range manager.ConnectedTo(sshOpts.Destination()) {
+			if other != sess {
+				existing = append(existing, other.ID)
+			}
+		}
+		if len(existing) > 0 {
+			warning = fmt.Sprintf("Already connected to %s in session(s) %s; consider reusing one instead of opening another connection.",
+				sshOpts.Destination(), strings.Join(existing, ", "))
+		}
+	}
+
+	if wantJSON(args) {
+		return jsonResult(startResult{SessionID: sessID, Name: name, Host: host, InitialOutput: initialOutput, Ready: ready, Attempts: attempts, Warning: warning, ExistingSessions: existing, NewHostKeys: newHostKeys}), nil
+	}
+	if ready == readyTimeout {
+		initialOutput += "\n[Timed out waiting for the login to settle; the session may still be connecting]"
+	}
+
+	var notes string
+	if warning != "" {
+		notes += "\nWarning: " + warning
+	}
+	if attempts > 1 {
+		notes += fmt.Sprintf("\nConnected after %s.", pluralAttempts(attempts))
+	}
+	for _, key := range newHostKeys {
+		notes += "\nNew host key accepted and recorded: " + key
+	}
+	if sshOpts != nil && sshOpts.Backing != "" {
+		notes += fmt.Sprintf("\nRunning inside %s session %s.", sshOpts.Backing, sshOpts.BackingSession)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Session started. ID: %s%s\n\nOutput:\n%s", sess.Label(), notes, initialOutput)), nil
+}
+
+// pluralAttempts formats an attempt count for messages ("1 attempt", "3 attempts").
+func pluralAttempts(n int) string {
+	if n == 1 {
+		return "1 attempt"
+	}
+	return fmt.Sprintf("%d attempts", n)
+}
+
+func interactSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessID := args.GetString("session_id", "")
+	input := args.GetString("input", "")
+	sendEOF := args.GetBool("send_eof", false)
+	noEcho := args.GetBool("strip_echo", false)
+	lineMode := args.GetBool("line_mode", false)
+	clear := args.GetBool("clear", true)
+	sinceOffset := int64(args.GetInt("since_offset", -1))
+	sudoPassword := args.GetString("sudo_password", "")
+	maxOutput := args.GetInt("max_output_bytes", config.MaxOutputBytes)
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	commandTimeout, err := parseWait("command_timeout", args.GetString("command_timeout", ""), 0)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	anchorMode := args.GetString("anchor", AnchorNone)
+	switch anchorMode {
+	case AnchorNone, AnchorPrompt, AnchorSeparator:
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid anchor %q (want %s, %s or %s)", anchorMode, AnchorNone, AnchorPrompt, AnchorSeparator)), nil
+	}
+	binaryEncoding := args.GetString("binary_encoding", EncodingBase64)
+	if !validBinaryEncoding(binaryEncoding) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid binary_encoding %q (want %s, %s or %s)", binaryEncoding, EncodingBase64, EncodingHex, EncodingNone)), nil
+	}
+	promptRe := defaultPromptRe
+	if expr := args.GetString("prompt_regex", ""); expr != "" {
+		if promptRe, err = regexp.Compile(expr); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid prompt_regex: %v", err)), nil
+		}
+	}
+	expectRe, err := expectPattern(args.GetString("expect", ""), args.GetString("expect_regex", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if expectRe != nil {
+		if commandTimeout > 0 {
+			return mcp.NewToolResultError("Pass either expect/expect_regex or command_timeout, not both"), nil
+		}
+		if args.GetString("wait_duration", "") == "" {
+			waitDuration = defaultStepTimeout
+		}
+	}
+	if !clear && (expectRe != nil || commandTimeout > 0) {
+		return mcp.NewToolResultError("clear=false can't be combined with expect/expect_regex or command_timeout, which read as they wait"), nil
+	}
+	if sinceOffset >= 0 && (expectRe != nil || commandTimeout > 0) {
+		return mcp.NewToolResultError("since_offset can't be combined with expect/expect_regex or command_timeout, which read as they wait"), nil
+	}
+
+	if path := args.GetString("input_file", ""); path != "" {
+		if input != "" {
+			return mcp.NewToolResultError("Pass either input or input_file, not both"), nil
+		}
+		data, err := readInputFile(path)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		input = string(data)
+	}
+
+	sess, ok := manager.Lookup(sessID)
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	var reconnectErr error
+	if sess.autoReconnect && sess.connectionLost() {
+		if fresh, err := autoReconnect(ctx, sess); err != nil {
+			reconnectErr = err
+			logger.Warn("automatic reconnect failed", "session_id", sess.ID, "err", err)
+		} else {
+			sess = fresh
+		}
+	}
+	// command_timeout may type Ctrl+C, and sudo_password the password
+	if input != "" || sendEOF || commandTimeout > 0 || sudoPassword != "" {
+		if err := sess.checkWritable(); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	if end := sess.OutputOffset(); sinceOffset > end {
+		return mcp.NewToolResultError(fmt.Sprintf("since_offset %d is past the end of the output (%d)", sinceOffset, end)), nil
+	}
+	// read reads the output as asked: from since_offset, or the buffer
+	var next, sinceLost int64
+	read := func(lineMode bool) string {
+		var out string
+		if sinceOffset >= 0 {
+			out, next, sinceLost = sess.ReadSince(sinceOffset, lineMode)
+		} else {
+			out, next = sess.read(clear, lineMode)
+		}
+		return out
+	}
+	// takeLost returns how much output before what was read was dropped
+	takeLost := func() int64 {
+		switch {
+		case sinceOffset >= 0:
+			return sinceLost
+		case clear:
+			return sess.TakeDropped()
+		}
+		return 0 // Peeking leaves it for the next read
+	}
+
+	// Check if process is alive
+	select {
+	case <-sess.exited:
+		output := read(false) // Read any remaining output
+		var hint string
+		if sess.restored {
+			// Saved entries stay until revived or explicitly closed
+			hint = "\n[Use reconnect_session to revive it, or close_session to discard it]"
+		} else if shellRestartable(sess) {
+			// Keep them registered so restart_shell can bring them back
+			// under the same ID; just release the terminal
+			sess.Close()
+			hint = "\n[Use restart_shell to relaunch the shell, or close_session to discard it]"
+		} else if sess.autoReconnect && sess.connectionLost() {
+			// Stays registered so the next call tries again
+			why := "the connection dropped again"
+			if reconnectErr != nil {
+				why = reconnectErr.Error()
+			}
+			hint = fmt.Sprintf("\n[Reconnecting failed (%s); the next interact_session tries again, or use close_session to discard it]", why)
+		} else {
+			manager.Remove(sess.ID) // Cleanup
+		}
+		bytesRead := len(output)
+		output, dropped := truncateOutput(output, maxOutput)
+		output, encoding := encodeOutput(output, binaryEncoding)
+		lost := takeLost()
+		result := interactResult{Output: output, Encoding: encoding, Exited: true, DeadReason: sess.DeadReason(), ExitCode: sess.ExitCode(), Bytes: bytesRead, Truncated: dropped > 0, DroppedBytes: dropped, BufferDroppedBytes: lost, NextOffset: next}
+		if wantJSON(args) {
+			return structuredJSONResult(result), nil
+		}
+		return mcp.NewToolResultStructured(result, fmt.Sprintf("[Session exited: %s]\nRemaining Output:\n%s%s", sess.ExitSummary(), withEncodingMarker(withBufferDropMarker(withTruncationMarker(output, dropped), lost), encoding), hint)), nil
+	default:
+	}
+
+	if err := checkInputAllowed(ctx, sess.ID, input); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := sess.checkContinuedInput(ctx, input); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	anchorPrompt := sess.Prompt() // Where this input is typed
+	inputOffset := sess.OutputOffset()
+	// Once a command is entered, its end shows as the prompt coming back
+	entered := strings.HasSuffix(input, "\n") || strings.HasSuffix(input, "\r")
+	waitPrompt := entered && anchorPrompt != "" && args.GetBool("wait_for_prompt", true)
+	if input != "" {
+		chunk := args.GetInt("write_chunk_size", sess.writeChunk)
+		delay := parseSeconds(args.GetString("write_chunk_delay", ""), cmp.Or(sess.writeDelay, defaultWriteChunkDelay))
+		if err := sess.WritePaced([]byte(input), chunk, delay); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+		}
+	}
+	if sendEOF {
+		if err := sess.SendEOF(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+		}
+	}
+
+	var output string
+	var timedOut, promptSeen bool
+	var matched *bool
+	var killed string
+	var awaiting *awaitingInput
+	limit := waitDuration // For progress reports on long waits
+	if commandTimeout > 0 {
+		limit = commandTimeout + maxInterruptWait
+	}
+	defer reportProgress(ctx, args, sess, limit)()
+	if expectRe != nil {
+		if sudoPassword != "" {
+			if err := answerSudoPrompt(sess, sudoPassword, min(config.DefaultWait, waitDuration)); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+			}
+		}
+		var ok bool
+		output, ok = waitForPattern(ctx, sess, expectRe, waitDuration)
+		matched = &ok
+	} else if commandTimeout > 0 {
+		if sudoPassword != "" {
+			if err := answerSudoPrompt(sess, sudoPassword, min(waitDuration, commandTimeout)); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+			}
+		}
+		output, timedOut, killed, awaiting = waitOrInterrupt(ctx, sess, promptRe, inputOffset, commandTimeout)
+	} else {
+		// wait_duration=0 is a fire-and-forget fast path: skip the wait
+		// entirely and return whatever is already buffered
+		if waitDuration > 0 && sudoPassword != "" {
+			start := time.Now()
+			if err := answerSudoPrompt(sess, sudoPassword, waitDuration); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+			}
+			sess.waitOrExit(ctx, waitDuration-time.Since(start))
+		} else if waitDuration > 0 && waitPrompt {
+			promptSeen = sess.waitForPrompt(ctx, inputOffset, anchorPrompt, max(strings.Count(input, "\n"), 1), waitDuration)
+		} else if waitDuration > 0 {
+			sess.waitOrExit(ctx, waitDuration)
+		}
+
+		output = read(lineMode)
+	}
+	if expectRe != nil || commandTimeout > 0 {
+		next = sess.UnreadOffset() // Where their reads got to
+	}
+	if args.GetBool("strip_ansi", sess.stripANSI) {
+		output = stripANSI(output)
+	}
+	if noEcho {
+		output = stripEcho(output, input)
+	}
+	if sudoPassword != "" {
+		output = strings.ReplaceAll(output, sudoPassword, "********")
+	}
+	sess.notePrompt(output, promptRe)
+	exited := !sess.Alive()
+	if exited {
+		sess.reap() // Wait for the exit code; the process is already gone
+	}
+	stillArriving := !exited && !promptSeen && commandTimeout == 0 && expectRe == nil && output != "" && outputStillArriving(sess.LastOutput(), waitDuration)
+	if !exited && !stillArriving && !timedOut {
+		awaiting = detectInputPrompt(output)
+	}
+	bytesRead := len(output)
+	output, dropped := truncateOutput(output, maxOutput)
+	output, encoding := encodeOutput(output, binaryEncoding)
+	lost := takeLost()
+	result := interactResult{Output: output, Encoding: encoding, SessionAlive: !exited, Exited: exited, DeadReason: sess.DeadReason(), ExitCode: sess.ExitCode(), Bytes: bytesRead, Truncated: dropped > 0, DroppedBytes: dropped, OutputStillArriving: stillArriving, TimedOut: timedOut, Killed: killed, Matched: matched, BufferDroppedBytes: lost, Peeked: !clear && sinceOffset < 0, NextOffset: next, AwaitingInput: awaiting}
+	if anchorMode == AnchorPrompt {
+		result.Prompt = anchorPrompt
+	}
+	if wantJSON(args) {
+		return structuredJSONResult(result), nil
+	}
+	if output == "" && input == "" && !sendEOF {
+		output = "(No new output)"
+	}
+	if !clear && sinceOffset < 0 {
+		output = "[Peeked; the output is still buffered]\n" + output
+	}
+	output = withEncodingMarker(withBufferDropMarker(withTruncationMarker(output, dropped), lost), encoding)
+	switch {
+	case anchorMode == AnchorPrompt && anchorPrompt != "":
+		if noEcho {
+			anchorPrompt += "\n" // The echoed input no longer ends the line
+		}
+		output = anchorPrompt + output
+	case anchorMode != AnchorNone:
+		output = fmt.Sprintf("----- %s @ %s -----\n%s", sess.Label(), time.Now().Format(time.TimeOnly), output)
+	}
+	if stillArriving {
+		output += "\n[Output still arriving; call again to read more]"
+	}
+	if awaiting != nil {
+		output += "\n" + awaitingNote(awaiting, timedOut)
+	}
+	if sinceOffset >= 0 {
+		output += fmt.Sprintf("\n[Next offset: %d]", next)
+	}
+	if timedOut {
+		output += "\n" + timeoutNote(commandTimeout, killed)
+	}
+	if matched != nil && !*matched && !exited {
+		output += fmt.Sprintf("\n[Expected pattern not seen within %s]", waitDuration)
+	}
+	if exited {
+		output += fmt.Sprintf("\n[Session exited during interaction: %s]", sess.ExitSummary())
+	}
+
+	return mcp.NewToolResultStructured(result, output), nil
+}
+
+// Output anchors for interact_session.
+const (
+	AnchorNone      = "none"
+	AnchorPrompt    = "prompt"
+	AnchorSeparator = "separator"
+)
+
+// notePrompt remembers the last line of output as the session's current
+// prompt if it looks like one.
+func (s *Session) notePrompt(output string, re *regexp.Regexp) {
+	line := output[strings.LastIndexByte(output, '\n')+1:]
+	line = strings.TrimLeft(line, "\r")
+	if line == "" || !re.MatchString(line) {
+		return
+	}
+	// A continuation prompt (PS2) or a prompt shown twice, after input typed
+	// ahead of the first, isn't the shell's own
+	shown := shownLine(line)
+	if strings.TrimSpace(shown) == ">" || shown[:len(shown)/2] == shown[len(shown)/2:] {
+		return
+	}
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	s.prompt = line
+}
+
+// Prompt returns the last prompt seen, or "" if none has been recognized.
+func (s *Session) Prompt() string {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.prompt
+}
+
+// readInputFile reads a file to send as session input, refusing anything
+// that isn't a regular file or exceeds the configured size cap.
+func readInputFile(path string) ([]byte, error) {
+	// Reading server files is local access too; in gateway mode it could
+	// ship the server's own secrets to a remote host
+	if err := checkLocalAllowed(); err != nil {
+		return nil, fmt.Errorf("input_file is unavailable: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("input_file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("input_file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("input_file %s is not a regular file", path)
+	}
+	if info.Size() > int64(config.MaxInputFile) {
+		return nil, fmt.Errorf("input_file %s is %d bytes, over the %d byte limit", path, info.Size(), config.MaxInputFile)
+	}
+	// Read through a limit too, in case the file grows after the Stat
+	data, err := io.ReadAll(io.LimitReader(f, int64(config.MaxInputFile)+1))
+	if err != nil {
+		return nil, fmt.Errorf("input_file: %w", err)
+	}
+	if len(data) > config.MaxInputFile {
+		return nil, fmt.Errorf("input_file %s is over the %d byte limit", path, config.MaxInputFile)
+	}
+	return data, nil
+}
+
+// stripEcho removes the terminal's echo of input from the start of output.
+// Lines are matched in order and stripping stops at the first line that
+// wasn't echoed verbatim, so program output is never removed.
+func stripEcho(output, input string) string {
+	for _, line := range strings.Split(strings.TrimRight(input, "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		rest, ok := strings.CutPrefix(output, line)
+		if !ok {
+			break
+		}
+		if r, ok := strings.CutPrefix(rest, "\r\n"); ok {
+			rest = r
+		} else if r, ok := strings.CutPrefix(rest, "\n"); ok {
+			rest = r
+		} else if rest != "" {
+			break // Echo of a longer line that merely starts with this one
+		}
+		output = rest
+	}
+	return output
+}
+
+// truncateOutput keeps the last max bytes of output (the tail is usually the
+// relevant part), never splitting a UTF-8 character. It returns the kept text
+// and how many bytes were dropped. A max of 0 or less disables truncation.
+func truncateOutput(output string, max int) (string, int) {
+	if max <= 0 || len(output) <= max {
+		return output, 0
+	}
+	start := len(output) - max
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return output[start:], start
+}
+
+// withTruncationMarker prefixes output with a note when bytes were dropped.
+func withTruncationMarker(output string, dropped int) string {
+	if dropped == 0 {
+		return output
+	}
+	return fmt.Sprintf("[truncated %d bytes, showing last %d bytes]\n%s", dropped, len(output), output)
+}
+
+// withBufferDropMarker prefixes output with a note when unread output was
+// discarded because the session buffer overflowed.
+func withBufferDropMarker(output string, lost int64) string {
+	if lost == 0 {
+		return output
+	}
+	return fmt.Sprintf("[%d bytes of earlier output were discarded: the session buffer keeps the last %d bytes (MCPSSH_MAX_BUFFER_BYTES)]\n%s", lost, config.MaxBufferBytes, output)
+}
+
+// sudoPromptRe matches sudo's default password prompt.
+var sudoPromptRe = regexp.MustCompile(`\[sudo\] password for [^\r\n]*:`)
+
+// answerSudoPrompt watches the pending output for up to d and types password
+// the first time a sudo prompt appears. It answers at most once, so a wrong
+// password is not retried until sudo locks the account.
+func answerSudoPrompt(sess *Session, password string, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		if sudoPromptRe.MatchString(sess.Peek()) {
+			return sess.WriteSecret([]byte(password+"\n"), "sudo password")
+		}
+		if !time.Now().Before(deadline) || !sess.Alive() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// arrivalWindow is how close to the end of a wait output must have arrived
+// for the command to be considered still producing.
+const arrivalWindow = 200 * time.Millisecond
+
+// outputStillArriving reports whether output was still growing when a wait
+// of the given length ended, i.e. the last bytes arrived in its tail end.
+func outputStillArriving(lastOutput time.Time, wait time.Duration) bool {
+	if lastOutput.IsZero() {
+		return false
+	}
+	window := min(arrivalWindow, wait/2)
+	return time.Since(lastOutput) <= window
+}
+
+// parseWaitDuration parses a wait_duration in seconds, defaulting to
+// config.DefaultWait (0.5s unless configured).
+func parseWaitDuration(secs string) (time.Duration, error) {
+	return parseWait("wait_duration", secs, config.DefaultWait)
+}
+
+// parseWait parses a wait given in (possibly fractional) seconds for the
+// argument name, returning def if secs is empty. Unlike parseSeconds it
+// rejects typos and negative values instead of falling back, and clamps to
+// the configured maximum so a bogus value can't hang a handler.
+func parseWait(name, secs string, def time.Duration) (time.Duration, error) {
+	secs = strings.TrimSpace(secs)
+	if secs == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(secs, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s %q: want a number of seconds (e.g. 0.5)", name, secs)
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %s", name, secs)
+	}
+	if f >= config.MaxWait.Seconds() {
+		return config.MaxWait, nil
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// parseSeconds parses a duration given in (possibly fractional) seconds,
+// returning def if secs is empty or invalid.
+func parseSeconds(secs string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(secs + "s")
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// Readiness conditions reported by start_session.
+const (
+	readyExited  = "exited"
+	readyPrompt  = "prompt"
+	readyQuiet   = "quiet"
+	readyTimeout = "timeout"
+	readyFixed   = "fixed"
+)
+
+// waitReady waits for a new session to settle. It returns as soon as the
+// process exits, promptRe matches the pending output, or (without promptRe)
+// output has arrived and then been quiet for quiet, bounded by timeout.
+func waitReady(sess *Session, promptRe *regexp.Regexp, quiet, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !sess.Alive() {
+			return readyExited
+		}
+		if promptRe != nil {
+			if promptRe.MatchString(sess.Peek()) {
+				return readyPrompt
+			}
+		} else if last := sess.LastOutput(); !last.IsZero() && time.Since(last) >= quiet {
+			return readyQuiet
+		}
+		if !time.Now().Before(deadline) {
+			return readyTimeout
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+type broadcastResult struct {
+	SessionID string `json:"session_id"`
+	Output    string `json:"output"`
+	Exited    bool   `json:"exited"`
+	Error     string `json:"error,omitempty"`
+}
+
+func broadcastHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	targets := args.GetStringSlice("session_ids", nil)
+	input := args.GetString("input", "")
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if tag := args.GetString("tag", ""); tag != "" {
+		targets = append(targets, manager.Tagged(tag)...)
+	}
+	if len(targets) == 0 {
+		return mcp.NewToolResultError("No sessions selected: pass session_ids or a tag matching at least one session"), nil
+	}
+	if err := checkInputAllowed(ctx, strings.Join(targets, ","), input); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Results are keyed by the target as given so the caller can match them up
+	results := make(map[string]*broadcastResult, len(targets))
+	targetOf := make(map[string]string, len(targets)) // session ID -> first target naming it
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		if _, dup := results[target]; dup {
+			continue
+		}
+		res := &broadcastResult{}
+		results[target] = res
+
+		sess, ok := manager.Lookup(target)
+		if !ok {
+			res.Error = "Session not found"
+			continue
+		}
+		res.SessionID = sess.ID
+		if first, dup := targetOf[sess.ID]; dup {
+			res.Error = fmt.Sprintf("Same session as %s", first)
+			continue
+		}
+		targetOf[sess.ID] = target
+		if err := sess.checkWritable(); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		if err := sess.checkContinuedInput(ctx, input); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sess.autoReconnect && sess.connectionLost() {
+				fresh, err := autoReconnect(ctx, sess)
+				if err != nil {
+					res.Error = fmt.Sprintf("Reconnect failed: %v", err)
+					return
+				}
+				sess = fresh
+			}
+			if !sess.Alive() {
+				res.Output = sess.ReadAndClear()
+				res.Exited = true
+				// Kept registered on the same terms as by interact_session
+				switch {
+				case sess.restored, sess.autoReconnect && sess.connectionLost():
+				case shellRestartable(sess):
+					sess.Close() // For restart_shell to relaunch
+				default:
+					manager.Remove(sess.ID)
+				}
+				return
+			}
+			if err := sess.Write([]byte(input)); err != nil {
+				res.Error = fmt.Sprintf("Write error: %v", err)
+				return
+			}
+			res.Exited = sess.waitOrExit(ctx, waitDuration)
+			res.Output, _ = truncateOutput(sess.ReadAndClear(), config.MaxOutputBytes)
+		}()
+	}
+	wg.Wait()
+
+	if wantJSON(args) {
+		return jsonResult(results), nil
+	}
+
+	var b strings.Builder
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		res := results[target]
+		fmt.Fprintf(&b, "=== %s ===\n", target)
+		switch {
+		case res.Error != "":
+			fmt.Fprintf(&b, "[Error: %s]\n", res.Error)
+		case res.Exited:
+			fmt.Fprintf(&b, "[Session exited]\n%s\n", res.Output)
+		default:
+			fmt.Fprintf(&b, "%s\n", res.Output)
+		}
+	}
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+func closeSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessID := args.GetString("session_id", "")
+	sess, ok := manager.Lookup(sessID)
+	if !ok {
+		return mcp.NewToolResultText("Session closed"), nil
+	}
+	var note string
+	if sess.SSH != nil && sess.SSH.Backing != "" {
+		if args.GetBool("keep_backing", false) {
+			note = fmt.Sprintf(" (%s session %s left running)", sess.SSH.Backing, sess.SSH.BackingSession)
+		} else if err := runRemote(sess, sess.SSH.backingKillCommand(), nil, io.Discard); err != nil {
+			note = fmt.Sprintf(" (failed to end %s session %s: %v)", sess.SSH.Backing, sess.SSH.BackingSession, err)
+		}
+	}
+	manager.Remove(sess.ID)
+	return mcp.NewToolResultText("Session closed" + note), nil
+}
+
+func closeAllSessionsHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	closed := manager.RemoveAll(args.GetString("tag", ""))
+	return mcp.NewToolResultText(fmt.Sprintf("Closed %d session(s)", closed)), nil
+}
+
+// parseTags trims tags, dropping duplicates and rejecting empty ones.
+func parseTags(raw []string) ([]string, error) {
+	var tags []string
+	for _, t := range raw {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags, nil
+}
+
+func addTagHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	tag := strings.TrimSpace(args.GetString("tag", ""))
+	if tag == "" {
+		return mcp.NewToolResultError("Tag argument is required"), nil
+	}
+	if err := manager.AddTag(sess.ID, tag); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Session %s tags: %s", sess.ID, strings.Join(manager.TagsOf(sess), ", "))), nil
+}
+
+func removeTagHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	tag := strings.TrimSpace(args.GetString("tag", ""))
+	removed, err := manager.RemoveTag(sess.ID, tag)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !removed {
+		return mcp.NewToolResultError(fmt.Sprintf("Session %s has no tag %q", sess.ID, tag)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Session %s tags: %s", sess.ID, strings.Join(manager.TagsOf(sess), ", "))), nil
+}
+
+func renameSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessID := args.GetString("session_id", "")
+	name := args.GetString("name", "")
+
+	sess, ok := manager.Lookup(sessID)
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if err := manager.Rename(sess.ID, name); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if name == "" {
+		return mcp.NewToolResultText(fmt.Sprintf("Session %s name cleared", sess.ID)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Session %s renamed to %s", sess.ID, name)), nil
+}
+
+// maxTailLines bounds tail_session so a single call stays a bounded view.
+const maxTailLines = 1000
+
+func tailSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	n := args.GetInt("lines", 20)
+	if n <= 0 || n > maxTailLines {
+		return mcp.NewToolResultError(fmt.Sprintf("lines must be between 1 and %d", maxTailLines)), nil
+	}
+
+	lines := sess.Tail(n)
+	if len(lines) == 0 {
+		return mcp.NewToolResultText("(No complete lines buffered)"), nil
+	}
+	text := strings.Join(lines, "\n")
+	if args.GetBool("strip_ansi", sess.stripANSI) {
+		text = stripANSI(text)
+	}
+	if len(lines) < n {
+		text = fmt.Sprintf("[Only %d complete lines buffered]\n%s", len(lines), text)
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+// defaultTerm is the terminal type advertised when start_session doesn't set
+// one; without it a service environment may leave TERM unset or "dumb",
+// which breaks line editing and full-screen programs.
+const defaultTerm = "xterm-256color"
+
+// validTermRe matches terminal type names (xterm-256color, screen.xterm, vt100).
+var validTermRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// setTerm sets TERM for the command, overriding any inherited value.
+func setTerm(c *exec.Cmd, term string) {
+	c.Env = append(c.Environ(), "TERM="+term) // Later entries win
+}
+
+// Default terminal size, and the largest accepted in either dimension.
+const (
+	defaultRows = 24
+	defaultCols = 80
+	maxTermSize = 1000
+)
+
+// checkTermSize validates a terminal size given as rows and cols.
+func checkTermSize(rows, cols int) error {
+	if rows < 1 || rows > maxTermSize || cols < 1 || cols > maxTermSize {
+		return fmt.Errorf("rows and cols must be between 1 and %d", maxTermSize)
+	}
+	return nil
+}
+
+// openSession starts the program for a session: c in a local PTY of the
+// given size, or for the native transport a built-in client connection to
+// opts. Serial and telnet hosts are opened or dialled directly.
+func openSession(host string, c *exec.Cmd, opts *SSHOptions, term string, rows, cols int) (*os.File, *nativeConn, *telnetConn, error) {
+	if opts != nil && opts.Transport == TransportNative {
+		ptmx, native, err := dialNative(opts, term, rows, cols)
+		return ptmx, native, nil, err
+	}
+	if isSerialHost(host) {
+		port, err := parseSerialHost(host)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		f, err := openSerial(port)
+		return f, nil, nil, err
+	}
+	if isTelnetHost(host) {
+		target, err := parseTelnetHost(host)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		ptmx, telnet, err := dialTelnet(target, term, rows, cols)
+		return ptmx, nil, telnet, err
+	}
+	ptmx, err := pty.StartWithSize(c, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+	return ptmx, nil, nil, err
+}
+
+// Resize changes the terminal size. The kernel sends SIGWINCH to the
+// foreground program (ssh passes it on to the remote PTY); native sessions
+// send the window change over the channel instead, and telnet sessions
+// report it if the server asked for window sizes.
+func (s *Session) Resize(rows, cols int) error {
+	var err error
+	if s.native != nil {
+		err = s.native.session.WindowChange(rows, cols)
+	} else if s.telnet != nil {
+		err = s.telnet.resize(rows, cols)
+	} else {
+		err = pty.Setsize(s.Ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+	}
+	if err != nil {
+		return err
+	}
+	s.transcript.resize(rows, cols)
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	s.rows, s.cols = rows, cols
+	return nil
+}
+
+// Size returns the terminal size as last set, or zeros if unknown.
+func (s *Session) Size() (rows, cols int) {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.rows, s.cols
+}
+
+// localShellCommand returns the command for a new local session: the user's
+// $SHELL, falling back to bash.
+func localShellCommand() *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/bash"
+	}
+	return exec.Command(shell)
+}
+
+// resolveLocalDir expands a leading ~/ in a local session's cwd, makes it
+// absolute and checks that it is a directory.
+func resolveLocalDir(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cwd: %v", err)
+		}
+		path = filepath.Join(home, rest)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("cwd: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cwd: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cwd %q is not a directory", path)
+	}
+	return path, nil
+}
+
+func restartShellHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	old, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !shellRestartable(old) {
+		return mcp.NewToolResultError("restart_shell doesn't apply to SSH sessions; use reconnect_session to revive one"), nil
+	}
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sess, err := relaunch(ctx, old, nil)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to restart shell: %v", err)), nil
+	}
+	if sess.waitOrExit(ctx, waitDuration) {
+		return mcp.NewToolResultError(fmt.Sprintf("Restarted shell exited immediately (%s):\n%s", sess.ExitSummary(), sess.ReadAndClear())), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Shell restarted. ID: %s\n\nOutput:\n%s", sess.Label(), sess.ReadAndClear())), nil
+}
+
+// shellRestartable reports whether restart_shell can relaunch sess: local,
+// container, pod, serial and telnet sessions can, while SSH sessions are
+// revived with reconnect_session.
+func shellRestartable(sess *Session) bool {
+	return sess.SSH == nil
+}
+
+func reconnectSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	old, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if old.Alive() {
+		return mcp.NewToolResultError("Session is still alive; close it first to force a reconnect"), nil
+	}
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sess, err := relaunch(ctx, old, nil)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to reconnect: %v", err)), nil
+	}
 	select {
 	case <-sess.exited:
-		output := sess.ReadAndClear() // Read any remaining output
-		manager.Remove(sessID)        // Cleanup
-		return mcp.NewToolResultText(fmt.Sprintf("[Session exited]\nRemaining Output:\n%s", output)), nil
-	default:
+	case <-time.After(waitDuration):
 	}
+	output := sess.ReadAndClear()
+	if !sess.Alive() {
+		// Stays registered (dead) so the reconnect can be retried
+		return mcp.NewToolResultError(fmt.Sprintf("Reconnected session exited immediately (%s):\n%s", sess.ExitSummary(), output)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Session reconnected. ID: %s\n\nOutput:\n%s", sess.Label(), output)), nil
+}
 
-	if input != "" {
-		_, err := sess.Ptmx.Write([]byte(input))
+// cloneCmd returns a command running the same program as c, with the same
+// arguments, environment and directory, as an exec.Cmd can only be started
+// once.
+func cloneCmd(c *exec.Cmd) *exec.Cmd {
+	next := exec.Command(c.Path, c.Args[1:]...)
+	next.Env = c.Env
+	next.Dir = c.Dir
+	return next
+}
+
+// relaunch starts a fresh process with the settings of a dead (or doomed)
+// session and swaps it in under the same ID, name and tags. Local sessions
+// rerun the same command line; SSH sessions rebuild the ssh command so
+// connection sharing and the current access rules apply. preface, if any,
+// is buffered ahead of the new process's output. A saved command is checked
+// again like start_session's, since the denylist or policy may have changed.
+func relaunch(ctx context.Context, old *Session, preface []byte) (*Session, error) {
+	if old.Command != nil {
+		if err := checkInputAllowed(ctx, old.ID, shellQuoteArgs(old.Command)); err != nil {
+			return nil, err
+		}
+	}
+	var c *exec.Cmd
+	var sshOpts *SSHOptions
+	if container, ok := dockerContainer(old.Host); ok {
+		if err := checkContainerAllowed(old.Host); err != nil {
+			return nil, err
+		}
+		var err error
+		if c, err = dockerCommand(container, old.Command, old.Env); err != nil {
+			return nil, err
+		}
+	} else if isSerialHost(old.Host) {
+		port, err := parseSerialHost(old.Host)
+		if err == nil {
+			err = checkSerialAllowed(port)
+		}
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+			return nil, err
+		}
+		c = &exec.Cmd{}
+	} else if isTelnetHost(old.Host) {
+		target, err := parseTelnetHost(old.Host)
+		if err == nil {
+			err = checkHostAllowed(target.Host)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c = &exec.Cmd{}
+	} else if _, _, ok := kubePod(old.Host); ok {
+		if err := checkContainerAllowed(old.Host); err != nil {
+			return nil, err
+		}
+		var err error
+		if c, err = kubeCommand(old.Host, old.PodContainer, cmp.Or(old.Term, defaultTerm), old.Command); err != nil {
+			return nil, err
+		}
+	} else if old.SSH == nil {
+		if err := checkLocalAllowed(); err != nil {
+			return nil, err
+		}
+		if old.Cmd != nil && old.Cmd.Path != "" {
+			c = cloneCmd(old.Cmd)
+		} else {
+			// Restored sessions keep only the command and directory
+			if old.Command != nil {
+				c = exec.Command(old.Command[0], old.Command[1:]...)
+			} else {
+				c = localShellCommand()
+			}
+			c.Dir = old.Cmd.Dir
+		}
+	} else {
+		if err := checkHostAllowed(old.SSH.Host); err != nil {
+			return nil, err
+		}
+		for _, spec := range old.SSH.JumpHosts {
+			if err := checkJumpHostAllowed(spec); err != nil {
+				return nil, err
+			}
+		}
+		opts := *old.SSH
+		opts.ConfigFile, opts.ControlPath, opts.ControlPersist = "", "", "" // Reapplied from the current config
+		var err error
+		if c, err = sshCommand(&opts); err != nil {
+			return nil, err
 		}
+		sshOpts = &opts
 	}
+	term := cmp.Or(old.Term, defaultTerm)
+	setTerm(c, term)
+	rows, cols := old.Size()
+	rows, cols = cmp.Or(rows, defaultRows), cmp.Or(cols, defaultCols)
 
-	// Parse wait duration
-	waitDuration, err := time.ParseDuration(waitSecStr + "s")
+	ptmx, native, telnet, err := openSession(old.Host, c, sshOpts, term, rows, cols)
 	if err != nil {
-		waitDuration = 500 * time.Millisecond
+		return nil, err
+	}
+	var throttle *outputThrottle
+	if old.throttle != nil {
+		throttle, _ = newOutputThrottle(old.throttle.mode, old.throttle.maxPerSec)
+	}
+	sess := &Session{
+		Host:          old.Host,
+		SSH:           sshOpts,
+		Term:          term,
+		Command:       old.Command,
+		PodContainer:  old.PodContainer,
+		Env:           old.Env, // Local and container shells get it back with the old environment
+		Cmd:           c,
+		Ptmx:          ptmx,
+		CreatedAt:     time.Now(),
+		throttle:      throttle,
+		writeChunk:    old.writeChunk,
+		writeDelay:    old.writeDelay,
+		stripANSI:     old.stripANSI,
+		keepAlive:     old.keepAlive,
+		readOnly:      old.readOnly || config.ReadOnly,
+		autoReconnect: old.autoReconnect,
+		notifyOutput:  old.notifyOutput,
+		restoreCwd:    old.restoreCwd,
+		cwd:           old.Cwd(),
+		transcript:    cmp.Or(old.transcript, newTranscript()), // Restored sessions have none yet
+		rows:          rows,
+		cols:          cols,
+		done:          make(chan struct{}),
+		exited:        make(chan struct{}),
+		native:        native,
+		telnet:        telnet,
+	}
+	sess.outputBuf.Write(preface) // Before anything else can see the session
+	if !manager.Replace(old, sess) {
+		sess.Close()
+		return nil, fmt.Errorf("session was closed concurrently")
 	}
-	time.Sleep(waitDuration)
+	metrics.sessionsCreated.Add(1)
+	sess.transcript.open(sess)
+	sess.transcript.note("session relaunched")
+	go sess.startReader()
+	return sess, nil
+}
 
-	output := sess.ReadAndClear()
-	if output == "" && input == "" {
-		output = "(No new output)"
+// maxClearNewlines bounds the newlines clear_buffer will send, since each one
+// may re-run an empty command line on the remote shell.
+const maxClearNewlines = 10
+
+func clearBufferHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	newlines := args.GetInt("newlines", 0)
+	if newlines < 0 || newlines > maxClearNewlines {
+		return mcp.NewToolResultError(fmt.Sprintf("newlines must be between 0 and %d", maxClearNewlines)), nil
+	}
+
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	dropped := sess.Clear()
+	msg := fmt.Sprintf("Discarded %d bytes of buffered output.", dropped)
+	if newlines == 0 {
+		return mcp.NewToolResultText(msg), nil
 	}
 
-	return mcp.NewToolResultText(output), nil
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("%s Session is dead (%s); not sending newlines.", msg, sess.DeadReason())), nil
+	}
+	if err := sess.checkWritable(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("%s Not sending newlines: %v", msg, err)), nil
+	}
+	if err := sess.Write([]byte(strings.Repeat("\n", newlines))); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("%s Write error: %v", msg, err)), nil
+	}
+	if sess.waitOrExit(ctx, waitDuration) {
+		return mcp.NewToolResultError(fmt.Sprintf("%s Session exited (%s):\n%s", msg, sess.ExitSummary(), sess.ReadAndClear())), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s\n\nOutput:\n%s", msg, sess.ReadAndClear())), nil
 }
 
-func closeSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func resizeSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason())), nil
+	}
+	rows, cols := sess.Size()
+	rows = args.GetInt("rows", cmp.Or(rows, defaultRows))
+	cols = args.GetInt("cols", cmp.Or(cols, defaultCols))
+	if err := checkTermSize(rows, cols); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := sess.Resize(rows, cols); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to resize: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Terminal resized to %dx%d.", cols, rows)), nil
+}
+
+func checkSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessID := args.GetString("session_id", "")
-	manager.Remove(sessID)
-	return mcp.NewToolResultText("Session closed"), nil
-}
\ No newline at end of file
+
+	sess, ok := manager.Lookup(sessID)
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+
+	status := "running"
+	if !sess.Alive() {
+		status = fmt.Sprintf("exited (%s)", sess.ExitSummary())
+	}
+	lastActive := sess.LastActive()
+
+	if wantJSON(args) {
+		return jsonResult(checkResult{
+			SessionID:     sess.ID,
+			Name:          sess.Name(),
+			Alive:         sess.Alive(),
+			DeadReason:    sess.DeadReason(),
+			ExitCode:      sess.ExitCode(),
+			LastActive:    lastActive,
+			IdleSeconds:   time.Since(lastActive).Seconds(),
+			BufferedBytes: sess.Buffered(),
+		}), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf(
+		"Session: %s\nStatus: %s\nLast activity: %s (idle %s)\nBuffered output: %d bytes",
+		sess.Label(), status, lastActive.Format(time.RFC3339), time.Since(lastActive).Round(time.Second), sess.Buffered(),
+	)), nil
+}
+
+func listSessionsHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessions := manager.List(args.GetString("tag", ""))
+
+	res := listResult{Sessions: make([]listEntry, 0, len(sessions))}
+	for _, sess := range sessions {
+		e := listEntry{
+			SessionID:   sess.ID,
+			Name:        sess.Name(),
+			Tags:        manager.TagsOf(sess),
+			Host:        sess.Host,
+			Destination: sess.Host,
+			CreatedAt:   sess.CreatedAt,
+			LastActive:  sess.LastActive(),
+			Alive:       sess.Alive(),
+			DeadReason:  sess.DeadReason(),
+		}
+		if sess.SSH != nil {
+			e.Destination = sess.SSH.Destination()
+		}
+		res.Sessions = append(res.Sessions, e)
+	}
+	if wantJSON(args) {
+		return jsonResult(res), nil
+	}
+
+	if len(res.Sessions) == 0 {
+		return mcp.NewToolResultText("No open sessions."), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d session(s):\n", len(res.Sessions))
+	for i, e := range res.Sessions {
+		status := "running"
+		if !e.Alive {
+			status = fmt.Sprintf("exited (%s)", sessions[i].ExitSummary())
+		}
+		fmt.Fprintf(&b, "\n- %s\n  Host: %s\n  Status: %s\n  Created: %s\n  Last activity: %s (idle %s)\n",
+			sessions[i].Label(), e.Destination, status, e.CreatedAt.Format(time.RFC3339),
+			e.LastActive.Format(time.RFC3339), time.Since(e.LastActive).Round(time.Second))
+		if len(e.Tags) > 0 {
+			fmt.Fprintf(&b, "  Tags: %s\n", strings.Join(e.Tags, ", "))
+		}
+	}
+	return mcp.NewToolResultText(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
+type describeResult struct {
+	SessionID      string    `json:"session_id"`
+	Name           string    `json:"name,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Host           string    `json:"host"`
+	User           string    `json:"user,omitempty"`
+	Port           int       `json:"port,omitempty"`
+	Command        []string  `json:"command"`
+	Program        []string  `json:"program,omitempty"` // Run instead of a shell
+	Transport      string    `json:"transport,omitempty"`
+	IdentityFile   string    `json:"identity_file,omitempty"`
+	JumpHosts      []string  `json:"jump_hosts,omitempty"`
+	HostKeyPolicy  string    `json:"host_key_policy,omitempty"`
+	AliveInterval  int       `json:"server_alive_interval,omitempty"`
+	AliveCountMax  int       `json:"server_alive_count_max,omitempty"`
+	Backing        string    `json:"backing,omitempty"`
+	BackingSession string    `json:"backing_session,omitempty"`
+	Term           string    `json:"term,omitempty"`
+	Dir            string    `json:"cwd,omitempty"`
+	Env            []string  `json:"env,omitempty"`           // Names only: the values may be secrets
+	DroppedBytes   int64     `json:"dropped_bytes,omitempty"` // Unread output lost to the buffer limit
+	KeepAlive      bool      `json:"keep_alive,omitempty"`
+	ReadOnly       bool      `json:"read_only,omitempty"`
+	AutoReconnect  bool      `json:"auto_reconnect,omitempty"`
+	RestoreCwd     bool      `json:"restore_cwd,omitempty"`
+	NotifyOutput   bool      `json:"notify_output,omitempty"`
+	RemoteDir      string    `json:"remote_cwd,omitempty"` // As the shell last reported it
+	Transcript     string    `json:"transcript,omitempty"`
+	LastUsed       time.Time `json:"last_used"`
+	Rows           int       `json:"rows,omitempty"`
+	Cols           int       `json:"cols,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActive     time.Time `json:"last_active"`
+	Alive          bool      `json:"alive"`
+	DeadReason     string    `json:"dead_reason,omitempty"`
+	ExitCode       *int      `json:"exit_code,omitempty"`
+	BufferedBytes  int       `json:"buffered_bytes"`
+}
+
+// describe gathers the session's metadata.
+func (s *Session) describe() describeResult {
+	d := describeResult{
+		SessionID:     s.ID,
+		Name:          s.Name(),
+		Tags:          manager.TagsOf(s),
+		Host:          s.Host,
+		Command:       s.Cmd.Args,
+		Program:       s.Command,
+		Term:          s.Term,
+		Dir:           s.Cmd.Dir,
+		Env:           slices.Sorted(maps.Keys(s.Env)),
+		CreatedAt:     s.CreatedAt,
+		LastActive:    s.LastActive(),
+		Alive:         s.Alive(),
+		DeadReason:    s.DeadReason(),
+		ExitCode:      s.ExitCode(),
+		BufferedBytes: s.Buffered(),
+		DroppedBytes:  s.DroppedTotal(),
+		KeepAlive:     s.keepAlive,
+		ReadOnly:      s.readOnly,
+		AutoReconnect: s.autoReconnect,
+		RestoreCwd:    s.restoreCwd,
+		NotifyOutput:  s.notifyOutput,
+		RemoteDir:     s.Cwd(),
+		Transcript:    s.transcript.Path(),
+		LastUsed:      s.LastUsed(),
+	}
+	if s.SSH != nil {
+		d.User = s.SSH.User
+		d.Port = s.SSH.Port
+		d.Transport = cmp.Or(s.SSH.Transport, TransportExec)
+		d.IdentityFile = s.SSH.IdentityFile
+		d.JumpHosts = s.SSH.JumpHosts
+		d.HostKeyPolicy = cmp.Or(s.SSH.HostKeyPolicy, HostKeyAcceptNew)
+		d.AliveInterval, d.AliveCountMax = s.SSH.AliveInterval, s.SSH.AliveCountMax
+		d.Backing, d.BackingSession = s.SSH.Backing, s.SSH.BackingSession
+	}
+	d.Rows, d.Cols = s.Size()
+	return d
+}
+
+func describeSessionHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+
+	d := sess.describe()
+	if wantJSON(args) {
+		return jsonResult(d), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session: %s\n", d.SessionID)
+	if d.Name != "" {
+		fmt.Fprintf(&b, "Name: %s\n", d.Name)
+	}
+	if len(d.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(d.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "Host: %s\n", d.Host)
+	if d.User != "" {
+		fmt.Fprintf(&b, "User: %s\n", d.User)
+	}
+	if d.Port != 0 {
+		fmt.Fprintf(&b, "Port: %d\n", d.Port)
+	}
+	if d.IdentityFile != "" {
+		fmt.Fprintf(&b, "Identity file: %s\n", d.IdentityFile)
+	}
+	if len(d.JumpHosts) > 0 {
+		fmt.Fprintf(&b, "Jump hosts: %s\n", strings.Join(d.JumpHosts, " -> "))
+	}
+	if d.HostKeyPolicy != "" {
+		fmt.Fprintf(&b, "Host key policy: %s\n", d.HostKeyPolicy)
+	}
+	if d.AliveInterval > 0 {
+		fmt.Fprintf(&b, "Keepalive: every %ds, dropped after %d unanswered\n", d.AliveInterval, cmp.Or(d.AliveCountMax, defaultAliveCountMax))
+	}
+	if d.Backing != "" {
+		fmt.Fprintf(&b, "Backing: %s session %s\n", d.Backing, d.BackingSession)
+	}
+	if d.Transport == TransportNative {
+		b.WriteString("Transport: native (built-in SSH client)\n")
+	} else if len(d.Command) > 0 {
+		fmt.Fprintf(&b, "Command: %s\n", strings.Join(d.Command, " "))
+	}
+	if len(d.Program) > 0 {
+		fmt.Fprintf(&b, "Program: %s\n", shellQuoteArgs(d.Program))
+	}
+	if d.Rows != 0 {
+		fmt.Fprintf(&b, "Terminal: %dx%d\n", d.Cols, d.Rows)
+	}
+	if d.Term != "" {
+		fmt.Fprintf(&b, "TERM: %s\n", d.Term)
+	}
+	if d.Dir != "" {
+		fmt.Fprintf(&b, "Directory: %s\n", d.Dir)
+	}
+	if len(d.Env) > 0 {
+		fmt.Fprintf(&b, "Environment: %s (values not shown)\n", strings.Join(d.Env, ", "))
+	}
+	fmt.Fprintf(&b, "Created: %s\n", d.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Last activity: %s\n", d.LastActive.Format(time.RFC3339))
+	if d.KeepAlive {
+		b.WriteString("Keep alive: yes (exempt from the idle timeout)\n")
+	}
+	if d.ReadOnly {
+		b.WriteString("Read-only: yes (input is rejected)\n")
+	}
+	if d.AutoReconnect {
+		b.WriteString("Auto-reconnect: yes")
+		if d.RestoreCwd {
+			b.WriteString(", back to the last reported directory")
+		}
+		b.WriteString("\n")
+	}
+	if d.NotifyOutput {
+		b.WriteString("Output notifications: yes\n")
+	}
+	if d.RemoteDir != "" {
+		fmt.Fprintf(&b, "Remote directory: %s (last reported)\n", d.RemoteDir)
+	}
+	if d.Transcript != "" {
+		fmt.Fprintf(&b, "Transcript: %s\n", d.Transcript)
+	}
+	if d.Alive {
+		b.WriteString("Status: running\n")
+	} else {
+		fmt.Fprintf(&b, "Status: exited (%s)\n", sess.ExitSummary())
+	}
+	fmt.Fprintf(&b, "Buffered output: %d bytes", d.BufferedBytes)
+	if d.DroppedBytes > 0 {
+		fmt.Fprintf(&b, " (%d unread bytes discarded by the buffer limit)", d.DroppedBytes)
+	}
+	return mcp.NewToolResultText(b.String()), nil
+}
@@ -1,36 +1,61 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
-	"os/exec"
+
 	"github.com/creack/pty"
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
-func TestSessionLocalInteraction(t *testing.T) {
-	// This test starts a local shell session to simulate SSH interaction
-	// and verifies read/write buffer logic.
+// startTestSession runs args in a PTY as a session registered under id, with
+// a "$ " prompt, and removes it when the test ends. An empty id lets the
+// manager pick one. The test is skipped where PTYs aren't available.
+func startTestSession(t testing.TB, id string, args ...string) *Session {
+	t.Helper()
+	return runTestSession(t, &Session{ID: id}, args...)
+}
 
-	// 1. Setup
-	cmd := exec.Command("/bin/sh")
+// runTestSession is startTestSession for a session with fields, such as an
+// output throttle, that must be in place before the reader starts.
+func runTestSession(t testing.TB, sess *Session, args ...string) *Session {
+	t.Helper()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(cmd.Environ(), "PS1=$ ")
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
-		t.Skipf("Skipping PTY test: %v", err) // Skip if environment doesn't support PTY
-	}
-	
-	sess := &Session{
-		ID:   "test-session",
-		Cmd:  cmd,
-		Ptmx: ptmx,
-		done: make(chan struct{}),
+		t.Skipf("Skipping PTY test: %v", err)
 	}
+	sess.Cmd = cmd
+	sess.Ptmx = ptmx
+	sess.done = make(chan struct{})
+	sess.exited = make(chan struct{})
 	go sess.startReader()
-	defer func() {
-		close(sess.done)
-		sess.Ptmx.Close()
-		sess.Cmd.Process.Kill()
-	}()
+	if err := manager.Add(sess); err != nil {
+		sess.Close()
+		t.Fatalf("Adding the session failed: %v", err)
+	}
+	t.Cleanup(func() { manager.Remove(sess.ID) })
+	return sess
+}
+
+func TestSessionLocalInteraction(t *testing.T) {
+	// This test starts a local shell session to simulate SSH interaction
+	// and verifies read/write buffer logic.
+
+	// 1. Setup
+	sess := startTestSession(t, "test-session", "/bin/sh")
 
 	// 2. Consume initial prompt (if any)
 	time.Sleep(500 * time.Millisecond)
@@ -38,7 +63,7 @@ func TestSessionLocalInteraction(t *testing.T) {
 
 	// 3. Send Command
 	input := "echo HelloGemini\n"
-	_, err = sess.Ptmx.Write([]byte(input))
+	_, err := sess.Ptmx.Write([]byte(input))
 	if err != nil {
 		t.Fatalf("Write failed: %v", err)
 	}
@@ -52,3 +77,997 @@ func TestSessionLocalInteraction(t *testing.T) {
 		t.Errorf("Expected output to contain 'HelloGemini', got:\n%s", output)
 	}
 }
+
+func TestSessionManagerNames(t *testing.T) {
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+
+	if err := sm.Add(&Session{ID: "id-1", name: "web"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := sm.Add(&Session{ID: "id-2", name: "web"}); err == nil {
+		t.Errorf("Expected duplicate name to be rejected")
+	}
+	if err := sm.Add(&Session{ID: "id-3"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if sess, ok := sm.Lookup("web"); !ok || sess.ID != "id-1" {
+		t.Errorf("Lookup by name failed: %v %v", sess, ok)
+	}
+	if sess, ok := sm.Lookup("id-3"); !ok || sess.ID != "id-3" {
+		t.Errorf("Lookup by ID failed: %v %v", sess, ok)
+	}
+	if _, ok := sm.Lookup(""); ok {
+		t.Errorf("Lookup of empty string should fail")
+	}
+
+	if err := sm.Rename("id-3", "web"); err == nil {
+		t.Errorf("Expected rename to a taken name to fail")
+	}
+	if err := sm.Rename("id-3", "id-1"); err == nil {
+		t.Errorf("Expected rename to another session's ID to fail")
+	}
+	if err := sm.Rename("id-3", "db"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if sess, ok := sm.Lookup("db"); !ok || sess.ID != "id-3" {
+		t.Errorf("Lookup after rename failed: %v %v", sess, ok)
+	}
+
+	// Old names and removed sessions must drop out of the name index.
+	if err := sm.Rename("id-1", "api"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, ok := sm.Lookup("web"); ok {
+		t.Errorf("Old name should no longer resolve after rename")
+	}
+	sm.Add(restoredSession(sessionRecord{ID: "id-4", Name: "scratch", Host: "local"})) // Dead, so safe to close
+	sm.Remove("id-4")
+	if _, ok := sm.Lookup("scratch"); ok {
+		t.Errorf("Name of a removed session should no longer resolve")
+	}
+	if err := sm.Add(&Session{ID: "id-5", name: "scratch"}); err != nil {
+		t.Errorf("Expected name of a removed session to be reusable: %v", err)
+	}
+}
+
+func TestSessionManagerMaxSessions(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.MaxSessions = 2
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+
+	sm.Add(restoredSession(sessionRecord{ID: "dead", Host: "local"})) // Dead sessions don't count
+	for _, id := range []string{"id-1", "id-2"} {
+		if err := sm.Add(&Session{ID: id}); err != nil {
+			t.Fatalf("Add %s failed: %v", id, err)
+		}
+	}
+	if err := sm.Add(&Session{ID: "id-3"}); err == nil || !strings.Contains(err.Error(), "limit of 2") {
+		t.Errorf("Expected the third live session to be refused, got %v", err)
+	}
+	if _, ok := sm.Get("id-3"); ok {
+		t.Errorf("Refused session should not be registered")
+	}
+}
+
+func TestSessionManagerEvictIdle(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.MaxSessions, config.EvictIdle = 2, true
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+	newSess := func(id string, lastUsed time.Duration, keepAlive bool) *Session {
+		sess := &Session{ID: id, Cmd: exec.Command("true"), CreatedAt: time.Now(), keepAlive: keepAlive, done: make(chan struct{}), exited: make(chan struct{})}
+		sess.lastUsed.Store(time.Now().Add(-lastUsed).UnixNano())
+		return sess
+	}
+
+	pinned := newSess("pinned", time.Hour, true) // Oldest, but keep_alive
+	stale := newSess("stale", time.Minute, false)
+	sm.Add(pinned)
+	sm.Add(stale)
+	if err := sm.Add(newSess("fresh", 0, false)); err != nil {
+		t.Fatalf("Expected the least recently used session to be evicted, got %v", err)
+	}
+	if _, ok := sm.Get("stale"); ok || stale.Alive() || stale.DeadReason() != evictedReason {
+		t.Errorf("Expected stale to be evicted and closed, got alive=%v reason=%q", stale.Alive(), stale.DeadReason())
+	}
+	if _, ok := sm.Get("pinned"); !ok {
+		t.Errorf("keep_alive session should not be evicted")
+	}
+
+	sm.Remove("fresh")
+	sm.Add(newSess("pinned-2", 0, true))
+	if err := sm.Add(newSess("another", 0, false)); err == nil || !strings.Contains(err.Error(), "none can be evicted") {
+		t.Errorf("Expected a refusal when every session is keep_alive, got %v", err)
+	}
+}
+
+func TestSessionSendEOF(t *testing.T) {
+	sess := startTestSession(t, "test-eof", "cat")
+
+	if err := sess.Write([]byte("hello eof\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := sess.SendEOF(); err != nil {
+		t.Fatalf("SendEOF failed: %v", err)
+	}
+
+	select {
+	case <-sess.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("cat did not exit after EOF")
+	}
+
+	output := sess.ReadAndClear()
+	// Echoed once by the terminal and once by cat itself
+	if strings.Count(output, "hello eof") != 2 {
+		t.Errorf("Expected input echoed and copied by cat, got:\n%q", output)
+	}
+}
+
+func TestSessionManagerTags(t *testing.T) {
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+	sm.Add(&Session{ID: "a", Tags: []string{"web"}})
+	sm.Add(&Session{ID: "b"})
+
+	if err := sm.AddTag("b", "web"); err != nil {
+		t.Fatalf("AddTag failed: %v", err)
+	}
+	sm.AddTag("b", "web") // Adding twice is a no-op
+	if got := len(sm.Tagged("web")); got != 2 {
+		t.Errorf("Expected 2 sessions tagged web, got %d", got)
+	}
+
+	if removed, err := sm.RemoveTag("a", "web"); err != nil || !removed {
+		t.Errorf("RemoveTag = %v, %v", removed, err)
+	}
+	if removed, _ := sm.RemoveTag("a", "web"); removed {
+		t.Errorf("Expected second RemoveTag to report nothing removed")
+	}
+	if got := sm.Tagged("web"); len(got) != 1 || got[0] != "b" {
+		t.Errorf("Expected only b tagged web, got %v", got)
+	}
+	if _, err := sm.RemoveTag("missing", "web"); err == nil {
+		t.Errorf("Expected error for unknown session")
+	}
+}
+
+// BenchmarkSessionThroughput pipes a few megabytes through a local PTY
+// session and measures how long the reader takes to drain it. Compare
+// read chunk sizes with MCPSSH_READ_BUFFER_SIZE.
+func BenchmarkSessionThroughput(b *testing.B) {
+	const size = 4 << 20
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		sess := startTestSession(b, "", "sh", "-c", "head -c 4194304 /dev/zero | tr '\\0' a")
+		<-sess.exited
+		if got := sess.Buffered(); got < size {
+			b.Fatalf("Expected at least %d bytes, got %d", size, got)
+		}
+		manager.Remove(sess.ID)
+	}
+}
+
+// BenchmarkConcurrentSessions runs interleaved interactions against many
+// sessions at once: each iteration resolves a session by name, as the tool
+// handlers do, writes a line and drains the output.
+func BenchmarkConcurrentSessions(b *testing.B) {
+	for _, n := range []int{8, 64, 256} {
+		b.Run(fmt.Sprintf("sessions=%d", n), func(b *testing.B) {
+			names := make([]string, n)
+			for i := range names {
+				sess := runTestSession(b, &Session{name: fmt.Sprintf("bench-%d", i)}, "cat")
+				names[i] = sess.Name()
+			}
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				line := []byte("ping\n")
+				for pb.Next() {
+					sess, ok := manager.Lookup(names[next.Add(1)%int64(n)])
+					if !ok {
+						b.Error("session not found")
+						return
+					}
+					sess.Write(line)
+					sess.ReadAndClear()
+					manager.TagsOf(sess)
+				}
+			})
+		})
+	}
+}
+
+func TestAnswerSudoPrompt(t *testing.T) {
+	sess := startTestSession(t, "test-sudo", "sh", "-c", `stty -echo; printf '[sudo] password for me: '; read pw; echo "got:$pw"; sleep 5`)
+
+	if err := answerSudoPrompt(sess, "s3cret", 2*time.Second); err != nil {
+		t.Fatalf("answerSudoPrompt failed: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if output := sess.ReadAndClear(); !strings.Contains(output, "got:s3cret") {
+		t.Errorf("Expected password to be typed at the prompt, got:\n%q", output)
+	}
+}
+
+func TestSessionDeadReason(t *testing.T) {
+	sess := startTestSession(t, "test-dead", "sleep", "30")
+
+	if reason := sess.DeadReason(); reason != "" {
+		t.Fatalf("Expected live session to have no reason, got %q", reason)
+	}
+
+	// Simulate the connection going away underneath us
+	sess.Cmd.Process.Kill()
+
+	select {
+	case <-sess.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Session was not marked dead after the child was killed")
+	}
+	if sess.Alive() {
+		t.Errorf("Expected session to report not alive")
+	}
+	if reason := sess.DeadReason(); reason != "EOF" {
+		t.Errorf("Expected reason EOF, got %q", reason)
+	}
+
+	// The reader reaps the process after marking it dead
+	deadline := time.Now().Add(3 * time.Second)
+	for sess.ExitCode() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := sess.ExitCode(); code == nil || *code != -1 {
+		t.Errorf("Expected exit code -1 for a killed process, got %v", code)
+	}
+}
+
+func TestSessionConcurrentRemoveAndInteract(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		sess := startTestSession(t, fmt.Sprintf("test-stress-%d", round), "/bin/sh")
+
+		var wg sync.WaitGroup
+		var removed atomic.Int32
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				req := mcp.CallToolRequest{}
+				req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": "echo hi\n", "wait_duration": "0"}
+				interactSessionHandler(context.Background(), req)
+			}()
+			go func() {
+				defer wg.Done()
+				if manager.Remove(sess.ID) {
+					removed.Add(1)
+				}
+				sess.Close() // Closing again directly must also be harmless
+			}()
+		}
+		wg.Wait()
+
+		if n := removed.Load(); n != 1 {
+			t.Fatalf("Expected exactly one successful Remove, got %d", n)
+		}
+		select {
+		case <-sess.exited:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Session not marked dead after Remove")
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	if out, dropped := truncateOutput("hello", 0); out != "hello" || dropped != 0 {
+		t.Errorf("Expected no truncation with max 0, got %q, %d", out, dropped)
+	}
+	if out, dropped := truncateOutput("hello", 10); out != "hello" || dropped != 0 {
+		t.Errorf("Expected no truncation under the limit, got %q, %d", out, dropped)
+	}
+	if out, dropped := truncateOutput("line1\nline2\n", 6); out != "line2\n" || dropped != 6 {
+		t.Errorf("Expected tail to be kept, got %q, %d", out, dropped)
+	}
+	// "é" is two bytes; cutting between them must drop the partial rune
+	if out, dropped := truncateOutput("aéb", 2); out != "b" || dropped != 3 {
+		t.Errorf("Expected partial rune to be dropped, got %q, %d", out, dropped)
+	}
+}
+
+func TestStripEcho(t *testing.T) {
+	sess := startTestSession(t, "test-echo", "/bin/sh")
+
+	time.Sleep(300 * time.Millisecond)
+	_ = sess.ReadAndClear()
+
+	input := "echo HelloEcho\n"
+	if err := sess.Write([]byte(input)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	raw := sess.ReadAndClear()
+	if n := strings.Count(raw, "HelloEcho"); n != 2 {
+		t.Fatalf("Expected raw output to contain the echo and the result, got:\n%q", raw)
+	}
+
+	output := stripEcho(raw, input)
+	if n := strings.Count(output, "HelloEcho"); n != 1 {
+		t.Errorf("Expected the command to appear once after stripping, got:\n%q", output)
+	}
+	if !strings.HasPrefix(output, "HelloEcho") {
+		t.Errorf("Expected output to start with the command result, got:\n%q", output)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	start := func() *Session {
+		return startTestSession(t, "test-ready", "sh", "-c", `echo banner; sleep 0.5; printf 'ready> '; sleep 5`)
+	}
+
+	sess := start()
+	if got := waitReady(sess, regexp.MustCompile(`ready> $`), 100*time.Millisecond, 3*time.Second); got != readyPrompt {
+		t.Errorf("Expected prompt readiness, got %q", got)
+	}
+	if out := sess.ReadAndClear(); !strings.Contains(out, "ready> ") {
+		t.Errorf("Expected prompt in output, got %q", out)
+	}
+	manager.Remove(sess.ID)
+
+	// Without a prompt regex, the pause after the banner counts as settled
+	sess = start()
+	if got := waitReady(sess, nil, 200*time.Millisecond, 3*time.Second); got != readyQuiet {
+		t.Errorf("Expected quiet readiness, got %q", got)
+	}
+	if out := sess.ReadAndClear(); strings.Contains(out, "ready> ") {
+		t.Errorf("Expected to return before the prompt, got %q", out)
+	}
+	manager.Remove(sess.ID)
+
+	sess = start()
+	if got := waitReady(sess, regexp.MustCompile(`never`), time.Second, 300*time.Millisecond); got != readyTimeout {
+		t.Errorf("Expected timeout, got %q", got)
+	}
+}
+
+func TestReadCompleteLines(t *testing.T) {
+	sess := &Session{}
+	sess.outputBuf.WriteString("line1\r\nline2\r\npart")
+
+	if got := sess.ReadCompleteLines(); got != "line1\r\nline2\r\n" {
+		t.Errorf("Expected complete lines, got %q", got)
+	}
+	if got := sess.ReadCompleteLines(); got != "" {
+		t.Errorf("Expected partial line to be held back, got %q", got)
+	}
+	sess.outputBuf.WriteString("ial\n")
+	if got := sess.ReadCompleteLines(); got != "partial\n" {
+		t.Errorf("Expected joined line, got %q", got)
+	}
+	if got := sess.Buffered(); got != 0 {
+		t.Errorf("Expected empty buffer, got %d bytes", got)
+	}
+}
+
+func TestReadHoldsBackSplitRune(t *testing.T) {
+	sess := &Session{exited: make(chan struct{})}
+	sess.outputBuf.WriteString("ok \xe2\x9c") // First two bytes of ✓
+
+	if got := sess.ReadAndClear(); got != "ok " {
+		t.Errorf("Expected the split character to be held back, got %q", got)
+	}
+	sess.outputBuf.WriteString("\x93 done \xe2")
+	if got, next, _ := sess.ReadSince(0, false); got != "ok ✓ done " || next != int64(len("ok ✓ done ")) {
+		t.Errorf("Expected whole characters up to offset %d, got %q up to %d", len("ok ✓ done "), got, next)
+	}
+	if got := sess.ReadAndClear(); got != "✓ done " {
+		t.Errorf("Expected the joined character, got %q", got)
+	}
+	// Nothing more will complete it once the session is gone
+	sess.markDead("EOF")
+	if got := sess.ReadAndClear(); got != "\xe2" {
+		t.Errorf("Expected the dangling byte after exit, got %q", got)
+	}
+}
+
+func TestSessionClear(t *testing.T) {
+	sess := startTestSession(t, "", "/bin/sh")
+
+	// Clear while the reader is appending a steady stream
+	sess.Write([]byte("i=0; while [ $i -lt 2000 ]; do echo line$i; i=$((i+1)); done; echo STALE_$((1+1))\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(sess.Peek(), "STALE_2") && time.Now().Before(deadline) {
+		sess.Clear()
+		time.Sleep(time.Millisecond)
+	}
+	sess.Clear()
+	if got := sess.Buffered(); got != 0 {
+		t.Errorf("Expected empty buffer after Clear, got %d bytes", got)
+	}
+
+	sess.Write([]byte("echo FRESH\n"))
+	time.Sleep(300 * time.Millisecond)
+	out := sess.ReadAndClear()
+	if !strings.Contains(out, "FRESH") || strings.Contains(out, "line1999") {
+		t.Errorf("Expected only fresh output after Clear, got %d bytes ending %q", len(out), out[max(0, len(out)-80):])
+	}
+}
+
+func TestSessionWritePaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paste.txt")
+	sess := startTestSession(t, "", "sh", "-c", `stty -echo; cat > "$0"`, path)
+	time.Sleep(100 * time.Millisecond) // Let stty run before the paste
+
+	var input strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&input, "%03d the quick brown fox jumps over the lazy dog\n", i)
+	}
+	if err := sess.WritePaced([]byte(input.String()), 256, time.Millisecond); err != nil {
+		t.Fatalf("WritePaced failed: %v", err)
+	}
+	sess.SendEOF()
+
+	select {
+	case <-sess.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cat did not exit after EOF")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input.String() {
+		t.Errorf("Paced write delivered %d of %d bytes intact", len(got), input.Len())
+	}
+}
+
+func TestParseWaitDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", config.DefaultWait, false},
+		{"0", 0, false},
+		{"1.5", 1500 * time.Millisecond, false},
+		{" 2 ", 2 * time.Second, false},
+		{"300", config.MaxWait, false},
+		{"99999", config.MaxWait, false},
+		{"1e300", config.MaxWait, false},
+		{"-1", 0, true},
+		{"1s", 0, true},
+		{"abc", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWaitDuration(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWaitDuration(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseWaitDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInteractRejectsInvalidWait(t *testing.T) {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"session_id": "no-such-session", "wait_duration": "5x"}
+	result, _ := interactSessionHandler(context.Background(), req)
+	text := result.Content[0].(mcp.TextContent).Text
+	if !result.IsError || !strings.Contains(text, "invalid wait_duration") {
+		t.Errorf("Expected an invalid wait_duration error before the session lookup, got: %s", text)
+	}
+}
+
+func TestRestartShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	call := func(h func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := h(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	text, isErr := call(startSessionHandler, map[string]any{"host": "local", "name": "repl", "tags": []any{"scratch"}})
+	if isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, ok := manager.Lookup("repl")
+	if !ok {
+		t.Fatalf("Session not registered: %s", text)
+	}
+	id := sess.ID
+	defer manager.Remove(id)
+
+	call(interactSessionHandler, map[string]any{"session_id": id, "input": "exit\n"})
+	select {
+	case <-sess.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Shell did not exit")
+	}
+	// broadcast keeps it for restart_shell too
+	call(broadcastHandler, map[string]any{"session_ids": []any{id}, "input": "\n"})
+	if _, ok := manager.Lookup(id); !ok {
+		t.Fatalf("Expected broadcast to keep the exited local session registered")
+	}
+	text, _ = call(interactSessionHandler, map[string]any{"session_id": id})
+	if !strings.Contains(text, "restart_shell") {
+		t.Errorf("Expected a restart hint for an exited local session, got: %s", text)
+	}
+
+	if text, isErr = call(restartShellHandler, map[string]any{"session_id": "repl"}); isErr {
+		t.Fatalf("restart_shell failed: %s", text)
+	}
+	restarted, ok := manager.Get(id)
+	if !ok || restarted == sess || !restarted.Alive() {
+		t.Fatalf("Expected a fresh live session under ID %s", id)
+	}
+	if restarted.Name() != "repl" || len(manager.TagsOf(restarted)) != 1 {
+		t.Errorf("Expected name and tags to carry over, got %q %v", restarted.Name(), manager.TagsOf(restarted))
+	}
+	text, _ = call(interactSessionHandler, map[string]any{"session_id": id, "input": "echo $((6*7))\n"})
+	if !strings.Contains(text, "42") {
+		t.Errorf("Expected the restarted shell to run commands, got: %s", text)
+	}
+}
+
+func TestHandlersAcceptNames(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "prod-db"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("prod-db")
+	defer manager.Remove(sess.ID)
+
+	if text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": "prod-db", "input": "echo via-$((1+1))\n"}); isErr || !strings.Contains(text, "via-2") {
+		t.Errorf("Expected interact_session to accept the name, got: %s", text)
+	}
+	callTool(closeSessionHandler, map[string]any{"session_id": "prod-db"})
+	if _, ok := manager.Get(sess.ID); ok {
+		t.Errorf("Expected close_session to close the session by name")
+	}
+	// The name is free again
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "prod-db"}); isErr {
+		t.Errorf("Expected the name to be reusable after closing, got: %s", text)
+	} else if again, ok := manager.Lookup("prod-db"); ok {
+		manager.Remove(again.ID)
+	}
+}
+
+func TestSessionTail(t *testing.T) {
+	sess := &Session{}
+	if got := sess.Tail(5); got != nil {
+		t.Errorf("Expected no lines from an empty buffer, got %q", got)
+	}
+	sess.outputBuf.WriteString("one\r\ntwo\r\nthree\nfour\r\n$ ")
+
+	if got := sess.Tail(2); strings.Join(got, "|") != "three|four" {
+		t.Errorf("Tail(2) = %q", got)
+	}
+	if got := sess.Tail(10); strings.Join(got, "|") != "one|two|three|four" {
+		t.Errorf("Tail(10) with fewer lines = %q", got)
+	}
+	if got := sess.Buffered(); got != len("one\r\ntwo\r\nthree\nfour\r\n$ ") {
+		t.Errorf("Tail must not consume the buffer, %d bytes left", got)
+	}
+
+	partial := &Session{}
+	partial.outputBuf.WriteString("no newline yet")
+	if got := partial.Tail(3); got != nil {
+		t.Errorf("Expected a partial line to be excluded, got %q", got)
+	}
+}
+
+func TestInteractInputFile(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sh")
+	os.WriteFile(script, []byte("echo from-$((2+3))\necho file-done\n"), 0o600)
+
+	sess := startTestSession(t, "test-input-file", "/bin/sh")
+
+	interact := func(args map[string]any) (string, bool) {
+		args["session_id"] = sess.ID
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := interactSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	text, isErr := interact(map[string]any{"input_file": script, "wait_duration": "0.5"})
+	if isErr || !strings.Contains(text, "from-5") || !strings.Contains(text, "file-done") {
+		t.Errorf("Expected the script to run, got: %s", text)
+	}
+	if text, isErr = interact(map[string]any{"input_file": filepath.Join(dir, "missing")}); !isErr {
+		t.Errorf("Expected an error for a missing file, got: %s", text)
+	}
+	if text, isErr = interact(map[string]any{"input_file": dir}); !isErr || !strings.Contains(text, "not a regular file") {
+		t.Errorf("Expected an error for a directory, got: %s", text)
+	}
+	if text, isErr = interact(map[string]any{"input_file": script, "input": "ls\n"}); !isErr {
+		t.Errorf("Expected an error when both input and input_file are given, got: %s", text)
+	}
+
+	saved := config.MaxInputFile
+	config.MaxInputFile = 8
+	defer func() { config.MaxInputFile = saved }()
+	if text, isErr = interact(map[string]any{"input_file": script}); !isErr || !strings.Contains(text, "limit") {
+		t.Errorf("Expected the size cap to apply, got: %s", text)
+	}
+}
+
+func TestInteractZeroWaitFastPath(t *testing.T) {
+	sess := startTestSession(t, "test-zero-wait", "/bin/sh")
+
+	for _, wait := range []string{"0", "0.0"} {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": "sleep 0.2 &\n", "wait_duration": wait}
+		start := time.Now()
+		result, _ := interactSessionHandler(context.Background(), req)
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("wait_duration=%s took %v; expected an immediate return", wait, elapsed)
+		}
+		if result.IsError {
+			t.Errorf("wait_duration=%s failed: %v", wait, result.Content)
+		}
+	}
+}
+
+func TestInteractPeek(t *testing.T) {
+	sess := startTestSession(t, "test-peek", "/bin/sh")
+
+	if text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "clear": false, "expect": "$"}); !isErr || !strings.Contains(text, "clear=false") {
+		t.Errorf("Expected clear=false with expect to be rejected, got: %s", text)
+	}
+	text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": "echo peek-$((6*7))\n", "wait_duration": "0.5", "clear": false})
+	if isErr || !strings.Contains(text, "[Peeked") || !strings.Contains(text, "peek-42") {
+		t.Fatalf("Expected the output to be peeked, got: %s", text)
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "wait_duration": "0"}); strings.Contains(text, "[Peeked") || !strings.Contains(text, "peek-42") {
+		t.Errorf("Expected the peeked output to be read again, got: %s", text)
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "wait_duration": "0"}); text != "(No new output)" {
+		t.Errorf("Expected the read to have cleared the output, got: %s", text)
+	}
+}
+
+func TestInteractSinceOffset(t *testing.T) {
+	sess := startTestSession(t, "test-offset", "/bin/sh")
+
+	interact := func(args map[string]any) interactResult {
+		args["session_id"] = sess.ID
+		args["format"] = "json"
+		text, isErr := callTool(interactSessionHandler, args)
+		var res interactResult
+		if isErr || json.Unmarshal([]byte(text), &res) != nil {
+			t.Fatalf("Unexpected result: %s", text)
+		}
+		return res
+	}
+	first := interact(map[string]any{"input": "echo one-$((1))\n", "wait_duration": "0.5"})
+	if !strings.Contains(first.Output, "one-1") || first.NextOffset == 0 {
+		t.Fatalf("Expected the first output and its offset, got %+v", first)
+	}
+	second := interact(map[string]any{"input": "echo two-$((2))\n", "wait_duration": "0.5", "since_offset": int(first.NextOffset)})
+	if strings.Contains(second.Output, "one-1") || !strings.Contains(second.Output, "two-2") || second.NextOffset <= first.NextOffset {
+		t.Errorf("Expected only the output after the offset, got %+v", second)
+	}
+	// Another reader starting over sees everything, and reading by offset
+	// left the unread output to the clearing reader
+	if all := interact(map[string]any{"since_offset": 0, "wait_duration": "0"}); !strings.Contains(all.Output, "one-1") || !strings.Contains(all.Output, "two-2") {
+		t.Errorf("Expected everything from offset 0, got %q", all.Output)
+	}
+	if unread := interact(map[string]any{"wait_duration": "0"}); !strings.Contains(unread.Output, "two-2") || unread.NextOffset != second.NextOffset {
+		t.Errorf("Expected the unread output up to offset %d, got %+v", second.NextOffset, unread)
+	}
+
+	if text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "since_offset": 1 << 40}); !isErr || !strings.Contains(text, "past the end") {
+		t.Errorf("Expected an offset past the end to be rejected, got: %s", text)
+	}
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "since_offset": int(second.NextOffset), "wait_duration": "0"}); !strings.Contains(text, fmt.Sprintf("[Next offset: %d]", second.NextOffset)) {
+		t.Errorf("Expected the next offset in the text result, got: %s", text)
+	}
+}
+
+func TestStartSessionCwd(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o600)
+	for want, args := range map[string]map[string]any{
+		"only available for local sessions": {"host": "web01", "cwd": dir, "dry_run": true},
+		"no such file or directory":         {"host": "local", "cwd": filepath.Join(dir, "missing")},
+		"is not a directory":                {"host": "local", "cwd": file},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "cwd-test", "cwd": dir}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("cwd-test")
+	defer manager.Remove(sess.ID)
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "cwd-test", "input": "pwd\n", "wait_duration": "1"}); !strings.Contains(text, dir) {
+		t.Errorf("Expected the shell to start in %s, got: %s", dir, text)
+	}
+	if restored := restoredSession(sessionRecord{Host: "local", Dir: dir}); restored.Cmd.Dir != dir {
+		t.Errorf("Expected a restored local session to keep its directory, got %q", restored.Cmd.Dir)
+	}
+}
+
+func TestStartSessionCommand(t *testing.T) {
+	for want, args := range map[string]map[string]any{
+		"can't be combined with backing": {"host": "web01", "command": "psql", "backing": "tmux", "dry_run": true},
+		"args requires command":          {"host": "web01", "args": []any{"-i"}, "dry_run": true},
+		"not found":                      {"host": "local", "command": "mcpssh-no-such-program"},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": "web01", "command": "psql", "args": []any{"-d", "my db"}, "dry_run": true})
+	if isErr || !strings.Contains(text, "web01") || !strings.Contains(text, "psql -d") {
+		t.Errorf("Expected the dry run to run psql on the host, got: %s", text)
+	}
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "command-test", "command": "cat"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("command-test")
+	defer manager.Remove(sess.ID)
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "command-test", "input": "hello\n", "wait_duration": "1"}); !strings.Contains(text, "hello") {
+		t.Errorf("Expected cat to echo the input, got: %s", text)
+	}
+	if text, _ := callTool(describeSessionHandler, map[string]any{"session_id": "command-test"}); !strings.Contains(text, "Program: cat") {
+		t.Errorf("Expected describe to show the program, got: %s", text)
+	}
+	if restored := restoredSession(sessionRecord{Host: "local", Command: []string{"cat"}}); !slices.Equal(restored.Command, []string{"cat"}) {
+		t.Errorf("Expected a restored session to keep its command, got %q", restored.Command)
+	}
+}
+
+func TestStartSessionTerm(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	start := func(args map[string]any) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := startSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	if text, isErr := start(map[string]any{"host": "local", "term": "xterm; rm -rf /"}); !isErr || !strings.Contains(text, "Invalid term") {
+		t.Errorf("Expected an invalid term to be rejected, got: %s", text)
+	}
+
+	if text, isErr := start(map[string]any{"host": "local", "name": "term-test", "term": "vt100"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("term-test")
+	defer manager.Remove(sess.ID)
+
+	sess.Write([]byte("echo term=$TERM\n"))
+	time.Sleep(300 * time.Millisecond)
+	if out := sess.ReadAndClear(); !strings.Contains(out, "term=vt100") {
+		t.Errorf("Expected TERM=vt100 in the session, got %q", out)
+	}
+	if d := sess.describe(); d.Term != "vt100" {
+		t.Errorf("Expected describe to report the term, got %q", d.Term)
+	}
+}
+
+func TestTerminalSize(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "cols": 0}); !isErr || !strings.Contains(text, "between 1 and") {
+		t.Errorf("Expected a zero width to be rejected, got: %s", text)
+	}
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "size-test", "rows": 40, "cols": 200}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("size-test")
+	defer manager.Remove(sess.ID)
+
+	size := func() string {
+		sess.Clear()
+		sess.Write([]byte("stty size\n"))
+		out, _ := waitForPattern(context.Background(), sess, regexp.MustCompile(`\d+ \d+\r?\n`), 2*time.Second)
+		return out
+	}
+	if out := size(); !strings.Contains(out, "40 200") {
+		t.Errorf("Expected a 200x40 terminal, got %q", out)
+	}
+
+	if text, isErr := callTool(resizeSessionHandler, map[string]any{"session_id": "size-test", "cols": 132}); isErr || !strings.Contains(text, "132x40") {
+		t.Fatalf("resize_session failed: %s", text)
+	}
+	if out := size(); !strings.Contains(out, "40 132") {
+		t.Errorf("Expected a 132x40 terminal after resizing, got %q", out)
+	}
+	if d := sess.describe(); d.Rows != 40 || d.Cols != 132 {
+		t.Errorf("Expected describe to report 132x40, got %dx%d", d.Cols, d.Rows)
+	}
+	if text, isErr := callTool(resizeSessionHandler, map[string]any{"session_id": "size-test", "rows": 5000}); !isErr {
+		t.Errorf("Expected an oversized terminal to be rejected, got: %s", text)
+	}
+
+	// Restarting keeps the size
+	sess.Close()
+	<-sess.exited
+	if text, isErr := callTool(restartShellHandler, map[string]any{"session_id": "size-test"}); isErr {
+		t.Fatalf("restart_shell failed: %s", text)
+	}
+	sess, _ = manager.Lookup("size-test")
+	if out := size(); !strings.Contains(out, "40 132") {
+		t.Errorf("Expected the restarted shell to keep 132x40, got %q", out)
+	}
+}
+
+func TestInteractExitDuringWait(t *testing.T) {
+	sess := startTestSession(t, "test-exit-during-wait", "/bin/sh")
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": "echo bye; exit 3\n", "wait_duration": "10"}
+	start := time.Now()
+	result, _ := interactSessionHandler(context.Background(), req)
+	text := result.Content[0].(mcp.TextContent).Text
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected an early return when the session exits, waited %v", elapsed)
+	}
+	if !strings.Contains(text, "bye") || !strings.Contains(text, "[Session exited during interaction: EOF, exit code 3]") {
+		t.Errorf("Expected remaining output and an exit note, got:\n%s", text)
+	}
+	// Clients needn't parse the note: the same state is structured content
+	res, ok := result.StructuredContent.(interactResult)
+	if !ok || res.SessionAlive || !res.Exited || res.ExitCode == nil || *res.ExitCode != 3 || !strings.Contains(res.Output, "bye") {
+		t.Errorf("Expected structured content reporting the exit, got %+v", result.StructuredContent)
+	}
+}
+
+func TestBroadcastExitDuringWait(t *testing.T) {
+	sess := startTestSession(t, "test-broadcast-exit", "/bin/sh")
+
+	start := time.Now()
+	text, _ := callTool(broadcastHandler, map[string]any{"session_ids": []any{sess.ID}, "input": "echo bye; exit 3\n", "wait_duration": "10"})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected an early return when the session exits, waited %v", elapsed)
+	}
+	if !strings.Contains(text, "[Session exited]") || !strings.Contains(text, "bye") {
+		t.Errorf("Expected the session reported as exited with its output, got:\n%s", text)
+	}
+}
+
+func TestInteractAnchor(t *testing.T) {
+	sess := startTestSession(t, "test-anchor", "/bin/sh")
+
+	interact := func(input, anchor string) string {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"session_id": sess.ID, "input": input, "anchor": anchor, "wait_duration": "0.3"}
+		result, _ := interactSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	if text := interact("echo one\n", "prompt"); !strings.HasPrefix(text, "----- test-anchor") {
+		t.Errorf("Expected a separator before any prompt was seen, got %q", text)
+	}
+	if text := interact("echo two\n", "prompt"); !strings.HasPrefix(text, "$ echo two") {
+		t.Errorf("Expected output anchored at the prompt, got %q", text)
+	}
+	if text := interact("echo three\n", "none"); strings.HasPrefix(text, "$ ") || strings.HasPrefix(text, "-----") {
+		t.Errorf("Expected raw output without an anchor, got %q", text)
+	}
+}
+
+func TestInteractWaitForPrompt(t *testing.T) {
+	sess := startTestSession(t, "test-wait-prompt", "env", "PS1=mcp@test:$PWD$ ", "/bin/sh")
+
+	interact := func(args map[string]any) (string, time.Duration) {
+		args["session_id"] = sess.ID
+		start := time.Now()
+		text, _ := callTool(interactSessionHandler, args)
+		return text, time.Since(start)
+	}
+	// Learn the prompt
+	for i := 0; sess.Prompt() == "" && i < 10; i++ {
+		interact(map[string]any{"input": "\n", "wait_duration": "0.5"})
+	}
+
+	if text, elapsed := interact(map[string]any{"input": "sleep 0.3; echo done-$((1))\n", "wait_duration": "5"}); !strings.Contains(text, "done-1") || elapsed > 2*time.Second {
+		t.Errorf("Expected a return once the prompt %q came back, got %q after %v", sess.Prompt(), text, elapsed)
+	}
+	// The prompt shows the working directory, so it changes
+	if text, elapsed := interact(map[string]any{"input": "cd /\n", "wait_duration": "5"}); elapsed > 2*time.Second {
+		t.Errorf("Expected a return once the changed prompt came back, got %q after %v", text, elapsed)
+	}
+	if text, elapsed := interact(map[string]any{"input": "echo moved-$((2))\n", "wait_duration": "5"}); !strings.Contains(text, "moved-2") || elapsed > 2*time.Second {
+		t.Errorf("Expected a return at the prompt %q, got %q after %v", sess.Prompt(), text, elapsed)
+	}
+	// Each command of a multi-line input has to finish
+	if text, _ := interact(map[string]any{"input": "echo a-$((1))\nsleep 0.3; echo b-$((2))\n", "wait_duration": "5"}); !strings.Contains(text, "b-2") {
+		t.Errorf("Expected the output of both commands, got %q", text)
+	}
+	if _, elapsed := interact(map[string]any{"input": "echo off\n", "wait_duration": "1", "wait_for_prompt": false}); elapsed < time.Second {
+		t.Errorf("Expected the full wait with wait_for_prompt off, returned after %v", elapsed)
+	}
+}
+
+func TestStartSessionDryRun(t *testing.T) {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "web01", "user": "deploy", "port": 2222, "dry_run": true}
+	before := len(manager.IDs())
+
+	result, _ := startSessionHandler(context.Background(), req)
+	if result.IsError {
+		t.Skipf("Skipping dry run test: %v", result.Content) // e.g. no ssh binary on PATH
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(text, "-p 2222 -- deploy@web01") {
+		t.Errorf("Expected ssh command line in dry run output, got:\n%s", text)
+	}
+	if after := len(manager.IDs()); after != before {
+		t.Errorf("Dry run must not create a session (had %d, now %d)", before, after)
+	}
+}
+
+func TestShellQuoteArgs(t *testing.T) {
+	got := shellQuoteArgs([]string{"ssh", "-o", "ControlPath=/tmp/x/%C", "it's", ""})
+	want := `ssh -o 'ControlPath=/tmp/x/%C' 'it'\''s' ''`
+	if got != want {
+		t.Errorf("shellQuoteArgs = %s, want %s", got, want)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	web := restoredSession(sessionRecord{ID: "test-list-web", Name: "web", Host: "web01", User: "deploy", Port: 2222, Tags: []string{"test-list"}, CreatedAt: created})
+	db := restoredSession(sessionRecord{ID: "test-list-db", Host: "db01", Tags: []string{"test-list"}, CreatedAt: created.Add(time.Minute)})
+	for _, sess := range []*Session{db, web} {
+		if err := manager.Add(sess); err != nil {
+			t.Fatal(err)
+		}
+		defer manager.Remove(sess.ID)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"tag": "test-list"}
+	result, _ := listSessionsHandler(context.Background(), req)
+	text := result.Content[0].(mcp.TextContent).Text
+	for _, want := range []string{"2 session(s)", "test-list-web (name: web)", "deploy@web01:2222", "test-list-db", "exited (" + restoredReason} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in listing, got:\n%s", want, text)
+		}
+	}
+	if strings.Index(text, "test-list-web") > strings.Index(text, "test-list-db") {
+		t.Errorf("Expected sessions oldest first, got:\n%s", text)
+	}
+
+	req.Params.Arguments = map[string]any{"tag": "test-list", "format": "json"}
+	result, _ = listSessionsHandler(context.Background(), req)
+	var res listResult
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &res); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(res.Sessions) != 2 || res.Sessions[0].SessionID != "test-list-web" || res.Sessions[0].Alive {
+		t.Errorf("Unexpected JSON listing: %+v", res.Sessions)
+	}
+
+	req.Params.Arguments = map[string]any{"tag": "test-list-none"}
+	result, _ = listSessionsHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; text != "No open sessions." {
+		t.Errorf("Expected empty listing, got: %s", text)
+	}
+}
+
+func TestCloneCmd(t *testing.T) {
+	c := exec.Command("/bin/sh", "-c", "pwd")
+	c.Env = []string{"A=1"}
+	c.Dir = t.TempDir()
+	next := cloneCmd(c)
+	if next == c || next.Path != c.Path || !slices.Equal(next.Args, c.Args) || !slices.Equal(next.Env, c.Env) || next.Dir != c.Dir {
+		t.Errorf("Expected a fresh command with the same settings, got %+v", next)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Metrics holds Prometheus-style counters. Hot-path counters are atomics;
+// the labelled maps only take a lock the first time a label is seen.
+type Metrics struct {
+	sessionsCreated atomic.Int64
+	bytesRead       atomic.Int64
+	bytesWritten    atomic.Int64
+	bytesDropped    atomic.Int64
+
+	mu          sync.RWMutex
+	deaths      map[string]*atomic.Int64 // By reason
+	toolLatency map[string]*latency      // By tool name
+}
+
+type latency struct {
+	count atomic.Int64
+	nanos atomic.Int64
+}
+
+var metrics = &Metrics{
+	deaths:      make(map[string]*atomic.Int64),
+	toolLatency: make(map[string]*latency),
+}
+
+// SessionDied counts a session ending for reason.
+func (m *Metrics) SessionDied(reason string) {
+	// Read errors carry free-form text; collapse them to keep cardinality low
+	if strings.HasPrefix(reason, "read error") {
+		reason = "read_error"
+	}
+	m.mu.RLock()
+	c, ok := m.deaths[reason]
+	m.mu.RUnlock()
+	if !ok {
+		m.mu.Lock()
+		if c, ok = m.deaths[reason]; !ok {
+			c = new(atomic.Int64)
+			m.deaths[reason] = c
+		}
+		m.mu.Unlock()
+	}
+	c.Add(1)
+}
+
+// ObserveTool records how long a tool call took.
+func (m *Metrics) ObserveTool(tool string, d time.Duration) {
+	m.mu.RLock()
+	l, ok := m.toolLatency[tool]
+	m.mu.RUnlock()
+	if !ok {
+		m.mu.Lock()
+		if l, ok = m.toolLatency[tool]; !ok {
+			l = new(latency)
+			m.toolLatency[tool] = l
+		}
+		m.mu.Unlock()
+	}
+	l.count.Add(1)
+	l.nanos.Add(int64(d))
+}
+
+// toolMetricsMiddleware times every tool call.
+func toolMetricsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		defer func() { metrics.ObserveTool(req.Params.Name, time.Since(start)) }()
+		return next(ctx, req)
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP mcpssh_sessions_active Number of sessions currently open.")
+	fmt.Fprintln(w, "# TYPE mcpssh_sessions_active gauge")
+	fmt.Fprintf(w, "mcpssh_sessions_active %d\n", len(manager.IDs()))
+
+	fmt.Fprintln(w, "# HELP mcpssh_sessions_created_total Sessions started since the server came up.")
+	fmt.Fprintln(w, "# TYPE mcpssh_sessions_created_total counter")
+	fmt.Fprintf(w, "mcpssh_sessions_created_total %d\n", m.sessionsCreated.Load())
+
+	fmt.Fprintln(w, "# HELP mcpssh_bytes_read_total Bytes read from session terminals.")
+	fmt.Fprintln(w, "# TYPE mcpssh_bytes_read_total counter")
+	fmt.Fprintf(w, "mcpssh_bytes_read_total %d\n", m.bytesRead.Load())
+
+	fmt.Fprintln(w, "# HELP mcpssh_bytes_written_total Bytes written to session terminals.")
+	fmt.Fprintln(w, "# TYPE mcpssh_bytes_written_total counter")
+	fmt.Fprintf(w, "mcpssh_bytes_written_total %d\n", m.bytesWritten.Load())
+	fmt.Fprintln(w, "# HELP mcpssh_bytes_dropped_total Unread output bytes discarded because a session buffer was full.")
+	fmt.Fprintln(w, "# TYPE mcpssh_bytes_dropped_total counter")
+	fmt.Fprintf(w, "mcpssh_bytes_dropped_total %d\n", m.bytesDropped.Load())
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fmt.Fprintln(w, "# HELP mcpssh_sessions_died_total Sessions that ended, by reason.")
+	fmt.Fprintln(w, "# TYPE mcpssh_sessions_died_total counter")
+	for _, reason := range sortedKeys(m.deaths) {
+		fmt.Fprintf(w, "mcpssh_sessions_died_total{reason=%q} %d\n", reason, m.deaths[reason].Load())
+	}
+
+	fmt.Fprintln(w, "# HELP mcpssh_tool_duration_seconds Time spent handling tool calls.")
+	fmt.Fprintln(w, "# TYPE mcpssh_tool_duration_seconds summary")
+	for _, tool := range sortedKeys(m.toolLatency) {
+		l := m.toolLatency[tool]
+		fmt.Fprintf(w, "mcpssh_tool_duration_seconds_sum{tool=%q} %g\n", tool, time.Duration(l.nanos.Load()).Seconds())
+		fmt.Fprintf(w, "mcpssh_tool_duration_seconds_count{tool=%q} %d\n", tool, l.count.Load())
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := &Metrics{
+		deaths:      make(map[string]*atomic.Int64),
+		toolLatency: make(map[string]*latency),
+	}
+	m.sessionsCreated.Add(2)
+	m.bytesRead.Add(100)
+	m.SessionDied("EOF")
+	m.SessionDied("read error: input/output error")
+	m.SessionDied("read error: something else")
+	m.ObserveTool("interact_session", 1500*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"mcpssh_sessions_created_total 2\n",
+		"mcpssh_bytes_read_total 100\n",
+		`mcpssh_sessions_died_total{reason="EOF"} 1` + "\n",
+		`mcpssh_sessions_died_total{reason="read_error"} 2` + "\n",
+		`mcpssh_tool_duration_seconds_sum{tool="interact_session"} 1.5` + "\n",
+		`mcpssh_tool_duration_seconds_count{tool="interact_session"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
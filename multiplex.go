@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// ControlMasters manages OpenSSH ControlMaster sockets so that sessions to
+// the same host share a single authenticated connection.
+type ControlMasters struct {
+	mu    sync.Mutex
+	dir   string
+	hosts map[string]struct{}
+}
+
+var controlMasters = &ControlMasters{hosts: make(map[string]struct{})}
+
+// Path returns the ControlPath to use for host, creating the socket
+// directory on first use.
+func (cm *ControlMasters) Path(host string) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.dir == "" {
+		// Unix socket paths are limited to ~104 bytes, and the per-user temp
+		// dir on macOS is already long, so keep the sockets under /tmp.
+		dir, err := os.MkdirTemp("/tmp", "mcpssh-")
+		if err != nil {
+			return "", err
+		}
+		cm.dir = dir
+	}
+	cm.hosts[host] = struct{}{}
+	return cm.controlPath(), nil
+}
+
+// controlPath uses ssh's %C token (a hash of local host, remote host, port
+// and user) so each destination gets its own socket. Caller must hold cm.mu.
+func (cm *ControlMasters) controlPath() string {
+	return filepath.Join(cm.dir, "%C")
+}
+
+// Close asks every master connection to exit and removes the socket directory.
+func (cm *ControlMasters) Close() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.dir == "" {
+		return
+	}
+	// If ssh can't be found there's nothing to ask; the masters still exit
+	// on their own once ControlPersist expires.
+	if sshPath, err := resolveSSHPath(); err == nil {
+		for host := range cm.hosts {
+			exec.Command(sshPath, "-o", "ControlPath="+cm.controlPath(), "-O", "exit", host).Run()
+		}
+	}
+	os.RemoveAll(cm.dir)
+	cm.dir = ""
+	cm.hosts = make(map[string]struct{})
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSH transports: run the ssh binary in a local PTY, or connect with the
+// built-in client.
+const (
+	TransportExec   = "exec"
+	TransportNative = "native"
+)
+
+// nativeDialTimeout bounds connecting to each hop, and then its SSH
+// handshake.
+const nativeDialTimeout = 15 * time.Second
+
+// nativeConn is an SSH session run by the built-in client instead of the ssh
+// binary. The channel is bridged to one end of a socket pair, and the other
+// end stands in for the PTY master, so the reader and writers treat both
+// transports alike.
+type nativeConn struct {
+	client  *ssh.Client
+	jumps   []*ssh.Client // Connections to the jump hosts, outermost first
+	session *ssh.Session
+	waited  chan struct{} // Closed once the remote command has finished
+	waitErr error         // Result of session.Wait, valid once waited is closed
+
+	newHostKeys []string // Host keys accepted and recorded while connecting
+}
+
+// dialNative connects to opts.Host with the built-in client, starts a shell
+// (in a remote PTY of the given size unless opts.PTYMode disables it) and
+// returns the local end of the bridge.
+func dialNative(opts *SSHOptions, term string, rows, cols int) (*os.File, *nativeConn, error) {
+	hops, err := nativeHops(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, closeAgent, err := nativeAuthMethods(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeAgent()
+
+	// Each hop is reached through a tunnel from the previous one, as ssh -J
+	// does; every hop authenticates and is verified the same way
+	nc := &nativeConn{waited: make(chan struct{})}
+	hostKeys := nativeHostKeyCallback(opts.HostKeyPolicy, func(key string) { nc.newHostKeys = append(nc.newHostKeys, key) })
+	for _, hop := range hops {
+		cfg := &ssh.ClientConfig{User: hop.user, Auth: auth, HostKeyCallback: hostKeys}
+		var client *ssh.Client
+		if nc.client == nil {
+			client, err = dialDirect(hop.addr, cfg)
+		} else {
+			client, err = dialThrough(nc.client, hop.addr, cfg)
+			nc.jumps = append(nc.jumps, nc.client)
+		}
+		if err != nil {
+			nc.close()
+			return nil, nil, fmt.Errorf("%s: %w", hop.addr, err)
+		}
+		nc.client = client
+	}
+	session, err := nc.client.NewSession()
+	if err != nil {
+		nc.close()
+		return nil, nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(opts.Env)) {
+		session.Setenv(name, opts.Env[name]) // Refused unless the server's AcceptEnv allows it, as with ssh
+	}
+	if opts.PTYMode != PTYDisable {
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+		if err := session.RequestPty(term, rows, cols, modes); err != nil && opts.PTYMode != PTYRequest {
+			nc.close()
+			return nil, nil, fmt.Errorf("remote PTY request failed: %w", err)
+		}
+	}
+	nc.session = session
+
+	local, remote, err := socketBridge("ssh-native")
+	if err != nil {
+		nc.close()
+		return nil, nil, err
+	}
+
+	// Stdin is copied by hand: session.Wait would otherwise wait for the
+	// copy, which only ends once the local end is closed.
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		local.Close()
+		remote.Close()
+		nc.close()
+		return nil, nil, err
+	}
+	session.Stdout = remote
+	session.Stderr = remote
+	if cmd := opts.remoteCommand(); cmd != "" {
+		err = session.Start(cmd)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		local.Close()
+		remote.Close()
+		nc.close()
+		return nil, nil, err
+	}
+
+	go func() {
+		io.Copy(stdin, remote)
+		stdin.Close() // Sends EOF to the remote command
+	}()
+	go func() {
+		nc.waitErr = session.Wait()
+		remote.Close() // The reader sees EOF, as with a PTY whose child exited
+		nc.close()
+		close(nc.waited)
+	}()
+	if opts.AliveInterval > 0 {
+		countMax := opts.AliveCountMax
+		if countMax <= 0 {
+			countMax = defaultAliveCountMax
+		}
+		go nc.keepAlive(time.Duration(opts.AliveInterval)*time.Second, countMax)
+	}
+	return local, nc, nil
+}
+
+// defaultAliveCountMax is ssh's ServerAliveCountMax default.
+const defaultAliveCountMax = 3
+
+// keepAlive sends a keepalive request every interval, as ServerAliveInterval
+// does, and drops the connection once countMax in a row go unanswered, so a
+// link that died behind a NAT or firewall ends the session instead of
+// leaving it hanging. Any reply counts, including a refusal.
+func (nc *nativeConn) keepAlive(interval time.Duration, countMax int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-nc.waited:
+			return
+		}
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := nc.client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case err := <-reply:
+			if err != nil {
+				nc.close() // The connection is already gone
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			if missed++; missed >= countMax {
+				logger.Info("closing unresponsive connection", "missed_keepalives", missed)
+				nc.close()
+				return
+			}
+		case <-nc.waited:
+			return
+		}
+	}
+}
+
+// socketBridge returns the two ends of a socket pair: local stands in for a
+// PTY master, while a connection's data is copied to and from remote.
+func socketBridge(name string) (local, remote *os.File, err error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, fd := range fds {
+		// Non-blocking makes the files pollable, so Close interrupts a
+		// pending Read instead of waiting for it
+		syscall.CloseOnExec(fd)
+		syscall.SetNonblock(fd, true)
+	}
+	return os.NewFile(uintptr(fds[0]), name), os.NewFile(uintptr(fds[1]), name+"-bridge"), nil
+}
+
+// close tears down the connection and any jump host connections beneath
+// it, which ends the remote command.
+func (nc *nativeConn) close() {
+	if nc.client != nil {
+		nc.client.Close()
+	}
+	for i := len(nc.jumps) - 1; i >= 0; i-- {
+		nc.jumps[i].Close()
+	}
+}
+
+// dialDirect opens an SSH connection to addr over TCP.
+func dialDirect(addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, nativeDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return clientConn(conn, addr, cfg, nativeDialTimeout)
+}
+
+// dialThrough opens an SSH connection to addr tunnelled through client.
+func dialThrough(client *ssh.Client, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return clientConn(conn, addr, cfg, nativeDialTimeout)
+}
+
+// clientConn runs the SSH handshake with addr over conn, giving up after
+// timeout: a server that accepts the connection but never answers would
+// otherwise hang it for good. conn is closed if the handshake fails.
+func clientConn(conn net.Conn, addr string, cfg *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	// Tunnelled connections don't support deadlines; those are closed on a
+	// timer instead
+	var timer *time.Timer
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		timer = time.AfterFunc(timeout, func() { conn.Close() })
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if timer != nil && !timer.Stop() && err == nil {
+		c.Close()
+		err = fmt.Errorf("ssh: handshake timed out after %s", timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// nativeHop is one connection of a native session: the jump hosts in
+// order, then the destination.
+type nativeHop struct {
+	addr string // host:port to dial
+	user string
+}
+
+// nativeHops resolves the jump hosts and destination of opts.
+func nativeHops(opts *SSHOptions) ([]nativeHop, error) {
+	var hops []nativeHop
+	for _, spec := range opts.JumpHosts {
+		j, err := parseJumpHost(spec)
+		if err != nil {
+			return nil, err
+		}
+		addr, username, err := nativeAddr(&SSHOptions{Host: j.Host, User: j.User, Port: j.Port})
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, nativeHop{addr, username})
+	}
+	addr, username, err := nativeAddr(opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(hops, nativeHop{addr, username}), nil
+}
+
+// exitCode waits for the remote command and returns its exit status, or nil
+// if the server didn't report one (e.g. the connection dropped).
+func (nc *nativeConn) exitCode() *int {
+	<-nc.waited
+	code := 0
+	var exitErr *ssh.ExitError
+	switch {
+	case nc.waitErr == nil:
+	case errors.As(nc.waitErr, &exitErr):
+		code = exitErr.ExitStatus()
+	default:
+		return nil
+	}
+	return &code
+}
+
+// nativeAddr resolves the host:port to dial and the login user. Without an
+// explicit user it logs in as the local user, as ssh does.
+func nativeAddr(opts *SSHOptions) (addr, username string, err error) {
+	if opts.Port < 0 || opts.Port > 65535 {
+		return "", "", fmt.Errorf("port %d out of range", opts.Port)
+	}
+	dest, err := sshDestination(opts.User, opts.Host)
+	if err != nil {
+		return "", "", err
+	}
+	host := dest
+	if i := strings.LastIndex(dest, "@"); i >= 0 {
+		username, host = dest[:i], dest[i+1:]
+	}
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		} else {
+			username = os.Getenv("USER")
+		}
+	}
+	port := opts.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), username, nil
+}
+
+// nativeAuthMethods offers opts.IdentityFile or else the keys held by
+// ssh-agent and any unencrypted default identity in ~/.ssh, then the
+// password (also answering keyboard-interactive prompts) if one is given.
+// The returned func closes the agent connection.
+func nativeAuthMethods(opts *SSHOptions) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if opts.IdentityFile != "" {
+		signer, err := loadIdentityFile(opts.IdentityFile, opts.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	} else {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if conn, err := net.Dial("unix", sock); err == nil {
+				methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+				closeAgent = func() { conn.Close() }
+			}
+		}
+		var signers []ssh.Signer
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			data, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+			if err != nil {
+				continue
+			}
+			if signer, err := ssh.ParsePrivateKey(data); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+		}
+	}
+	if password := opts.Password; password != "" {
+		methods = append(methods, ssh.Password(password), ssh.KeyboardInteractive(
+			func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					if !echos[i] { // Only hidden prompts ask for the password
+						answers[i] = password
+					}
+				}
+				return answers, nil
+			}))
+	}
+	return methods, closeAgent, nil
+}
+
+// loadIdentityFile reads a private key, decrypting it with passphrase if it
+// is protected.
+func loadIdentityFile(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("identity file: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(data)
+	}
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("identity file %s is passphrase-protected; pass passphrase", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("identity file %s: %w", path, err)
+	}
+	return signer, nil
+}
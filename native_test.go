@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer runs a minimal SSH server accepting any user, either
+// without authentication or, if password is set, with that password. Its
+// "shell" answers each line with "got:<line>" and exits
+// with status 3 on "exit". The requested TERM is sent on terms.
+func startTestSSHServer(t *testing.T, password string) (port int, terms <-chan string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: password == ""}
+	cfg.PasswordCallback = func(_ ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+		if string(pw) != password {
+			return nil, fmt.Errorf("wrong password")
+		}
+		return nil, nil
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	termc := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, cfg, termc)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, termc
+}
+
+func serveTestSSHConn(conn net.Conn, cfg *ssh.ServerConfig, terms chan<- string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if req.Type == "keepalive@openssh.com" {
+				testSSHKeepalives.Add(1)
+			}
+			if req.WantReply {
+				req.Reply(false, nil) // As OpenSSH answers keepalives
+			}
+		}
+	}()
+	for newCh := range chans {
+		if newCh.ChannelType() == "direct-tcpip" {
+			go forwardTestSSHChannel(newCh)
+			continue
+		}
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range chReqs {
+				switch req.Type {
+				case "pty-req":
+					var pty struct {
+						Term string
+						Rest []byte `ssh:"rest"`
+					}
+					ssh.Unmarshal(req.Payload, &pty)
+					select {
+					case terms <- pty.Term:
+					default: // Only the first is of interest; don't stall later sessions
+					}
+					req.Reply(true, nil)
+				case "exec":
+					var exec struct{ Command string }
+					ssh.Unmarshal(req.Payload, &exec)
+					req.Reply(true, nil)
+					go runTestSSHExec(ch, exec.Command)
+				case "shell":
+					req.Reply(true, nil)
+					go func() {
+						ch.Write([]byte("$ "))
+						scanner := bufio.NewScanner(ch)
+						for scanner.Scan() {
+							line := strings.TrimSpace(scanner.Text())
+							if line == "exit" {
+								ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{3}))
+								ch.Close()
+								return
+							}
+							ch.Write([]byte("got:" + line + "\r\n$ "))
+						}
+					}()
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+// runTestSSHExec runs an exec request's command locally with sh.
+func runTestSSHExec(ch ssh.Channel, command string) {
+	c := osexec.Command("/bin/sh", "-c", command)
+	c.Stdin, c.Stdout, c.Stderr = ch, ch, ch.Stderr()
+	status := uint32(0)
+	if err := c.Run(); err != nil {
+		status = 1
+	}
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	ch.Close()
+}
+
+// testSSHForwards counts the direct-tcpip channels the test servers served.
+var testSSHForwards atomic.Int64
+
+// testSSHKeepalives counts the keepalive requests the test servers answered.
+var testSSHKeepalives atomic.Int64
+
+// forwardTestSSHChannel serves a direct-tcpip channel, as a jump host does.
+func forwardTestSSHChannel(newCh ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &target); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	testSSHForwards.Add(1)
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+	io.Copy(conn, ch)
+	conn.Close()
+}
+
+func TestNativeTransport(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // No known_hosts or keys
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, terms := startTestSSHServer(t, "")
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "127.0.0.1", "port": port, "user": "tester", "name": "native-test", "transport": "native", "term": "vt100"}
+	result, _ := startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; result.IsError {
+		t.Fatalf("start_session failed: %s", text)
+	}
+	sess, ok := manager.Lookup("native-test")
+	if !ok {
+		t.Fatalf("Session not registered")
+	}
+	defer manager.Remove(sess.ID)
+
+	select {
+	case term := <-terms:
+		if term != "vt100" {
+			t.Errorf("Expected the remote PTY to be requested with TERM vt100, got %q", term)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("No PTY was requested")
+	}
+	if d := sess.describe(); d.Transport != TransportNative {
+		t.Errorf("Expected describe to report the native transport, got %q", d.Transport)
+	}
+	if err := sess.Resize(50, 120); err != nil {
+		t.Errorf("Resize failed: %v", err)
+	}
+	if d := sess.describe(); d.Rows != 50 || d.Cols != 120 {
+		t.Errorf("Expected describe to report 120x50, got %dx%d", d.Cols, d.Rows)
+	}
+
+	if err := sess.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	var out string
+	for time.Now().Before(deadline) && !strings.Contains(out, "got:hello") {
+		time.Sleep(20 * time.Millisecond)
+		out += sess.ReadAndClear()
+	}
+	if !strings.Contains(out, "got:hello") {
+		t.Errorf("Expected the remote shell's reply, got %q", out)
+	}
+
+	sess.Write([]byte("exit\n"))
+	select {
+	case <-sess.exited:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Session did not exit when the remote shell did")
+	}
+	sess.reap()
+	if code := sess.ExitCode(); code == nil || *code != 3 {
+		t.Errorf("Expected exit code 3, got %v", code)
+	}
+
+	// Reconnecting keeps the transport; the deferred Remove then closes a
+	// live native connection
+	req.Params.Arguments = map[string]any{"session_id": "native-test"}
+	result, _ = reconnectSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; result.IsError {
+		t.Fatalf("reconnect_session failed: %s", text)
+	}
+	if fresh, _ := manager.Lookup("native-test"); fresh.native == nil || !fresh.Alive() {
+		t.Errorf("Expected a live native session after reconnecting")
+	}
+}
+
+func TestNativeTransportDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() // Nothing listens there any more
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "127.0.0.1", "port": port, "transport": "native", "retries": 1, "retry_delay": "0.01"}
+	result, _ := startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; !result.IsError || !strings.Contains(text, "connection refused") {
+		t.Errorf("Expected a connection refused error, got: %s", text)
+	}
+
+	req.Params.Arguments = map[string]any{"host": "127.0.0.1", "transport": "carrier-pigeon"}
+	result, _ = startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; !result.IsError || !strings.Contains(text, "Invalid transport") {
+		t.Errorf("Expected an unknown transport to be rejected, got: %s", text)
+	}
+}
+
+// noDeadlineConn is a connection without deadline support, like a channel
+// tunnelled through a jump host.
+type noDeadlineConn struct{ net.Conn }
+
+func (noDeadlineConn) SetDeadline(time.Time) error { return fmt.Errorf("deadline not supported") }
+
+func TestNativeHandshakeTimeout(t *testing.T) {
+	// The server accepts the connection but never says a word
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := &ssh.ClientConfig{User: "tester", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	for name, wrap := range map[string]func(net.Conn) net.Conn{
+		"direct":    func(c net.Conn) net.Conn { return c },
+		"tunnelled": func(c net.Conn) net.Conn { return noDeadlineConn{c} },
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if _, err := clientConn(wrap(conn), ln.Addr().String(), cfg, 200*time.Millisecond); err == nil {
+			t.Errorf("%s: expected the handshake to fail", name)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: expected the handshake to give up after the timeout, took %v", name, elapsed)
+		}
+	}
+}
+
+func TestNativePassword(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "s3cret")
+
+	start := func(args map[string]any) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := startSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	if text, isErr := start(map[string]any{"host": "127.0.0.1", "port": port, "password": "s3cret", "transport": "exec"}); !isErr || !strings.Contains(text, "requires the native transport") {
+		t.Errorf("Expected password with the exec transport to be rejected, got: %s", text)
+	}
+	if text, isErr := start(map[string]any{"host": "127.0.0.1", "port": port, "password": "wrong"}); !isErr || !strings.Contains(text, "unable to authenticate") {
+		t.Errorf("Expected a wrong password to fail authentication, got: %s", text)
+	}
+	// No transport given: a password implies native
+	if text, isErr := start(map[string]any{"host": "127.0.0.1", "port": port, "password": "s3cret", "name": "pw-test"}); isErr {
+		t.Fatalf("start_session with the right password failed: %s", text)
+	}
+	sess, _ := manager.Lookup("pw-test")
+	defer manager.Remove(sess.ID)
+	if !sess.Alive() || sess.native == nil {
+		t.Errorf("Expected a live native session")
+	}
+	if d := sess.describe(); strings.Contains(fmt.Sprint(d), "s3cret") {
+		t.Errorf("describe must not reveal the password: %+v", d)
+	}
+}
+
+func TestLoadIdentityFile(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("open sesame"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, "id_test"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := resolveIdentityFile("~/id_test")
+	if err != nil || path != filepath.Join(home, "id_test") {
+		t.Fatalf("resolveIdentityFile = %q, %v", path, err)
+	}
+	if _, err := resolveIdentityFile(home); err == nil {
+		t.Errorf("Expected a directory to be rejected")
+	}
+
+	if _, err := loadIdentityFile(path, ""); err == nil || !strings.Contains(err.Error(), "passphrase-protected") {
+		t.Errorf("Expected a missing passphrase to be reported, got %v", err)
+	}
+	if _, err := loadIdentityFile(path, "wrong"); err == nil {
+		t.Errorf("Expected a wrong passphrase to fail")
+	}
+	signer, err := loadIdentityFile(path, "open sesame")
+	if err != nil {
+		t.Fatalf("loadIdentityFile failed: %v", err)
+	}
+	want, _ := ssh.NewPublicKey(key.Public())
+	if string(signer.PublicKey().Marshal()) != string(want.Marshal()) {
+		t.Errorf("Loaded the wrong key")
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "web01", "passphrase": "open sesame"}
+	result, _ := startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; !result.IsError || !strings.Contains(text, "requires identity_file") {
+		t.Errorf("Expected passphrase without identity_file to be rejected, got: %s", text)
+	}
+}
+
+func TestNativeJumpHosts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "")
+	jump := fmt.Sprintf("bastion-user@127.0.0.1:%d", port) // The same server doubles as the bastion
+	before := testSSHForwards.Load()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"host": "127.0.0.1", "port": port, "transport": "native", "name": "jump-test", "jump_hosts": []any{jump}}
+	result, _ := startSessionHandler(context.Background(), req)
+	if text := result.Content[0].(mcp.TextContent).Text; result.IsError {
+		t.Fatalf("start_session through a jump host failed: %s", text)
+	}
+	sess, _ := manager.Lookup("jump-test")
+	defer manager.Remove(sess.ID)
+
+	if got := testSSHForwards.Load() - before; got != 1 {
+		t.Errorf("Expected the connection to be tunnelled through the jump host once, got %d", got)
+	}
+	if len(sess.native.jumps) != 1 {
+		t.Errorf("Expected one jump connection, got %d", len(sess.native.jumps))
+	}
+	if d := sess.describe(); len(d.JumpHosts) != 1 || d.JumpHosts[0] != jump {
+		t.Errorf("Expected describe to list the jump host, got %v", d.JumpHosts)
+	}
+	sess.Write([]byte("via-bastion\n"))
+	deadline := time.Now().Add(2 * time.Second)
+	var out string
+	for time.Now().Before(deadline) && !strings.Contains(out, "got:via-bastion") {
+		time.Sleep(20 * time.Millisecond)
+		out += sess.ReadAndClear()
+	}
+	if !strings.Contains(out, "got:via-bastion") {
+		t.Errorf("Expected the remote shell's reply, got %q", out)
+	}
+}
+
+func TestNativeUpload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "127.0.0.1", "port": port, "transport": "native", "name": "native-upload"}); isErr {
+		t.Fatalf("start_session failed: %s", text)
+	}
+	sess, _ := manager.Lookup("native-upload")
+	defer manager.Remove(sess.ID)
+
+	dest := filepath.Join(t.TempDir(), "payload.bin")
+	if text, isErr := callTool(uploadFileHandler, map[string]any{"session_id": "native-upload", "remote_path": dest, "content_base64": base64.StdEncoding.EncodeToString(binaryPayload)}); isErr {
+		t.Fatalf("upload_file failed: %s", text)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Uploaded content = %q, want %q", got, binaryPayload)
+	}
+	if !sess.Alive() {
+		t.Errorf("The interactive session should be unaffected by the transfer")
+	}
+}
+
+func TestNativeDownload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "127.0.0.1", "port": port, "transport": "native", "name": "native-download"}); isErr {
+		t.Fatalf("start_session failed: %s", text)
+	}
+	sess, _ := manager.Lookup("native-download")
+	defer manager.Remove(sess.ID)
+
+	src := filepath.Join(t.TempDir(), "artifact.bin")
+	os.WriteFile(src, binaryPayload, 0o644)
+	text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": "native-download", "remote_path": src, "format": "json"})
+	var res downloadResult
+	if err := json.Unmarshal([]byte(text), &res); isErr || err != nil {
+		t.Fatalf("download_file failed: %s", text)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(res.Content); !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Downloaded content = %q, want %q", got, binaryPayload)
+	}
+}
+
+func TestNativeHostKeyPolicy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "")
+	start := func(args map[string]any) (string, bool) {
+		args["host"], args["port"], args["transport"], args["format"] = "127.0.0.1", port, "native", "json"
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := startSessionHandler(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	if text, isErr := start(map[string]any{"host_key_policy": "strict"}); !isErr || !strings.Contains(text, "host_key_policy strict") {
+		t.Errorf("Expected strict to refuse an unknown host, got: %s", text)
+	}
+	if text, isErr := start(map[string]any{"host_key_policy": "trust-me"}); !isErr || !strings.Contains(text, "Invalid host_key_policy") {
+		t.Errorf("Expected an unknown policy to be rejected, got: %s", text)
+	}
+
+	text, isErr := start(map[string]any{"name": "hostkey-new"})
+	if isErr {
+		t.Fatalf("start_session failed: %s", text)
+	}
+	if sess, ok := manager.Lookup("hostkey-new"); ok {
+		defer manager.Remove(sess.ID)
+	}
+	var res startResult
+	json.Unmarshal([]byte(text), &res)
+	if len(res.NewHostKeys) != 1 || !strings.Contains(res.NewHostKeys[0], fmt.Sprintf("[127.0.0.1]:%d ED25519 SHA256:", port)) {
+		t.Errorf("Expected the accepted key's fingerprint, got %v", res.NewHostKeys)
+	}
+	if data, err := os.ReadFile(filepath.Join(home, ".ssh", "known_hosts")); err != nil || !strings.Contains(string(data), fmt.Sprintf("[127.0.0.1]:%d ssh-ed25519 ", port)) {
+		t.Errorf("Expected the key in known_hosts, got %q, %v", data, err)
+	}
+
+	// Now known: strict connects, and nothing new is reported
+	text, isErr = start(map[string]any{"name": "hostkey-strict", "host_key_policy": "strict"})
+	if isErr {
+		t.Fatalf("strict start_session for a known host failed: %s", text)
+	}
+	if sess, ok := manager.Lookup("hostkey-strict"); ok {
+		defer manager.Remove(sess.ID)
+	}
+	res = startResult{}
+	json.Unmarshal([]byte(text), &res)
+	if len(res.NewHostKeys) != 0 {
+		t.Errorf("Expected no new host keys, got %v", res.NewHostKeys)
+	}
+
+	// A changed key is refused under accept-new but not under off
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(other)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	hostname := fmt.Sprintf("127.0.0.1:%d", port)
+	accepted := func(key string) { t.Errorf("Unexpectedly accepted %s", key) }
+	if err := nativeHostKeyCallback(HostKeyAcceptNew, accepted)(hostname, addr, signer.PublicKey()); err == nil {
+		t.Errorf("Expected a changed host key to be refused")
+	}
+	if err := nativeHostKeyCallback(HostKeyOff, accepted)(hostname, addr, signer.PublicKey()); err != nil {
+		t.Errorf("Expected off to skip verification, got %v", err)
+	}
+}
+
+func TestNativeKeepAlive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port, _ := startTestSSHServer(t, "")
+
+	before := testSSHKeepalives.Load()
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": "127.0.0.1", "port": port, "user": "tester", "name": "keepalive-test", "transport": "native", "server_alive_interval": 1, "server_alive_count_max": 2})
+	if isErr {
+		t.Fatalf("start_session failed: %s", text)
+	}
+	sess, _ := manager.Lookup("keepalive-test")
+	defer manager.Remove(sess.ID)
+	if text, _ := callTool(describeSessionHandler, map[string]any{"session_id": "keepalive-test"}); !strings.Contains(text, "Keepalive: every 1s, dropped after 2 unanswered") {
+		t.Errorf("Expected describe to show the keepalive settings, got: %s", text)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testSSHKeepalives.Load()-before < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := testSSHKeepalives.Load() - before; n < 2 {
+		t.Fatalf("Expected keepalive requests every second, got %d", n)
+	}
+	if !sess.Alive() {
+		t.Errorf("Expected answered keepalives to keep the session alive")
+	}
+
+	// A server that stops answering is dropped after count_max intervals
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+		if err != nil {
+			return
+		}
+		go func() {
+			for range chans {
+			}
+		}()
+		for range reqs {
+			// Never answered
+		}
+	}()
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{User: "tester", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc := &nativeConn{client: client, waited: make(chan struct{})}
+	defer close(nc.waited)
+	go nc.keepAlive(100*time.Millisecond, 2)
+	dropped := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(dropped)
+	}()
+	select {
+	case <-dropped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the unresponsive connection to be dropped")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxNotifyTail bounds the end of the unread output quoted in an output
+// notification.
+const maxNotifyTail = 200
+
+// outputNotice is the data of the logging notification announcing unread
+// output in a notify_output session.
+type outputNotice struct {
+	SessionID   string `json:"session_id"`
+	Name        string `json:"name,omitempty"`
+	NewBytes    int64  `json:"new_bytes"`    // Arrived since the last notice
+	UnreadBytes int    `json:"unread_bytes"` // What interact_session would return
+	Alive       bool   `json:"alive"`
+	Tail        string `json:"tail"` // End of the unread output, escape sequences removed
+}
+
+// notifyOutput sends every connected client a logging notification for each
+// notify_output session with output no tool call has read. Output counts
+// once: a notice covers what arrived since the previous one. Nothing is sent
+// while a tool call is (or was just) using the session, since it reads the
+// output itself; whatever it leaves unread is announced on a later poll.
+func (rw *resourceWatcher) notifyOutput(sessions map[string]*Session) {
+	var notices []outputNotice
+	rw.mu.Lock()
+	for id := range rw.notified {
+		if sessions[id] == nil {
+			delete(rw.notified, id)
+		}
+	}
+	for id, sess := range sessions {
+		off := sess.OutputOffset()
+		last, seen := rw.notified[id]
+		if !seen || off < last {
+			rw.notified[id] = off // New, or replaced by a fresh process: start here
+			continue
+		}
+		if off == last || time.Since(sess.LastUsed()) < resourcePollInterval {
+			continue
+		}
+		rw.notified[id] = off
+		if !sess.notifyOutput {
+			continue
+		}
+		unread := sess.Peek()
+		if unread == "" {
+			continue
+		}
+		tail := stripANSI(unread)
+		if len(tail) > maxNotifyTail {
+			tail = strings.ToValidUTF8(tail[len(tail)-maxNotifyTail:], "")
+		}
+		notices = append(notices, outputNotice{SessionID: id, Name: sess.Name(), NewBytes: off - last, UnreadBytes: len(unread), Alive: sess.Alive(), Tail: tail})
+	}
+	clients := make([]string, 0, len(rw.clients))
+	for client := range rw.clients {
+		clients = append(clients, client)
+	}
+	rw.mu.Unlock()
+
+	for _, notice := range notices {
+		// Sent whatever level the client chose with logging/setLevel, which
+		// defaults to error: the session asked for these
+		params := map[string]any{"level": mcp.LoggingLevelNotice, "logger": "mcpssh", "data": notice}
+		for _, client := range clients {
+			if err := rw.srv.SendNotificationToSpecificClient(client, "notifications/message", params); err != nil {
+				logger.Debug("output notification not delivered", "session_id", notice.SessionID, "client", client, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestOutputNotifications(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	notices := make(chan outputNotice, 16)
+	startTestClient(t, ctx, func(n mcp.JSONRPCNotification) {
+		if n.Method != "notifications/message" {
+			return
+		}
+		var notice outputNotice
+		data, _ := json.Marshal(n.Params.AdditionalFields["data"])
+		if json.Unmarshal(data, &notice) == nil {
+			notices <- notice
+		}
+	})
+
+	for _, name := range []string{"notify-test", "quiet-test"} {
+		if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": name, "notify_output": name == "notify-test"}); isErr {
+			t.Skipf("Skipping local session test: %s", text)
+		}
+		sess, _ := manager.Lookup(name)
+		defer manager.Remove(sess.ID)
+		// Written directly, as a background job's output would arrive
+		sess.Write([]byte("sleep 1; echo job-$((6*7))\n"))
+	}
+	sess, _ := manager.Lookup("notify-test")
+	deadline := time.After(8 * time.Second)
+	for {
+		select {
+		case notice := <-notices:
+			if notice.Name == "quiet-test" {
+				t.Fatal("Expected no notifications for a session without notify_output")
+			}
+			if notice.SessionID != sess.ID || !strings.Contains(notice.Tail, "job-42") {
+				continue // The echoed command line may be announced first
+			}
+			if !notice.Alive || notice.UnreadBytes == 0 {
+				t.Errorf("Unexpected notice: %+v", notice)
+			}
+			if !strings.Contains(sess.Peek(), "job-42") {
+				t.Error("Expected the output to stay unread")
+			}
+			return
+		case <-deadline:
+			t.Fatal("Timed out waiting for an output notification")
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import "unicode/utf8"
+
+// outputBuffer holds a session's unread output. Once it exceeds its limit
+// it discards the oldest bytes, so a session spewing output nobody reads
+// (a forgotten `yes`, a verbose build) can't exhaust memory. The zero value
+// is an unbounded buffer.
+//
+// Alongside, it keeps a log of the most recent output, read or not, under
+// the same limit. Log offsets count every byte ever written, so readers
+// passing the offset they got to can re-read and resume without taking
+// output from each other.
+type outputBuffer struct {
+	data    []byte
+	limit   int   // Most bytes kept; 0 means unlimited
+	dropped int64 // Bytes discarded since the last takeDropped
+	total   int64 // Bytes discarded over the buffer's lifetime
+
+	log      []byte
+	logStart int64 // Offset of log[0]
+}
+
+// Write appends p, then drops the oldest bytes beyond the limit. It never
+// fails.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if cut := b.overflow(b.data); cut > 0 {
+		b.dropped += int64(cut)
+		b.total += int64(cut)
+		// Slicing off the front lets append reallocate at roughly twice the
+		// limit, copying only what is kept
+		b.data = b.data[cut:]
+	}
+	b.log = append(b.log, p...)
+	if cut := b.overflow(b.log); cut > 0 {
+		b.logStart += int64(cut)
+		b.log = b.log[cut:]
+	}
+	return len(p), nil
+}
+
+// overflow returns how many bytes to drop from the front of data to bring
+// it within the limit.
+func (b *outputBuffer) overflow(data []byte) int {
+	if b.limit <= 0 || len(data) <= b.limit {
+		return 0
+	}
+	cut := len(data) - b.limit
+	// Don't leave half a UTF-8 character at the front
+	for i := 0; i < utf8.UTFMax-1 && cut < len(data) && !utf8.RuneStart(data[cut]); i++ {
+		cut++
+	}
+	return cut
+}
+
+// WriteString appends s like Write.
+func (b *outputBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// Len returns the number of buffered bytes.
+func (b *outputBuffer) Len() int { return len(b.data) }
+
+// Bytes returns the buffered bytes, valid until the next modification.
+func (b *outputBuffer) Bytes() []byte { return b.data }
+
+// String returns the buffered bytes as a string.
+func (b *outputBuffer) String() string { return string(b.data) }
+
+// Next removes and returns the first n buffered bytes.
+func (b *outputBuffer) Next(n int) []byte {
+	n = min(n, len(b.data))
+	out := b.data[:n:n]
+	b.data = b.data[n:]
+	return out
+}
+
+// Reset empties the buffer, releasing its memory.
+func (b *outputBuffer) Reset() {
+	b.data = nil
+}
+
+// end returns the offset just past the last byte written.
+func (b *outputBuffer) end() int64 { return b.logStart + int64(len(b.log)) }
+
+// since returns the logged output from offset off on, and the offset it
+// starts at: later than off if the output there has been dropped.
+func (b *outputBuffer) since(off int64) ([]byte, int64) {
+	off = min(max(off, b.logStart), b.end())
+	return b.log[off-b.logStart:], off
+}
+
+// takeDropped returns how many bytes were discarded since the last call.
+func (b *outputBuffer) takeDropped() int64 {
+	n := b.dropped
+	b.dropped = 0
+	return n
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOutputBufferLimit(t *testing.T) {
+	b := outputBuffer{limit: 10}
+	b.WriteString("0123456")
+	b.WriteString("789abc")
+	if got := b.String(); got != "3456789abc" {
+		t.Errorf("Expected the last 10 bytes, got %q", got)
+	}
+	if n := b.takeDropped(); n != 3 {
+		t.Errorf("Expected 3 dropped bytes, got %d", n)
+	}
+	if n := b.takeDropped(); n != 0 {
+		t.Errorf("takeDropped should reset, got %d", n)
+	}
+
+	// A long stream stays bounded
+	for range 10000 {
+		b.WriteString("yyyyyyyyyy\n")
+	}
+	if b.Len() != 10 || cap(b.data) > 1024 {
+		t.Errorf("Expected the buffer to stay bounded, len %d cap %d", b.Len(), cap(b.data))
+	}
+	if b.total != 13+10000*11-10 {
+		t.Errorf("Expected a lifetime total of %d, got %d", 13+10000*11-10, b.total)
+	}
+
+	b.Reset()
+	if got := string(b.Next(3)); got != "" {
+		t.Errorf("Next on an empty buffer = %q", got)
+	}
+	b.WriteString("ab\ncd")
+	if got := string(b.Next(3)); got != "ab\n" || b.String() != "cd" {
+		t.Errorf("Next = %q, rest %q", got, b.String())
+	}
+}
+
+func TestOutputBufferLog(t *testing.T) {
+	b := outputBuffer{limit: 10}
+	b.WriteString("0123456")
+	b.Reset() // Reading doesn't touch the log
+	if data, start := b.since(2); string(data) != "23456" || start != 2 {
+		t.Errorf("since(2) = %q at %d", data, start)
+	}
+	b.WriteString("789abc")
+	if b.end() != 13 {
+		t.Errorf("Expected the end at 13, got %d", b.end())
+	}
+	if data, start := b.since(0); string(data) != "3456789abc" || start != 3 {
+		t.Errorf("Expected the log to keep the last 10 bytes from offset 3, got %q at %d", data, start)
+	}
+	if data, start := b.since(20); len(data) != 0 || start != 13 {
+		t.Errorf("Expected nothing past the end, got %q at %d", data, start)
+	}
+	for range 10000 {
+		b.WriteString("yyyyyyyyyy\n")
+	}
+	if len(b.log) != 10 || cap(b.log) > 1024 {
+		t.Errorf("Expected the log to stay bounded, len %d cap %d", len(b.log), cap(b.log))
+	}
+}
+
+func TestOutputBufferUTF8(t *testing.T) {
+	b := outputBuffer{limit: 5}
+	b.WriteString("ab✓✓") // Each check mark is 3 bytes
+	if got := b.String(); !utf8.ValidString(got) || !strings.HasSuffix(got, "✓") {
+		t.Errorf("Expected whole characters only, got %q", got)
+	}
+	if b.total+int64(b.Len()) != int64(len("ab✓✓")) {
+		t.Errorf("Dropped and kept bytes don't add up: %d + %d", b.total, b.Len())
+	}
+
+	var unbounded outputBuffer
+	unbounded.WriteString(strings.Repeat("x", 1<<16))
+	if unbounded.Len() != 1<<16 || unbounded.total != 0 {
+		t.Errorf("The zero value should not drop anything")
+	}
+}
+
+func TestInteractReportsBufferOverflow(t *testing.T) {
+	saved := config.MaxBufferBytes
+	defer func() { config.MaxBufferBytes = saved }()
+	config.MaxBufferBytes = 1000
+
+	sess := startTestSession(t, "test-buffer-overflow", "/bin/sh")
+
+	text, _ := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": "yes | head -c 50000\n", "wait_duration": "1"})
+	if !strings.Contains(text, "bytes of earlier output were discarded") {
+		t.Errorf("Expected a note about discarded output, got %q", text)
+	}
+	if len(text) > 2000 {
+		t.Errorf("Expected at most the buffer limit of output, got %d bytes", len(text))
+	}
+	if d := sess.describe(); d.DroppedBytes < 40000 {
+		t.Errorf("Expected describe to count the discarded bytes, got %d", d.DroppedBytes)
+	}
+}
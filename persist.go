@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// restoredReason is the dead reason of sessions loaded from saved state.
+const restoredReason = "server restarted; use reconnect_session"
+
+// StateStore persists session metadata to a JSON file so that sessions
+// outlive a server restart, as dead entries reconnect_session can revive.
+// The PTY and process obviously can't be saved. A nil store is disabled.
+type StateStore struct {
+	path   string
+	mu     sync.Mutex // Serializes writes so the file always holds the latest snapshot
+	frozen bool
+}
+
+var state = newStateStore(config.StateFile)
+
+func newStateStore(path string) *StateStore {
+	if path == "" {
+		return nil
+	}
+	return &StateStore{path: path}
+}
+
+// sessionRecord is the saved form of a session.
+type sessionRecord struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name,omitempty"`
+	Host           string    `json:"host"`
+	Tags           []string  `json:"tags,omitempty"`
+	User           string    `json:"user,omitempty"`
+	Port           int       `json:"port,omitempty"`
+	PTYMode        string    `json:"pty_mode,omitempty"`
+	Transport      string    `json:"transport,omitempty"`
+	IdentityFile   string    `json:"identity_file,omitempty"`
+	JumpHosts      []string  `json:"jump_hosts,omitempty"`
+	HostKeyPolicy  string    `json:"host_key_policy,omitempty"`
+	AliveInterval  int       `json:"server_alive_interval,omitempty"`
+	AliveCountMax  int       `json:"server_alive_count_max,omitempty"`
+	Backing        string    `json:"backing,omitempty"`
+	BackingSession string    `json:"backing_session,omitempty"`
+	Term           string    `json:"term,omitempty"`
+	Command        []string  `json:"command,omitempty"`
+	PodContainer   string    `json:"pod_container,omitempty"`
+	Dir            string    `json:"dir,omitempty"` // Of a local shell
+	Rows           int       `json:"rows,omitempty"`
+	Cols           int       `json:"cols,omitempty"`
+	KeepAlive      bool      `json:"keep_alive,omitempty"`
+	ReadOnly       bool      `json:"read_only,omitempty"`
+	AutoReconnect  bool      `json:"auto_reconnect,omitempty"`
+	RestoreCwd     bool      `json:"restore_cwd,omitempty"`
+	NotifyOutput   bool      `json:"notify_output,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// records snapshots the metadata of every registered session, oldest first.
+func (sm *SessionManager) records() []sessionRecord {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	records := make([]sessionRecord, 0, len(sm.sessions))
+	for _, sess := range sm.sessions {
+		rec := sessionRecord{
+			ID:           sess.ID,
+			Name:         sess.Name(),
+			Host:         sess.Host,
+			Tags:         slices.Clone(sess.Tags),
+			Term:         sess.Term,
+			Command:      slices.Clone(sess.Command),
+			PodContainer: sess.PodContainer,
+			CreatedAt:    sess.CreatedAt,
+		}
+		rec.Rows, rec.Cols = sess.Size()
+		rec.KeepAlive = sess.keepAlive
+		rec.ReadOnly = sess.readOnly
+		rec.AutoReconnect, rec.RestoreCwd = sess.autoReconnect, sess.restoreCwd
+		rec.NotifyOutput = sess.notifyOutput
+		if sess.SSH != nil {
+			rec.User = sess.SSH.User
+			rec.Port = sess.SSH.Port
+			rec.PTYMode = sess.SSH.PTYMode
+			rec.Transport = sess.SSH.Transport
+			rec.IdentityFile = sess.SSH.IdentityFile
+			rec.JumpHosts = sess.SSH.JumpHosts
+			rec.HostKeyPolicy = sess.SSH.HostKeyPolicy
+			rec.AliveInterval, rec.AliveCountMax = sess.SSH.AliveInterval, sess.SSH.AliveCountMax
+			rec.Backing = sess.SSH.Backing
+			rec.BackingSession = sess.SSH.BackingSession
+		} else if sess.Cmd != nil {
+			rec.Dir = sess.Cmd.Dir
+		}
+		records = append(records, rec)
+	}
+	slices.SortFunc(records, func(a, b sessionRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return records
+}
+
+// Save writes the current sessions to the state file. Callers must not hold
+// sm.mu. Failures are logged rather than failing the tool call that
+// triggered the save.
+func (st *StateStore) Save(sm *SessionManager) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.frozen {
+		return
+	}
+	data, err := json.MarshalIndent(sm.records(), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(st.path, data)
+	}
+	if err != nil {
+		logger.Warn("failed to save session state", "path", st.path, "err", err)
+	}
+}
+
+// Freeze stops further saves, so tearing sessions down at shutdown leaves
+// them in the state file for the next start.
+func (st *StateStore) Freeze() {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.frozen = true
+}
+
+// Restore registers the saved sessions as dead entries and returns how many
+// were loaded. A missing state file is not an error.
+func (st *StateStore) Restore(sm *SessionManager) (int, error) {
+	if st == nil {
+		return 0, nil
+	}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var records []sessionRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return 0, fmt.Errorf("%s: %w", st.path, err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	restored := 0
+	for _, rec := range records {
+		if rec.ID == "" || rec.Host == "" || sm.nameTaken(rec.ID, "") || (rec.Name != "" && sm.nameTaken(rec.Name, rec.ID)) {
+			continue
+		}
+		sess := restoredSession(rec)
+		sm.sessions[rec.ID] = sess
+		sm.setName(sess, sess.Name())
+		restored++
+	}
+	return restored, nil
+}
+
+// restoredSession builds a dead session from a saved record. It never had a
+// process; reconnect_session replaces it with a live one.
+func restoredSession(rec sessionRecord) *Session {
+	sess := &Session{
+		ID:            rec.ID,
+		name:          rec.Name,
+		Tags:          rec.Tags,
+		Host:          rec.Host,
+		Term:          rec.Term,
+		Command:       rec.Command,
+		PodContainer:  rec.PodContainer,
+		Cmd:           &exec.Cmd{Dir: rec.Dir},
+		CreatedAt:     rec.CreatedAt,
+		restored:      true,
+		rows:          rec.Rows,
+		keepAlive:     rec.KeepAlive,
+		readOnly:      rec.ReadOnly,
+		autoReconnect: rec.AutoReconnect,
+		restoreCwd:    rec.RestoreCwd,
+		notifyOutput:  rec.NotifyOutput,
+		cols:          rec.Cols,
+		done:          make(chan struct{}),
+		exited:        make(chan struct{}),
+	}
+	if isSSHHost(rec.Host) {
+		sess.SSH = &SSHOptions{Host: rec.Host, User: rec.User, Port: rec.Port, PTYMode: rec.PTYMode, Transport: rec.Transport, IdentityFile: rec.IdentityFile, JumpHosts: rec.JumpHosts, HostKeyPolicy: rec.HostKeyPolicy,
+			AliveInterval: rec.AliveInterval, AliveCountMax: rec.AliveCountMax,
+			Command: rec.Command, Backing: rec.Backing, BackingSession: rec.BackingSession}
+	}
+	sess.stopOnce.Do(func() { close(sess.done) })
+	sess.exitOnce.Do(func() {
+		sess.deadReason = restoredReason
+		close(sess.exited)
+	})
+	return sess
+}
+
+// writeFileAtomic replaces path with data via a temporary file and a rename,
+// so a crash mid-write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestStateStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	st := newStateStore(path)
+
+	sm := &SessionManager{sessions: make(map[string]*Session)}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	sm.sessions["s1"] = &Session{ID: "s1", name: "db", Host: "db01", Tags: []string{"prod"}, CreatedAt: created,
+		SSH: &SSHOptions{Host: "db01", User: "deploy", Port: 2222, PTYMode: PTYForce, ControlPath: "/tmp/gone/%C"}}
+	sm.sessions["s2"] = &Session{ID: "s2", Host: "local", CreatedAt: created.Add(time.Minute)}
+	st.Save(sm)
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the state file after an atomic write, found %d entries", len(entries))
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "/tmp/gone") {
+		t.Errorf("Per-process control paths must not be persisted:\n%s", data)
+	}
+
+	restored := &SessionManager{sessions: make(map[string]*Session)}
+	n, err := st.Restore(restored)
+	if err != nil || n != 2 {
+		t.Fatalf("Restore = %d, %v; want 2 sessions", n, err)
+	}
+	db, ok := restored.Lookup("db")
+	if !ok {
+		t.Fatalf("Expected the session to be found by name after restore")
+	}
+	if db.Alive() || db.DeadReason() != restoredReason {
+		t.Errorf("Expected restored sessions to be dead with reason %q, got alive=%v reason=%q", restoredReason, db.Alive(), db.DeadReason())
+	}
+	if db.SSH == nil || db.SSH.User != "deploy" || db.SSH.Port != 2222 || !db.CreatedAt.Equal(created) || db.Tags[0] != "prod" {
+		t.Errorf("Restored metadata mismatch: %+v %+v", db, db.SSH)
+	}
+	if local, _ := restored.Get("s2"); local.SSH != nil {
+		t.Errorf("Expected the local session to be restored without SSH options")
+	}
+	db.Close() // Closing a restored session must be harmless
+
+	st.Freeze()
+	delete(sm.sessions, "s1")
+	st.Save(sm)
+	if again, _ := st.Restore(&SessionManager{sessions: make(map[string]*Session)}); again != 2 {
+		t.Errorf("Expected no saves after Freeze, but the file now holds %d sessions", again)
+	}
+}
+
+func TestStateStoreMissingFile(t *testing.T) {
+	st := newStateStore(filepath.Join(t.TempDir(), "none.json"))
+	if n, err := st.Restore(&SessionManager{sessions: make(map[string]*Session)}); n != 0 || err != nil {
+		t.Errorf("Expected a missing state file to restore nothing without error, got %d, %v", n, err)
+	}
+	var disabled *StateStore
+	disabled.Save(manager) // A nil store is disabled
+}
+
+func TestReconnectRestoredSession(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	sess := restoredSession(sessionRecord{ID: "test-restored", Name: "scratchpad", Host: "local", CreatedAt: time.Now()})
+	if err := manager.Add(sess); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Remove(sess.ID)
+
+	call := func(h func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) (string, bool) {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, _ := h(context.Background(), req)
+		return result.Content[0].(mcp.TextContent).Text, result.IsError
+	}
+
+	if text, _ := call(interactSessionHandler, map[string]any{"session_id": "scratchpad"}); !strings.Contains(text, "reconnect_session") {
+		t.Errorf("Expected a reconnect hint for a restored session, got: %s", text)
+	}
+	if _, ok := manager.Get(sess.ID); !ok {
+		t.Fatalf("Restored session must stay registered until revived")
+	}
+	if text, isErr := call(reconnectSessionHandler, map[string]any{"session_id": "scratchpad"}); isErr {
+		t.Fatalf("reconnect_session failed: %s", text)
+	}
+	if text, _ := call(interactSessionHandler, map[string]any{"session_id": sess.ID, "input": "echo revived-$((3*3))\n"}); !strings.Contains(text, "revived-9") {
+		t.Errorf("Expected the revived session to run commands, got: %s", text)
+	}
+	if text, isErr := call(reconnectSessionHandler, map[string]any{"session_id": sess.ID}); !isErr || !strings.Contains(text, "still alive") {
+		t.Errorf("Expected reconnecting a live session to be refused, got: %s", text)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy rule actions.
+const (
+	PolicyAllow   = "allow"   // Send the line
+	PolicyDeny    = "deny"    // Refuse the input
+	PolicyConfirm = "confirm" // Ask the user, via MCP elicitation, before sending
+)
+
+// policyRule is one rule of the input policy.
+type policyRule struct {
+	Action  string `yaml:"action"`
+	Pattern string `yaml:"pattern"`
+	Reason  string `yaml:"reason"`
+	re      *regexp.Regexp
+}
+
+// inputPolicy decides, line by line, whether input may be written to a
+// session. The first rule whose pattern matches a line applies; lines no
+// rule matches get the default action, so default deny turns the rules
+// into an allowlist. A nil policy allows everything.
+type inputPolicy struct {
+	Default string        `yaml:"default"`
+	Rules   []*policyRule `yaml:"rules"`
+}
+
+// policy is the operator's input policy (MCPSSH_POLICY_FILE), or nil.
+var policy *inputPolicy
+
+// loadPolicy reads and compiles the policy file at path; an empty path
+// means no policy.
+func loadPolicy(path string) (*inputPolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	p := &inputPolicy{Default: PolicyAllow}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	if p.Default != PolicyAllow && p.Default != PolicyDeny && p.Default != PolicyConfirm {
+		return nil, fmt.Errorf("policy %s: invalid default %q (want %s, %s or %s)", path, p.Default, PolicyAllow, PolicyDeny, PolicyConfirm)
+	}
+	for i, rule := range p.Rules {
+		if rule.Action != PolicyAllow && rule.Action != PolicyDeny && rule.Action != PolicyConfirm {
+			return nil, fmt.Errorf("policy %s: rule %d: invalid action %q (want %s, %s or %s)", path, i+1, rule.Action, PolicyAllow, PolicyDeny, PolicyConfirm)
+		}
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("policy %s: rule %d: pattern is required", path, i+1)
+		}
+		if rule.re, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("policy %s: rule %d: %w", path, i+1, err)
+		}
+	}
+	return p, nil
+}
+
+// decide returns the action for one line of input and the rule that chose
+// it, or nil if it is the default.
+func (p *inputPolicy) decide(line string) (string, *policyRule) {
+	for _, rule := range p.Rules {
+		if rule.re.MatchString(line) {
+			return rule.Action, rule
+		}
+	}
+	return p.Default, nil
+}
+
+// policyLines splits input into the lines the policy judges. Lines that are
+// only whitespace and control characters (Enter, Ctrl-C, arrow keys) are
+// keystrokes rather than commands, and are skipped.
+func policyLines(input string) []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(input, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if strings.IndexFunc(line, func(r rune) bool { return !unicode.IsSpace(r) && !unicode.IsControl(r) }) >= 0 {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
+
+// check applies the policy to input bound for sessID. Lines needing
+// confirmation are put to the user in one elicitation request; without a
+// client able to answer, they are refused like denied lines.
+func (p *inputPolicy) check(ctx context.Context, sessID, input string) error {
+	if p == nil {
+		return nil
+	}
+	var confirm []string
+	for _, line := range policyLines(input) {
+		action, rule := p.decide(line)
+		switch action {
+		case PolicyDeny:
+			logger.Warn("input denied by policy", "session_id", sessID, "rule", ruleName(rule), "input", line)
+			return fmt.Errorf("policy violation: %q was refused (%s); the input was not sent", line, ruleReason(rule, "not allowed by the server's command policy"))
+		case PolicyConfirm:
+			confirm = append(confirm, fmt.Sprintf("%s (%s)", line, ruleReason(rule, "not on the allowlist")))
+		}
+	}
+	if len(confirm) == 0 {
+		return nil
+	}
+	if err := confirmInput(ctx, sessID, confirm); err != nil {
+		logger.Warn("input not confirmed", "session_id", sessID, "input", input, "err", err)
+		return fmt.Errorf("policy violation: sending %s requires the user's confirmation, which was not given (%v); the input was not sent", strings.Join(confirm, ", "), err)
+	}
+	logger.Info("input confirmed by the user", "session_id", sessID, "input", input)
+	return nil
+}
+
+// confirmInput asks the user, through the MCP client, whether lines may be
+// sent to session sessID.
+func confirmInput(ctx context.Context, sessID string, lines []string) error {
+	s := server.ServerFromContext(ctx)
+	if s == nil {
+		return errors.New("no MCP client to ask")
+	}
+	result, err := s.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: fmt.Sprintf("The server's command policy requires your confirmation to send to session %s:\n\n%s\n\nSend it?",
+				sessID, strings.Join(lines, "\n")),
+			RequestedSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+		},
+	})
+	switch {
+	case err != nil:
+		return err
+	case result.Action != mcp.ElicitationResponseActionAccept:
+		return fmt.Errorf("the user chose %s", result.Action)
+	}
+	return nil
+}
+
+func ruleName(rule *policyRule) string {
+	if rule == nil {
+		return "default"
+	}
+	return rule.Pattern
+}
+
+// ruleReason describes why a rule applies, falling back to def for the
+// default action and rules without a reason.
+func ruleReason(rule *policyRule, def string) string {
+	switch {
+	case rule == nil:
+		return def
+	case rule.Reason != "":
+		return rule.Reason
+	default:
+		return fmt.Sprintf("matched by policy pattern %q", rule.Pattern)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func writePolicy(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	if p, err := loadPolicy(""); p != nil || err != nil {
+		t.Errorf("Expected no policy by default, got %v, %v", p, err)
+	}
+	p, err := loadPolicy(writePolicy(t, "rules:\n  - action: deny\n    pattern: '\\bmkfs\\b'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != PolicyAllow || len(p.Rules) != 1 {
+		t.Errorf("Expected one rule and default allow, got %+v", p)
+	}
+	for _, bad := range []string{
+		"default: maybe\n",
+		"rules:\n  - action: block\n    pattern: x\n",
+		"rules:\n  - action: deny\n",
+		"rules:\n  - action: deny\n    pattern: '(unclosed'\n",
+		"rule:\n  - action: deny\n    pattern: x\n", // Typo
+	} {
+		if _, err := loadPolicy(writePolicy(t, bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	if _, err := loadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, `
+default: deny
+rules:
+  - action: deny
+    pattern: '\brm\s+-rf\s+/(\s|$)'
+    reason: deletes the root filesystem
+  - action: confirm
+    pattern: '\bshutdown\b'
+  - action: allow
+    pattern: '^(ls|uptime)\b'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for input, want := range map[string]string{
+		"uptime\n":          "",
+		"ls -l\r":           "",
+		"\x03":              "", // Keystrokes aren't judged
+		"\n":                "",
+		"ls\nrm -rf /\n":    "deletes the root filesystem",
+		"cat /etc/passwd\n": "not allowed by the server's command policy", // Not on the allowlist
+		"shutdown -h now\n": "requires the user's confirmation",           // No client to ask
+	} {
+		err := p.check(ctx, "s1", input)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("%q: expected it to be allowed, got %v", input, err)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), "policy violation") || !strings.Contains(err.Error(), want)):
+			t.Errorf("%q: expected a policy violation mentioning %q, got %v", input, want, err)
+		}
+	}
+	var none *inputPolicy
+	if err := none.check(ctx, "s1", "rm -rf /\n"); err != nil {
+		t.Errorf("Expected no policy to allow everything, got %v", err)
+	}
+}
+
+// elicitAnswer answers elicitation requests with a fixed action.
+type elicitAnswer struct {
+	action  mcp.ElicitationResponseAction
+	message string
+}
+
+func (e *elicitAnswer) Elicit(_ context.Context, req mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	e.message = req.Params.Message
+	return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{Action: e.action}}, nil
+}
+
+func TestPolicyConfirm(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	saved := policy
+	defer func() { policy = saved }()
+	var err error
+	if policy, err = loadPolicy(writePolicy(t, "rules:\n  - action: confirm\n    pattern: 'confirm-me'\n    reason: needs a human\n")); err != nil {
+		t.Fatal(err)
+	}
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "policy-test"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	defer func() {
+		if sess, ok := manager.Lookup("policy-test"); ok {
+			manager.Remove(sess.ID)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	answer := &elicitAnswer{}
+	c := client.NewClient(transport.NewInProcessTransportWithOptions(newServer(), transport.WithElicitationHandler(answer)))
+	defer c.Close()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var init mcp.InitializeRequest
+	init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	init.Params.ClientInfo = mcp.Implementation{Name: "test", Version: "1"}
+	init.Params.Capabilities.Elicitation = &mcp.ElicitationCapability{}
+	if _, err := c.Initialize(ctx, init); err != nil {
+		t.Fatal(err)
+	}
+	interact := func(input string) (string, bool) {
+		var req mcp.CallToolRequest
+		req.Params.Name = "interact_session"
+		req.Params.Arguments = map[string]any{"session_id": "policy-test", "input": input, "wait_duration": "0.5"}
+		res, err := c.CallTool(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resultText(res), res.IsError
+	}
+
+	answer.action = mcp.ElicitationResponseActionDecline
+	if text, isErr := interact("echo confirm-me-$((6*7))\n"); !isErr || !strings.Contains(text, "policy violation") || strings.Contains(text, "confirm-me-42") {
+		t.Errorf("Expected declined input to be refused, got: %s", text)
+	}
+	if !strings.Contains(answer.message, "echo confirm-me-$((6*7)) (needs a human)") {
+		t.Errorf("Expected the user to be shown the input and the reason, got %q", answer.message)
+	}
+	answer.action = mcp.ElicitationResponseActionAccept
+	if text, isErr := interact("echo confirm-me-$((6*7))\n"); isErr || !strings.Contains(text, "confirm-me-42") {
+		t.Errorf("Expected accepted input to be sent, got: %s", text)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// progressDelay is how long a wait runs before progress is reported, so
+// quick commands don't send any notifications.
+const progressDelay = 3 * time.Second
+
+// progressInterval is the time between progress notifications.
+const progressInterval = time.Second
+
+// progressParams builds the params of a progress notification for a wait
+// that has run for elapsed out of at most limit, with received bytes of
+// output so far. Progress counts seconds, so it increases with every
+// notification even while the command is quiet.
+func progressParams(token mcp.ProgressToken, elapsed, limit time.Duration, received int64) map[string]any {
+	secs := math.Round(elapsed.Seconds()*10) / 10
+	return map[string]any{
+		"progressToken": token,
+		"progress":      secs,
+		"total":         limit.Seconds(),
+		"message":       fmt.Sprintf("%d bytes received, %gs elapsed", received, secs),
+	}
+}
+
+// reportProgress sends the client notifications/progress while a tool call
+// waits up to limit on sess, once the wait has lasted progressDelay, if the
+// request carried a progress token. The output counted is what sess received
+// since the call. The returned function stops the reports; handlers defer
+// it.
+func reportProgress(ctx context.Context, args mcp.CallToolRequest, sess *Session, limit time.Duration) (stop func()) {
+	srv := server.ServerFromContext(ctx)
+	meta := args.Params.Meta
+	if srv == nil || meta == nil || meta.ProgressToken == nil || limit <= progressDelay {
+		return func() {}
+	}
+	token := meta.ProgressToken
+	start, from := time.Now(), sess.OutputOffset()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		timer := time.NewTimer(progressDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			params := progressParams(token, time.Since(start), limit, sess.OutputOffset()-from)
+			if err := srv.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+				logger.Debug("progress notification not delivered", "session_id", sess.ID, "err", err)
+				return // The client can't take them; don't keep trying
+			}
+			timer.Reset(progressInterval)
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestProgressParams(t *testing.T) {
+	params := progressParams("tok", 4260*time.Millisecond, 30*time.Second, 512)
+	if params["progressToken"] != "tok" || params["progress"] != 4.3 || params["total"] != 30.0 {
+		t.Errorf("Unexpected params: %v", params)
+	}
+	if msg := params["message"]; msg != "512 bytes received, 4.3s elapsed" {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+}
+
+func TestRunCommandProgress(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	progress := make(chan mcp.JSONRPCNotification, 16)
+	c := startTestClient(t, ctx, func(n mcp.JSONRPCNotification) {
+		if n.Method == "notifications/progress" {
+			progress <- n
+		}
+	})
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "progress-test"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("progress-test")
+	defer manager.Remove(sess.ID)
+
+	var req mcp.CallToolRequest
+	req.Params.Name = "run_command"
+	req.Params.Arguments = map[string]any{"session_id": sess.ID, "command": "echo started; sleep 5; echo done"}
+	req.Params.Meta = &mcp.Meta{ProgressToken: "run-1"}
+	if _, err := c.CallTool(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	var got int
+	var last float64
+	for len(progress) > 0 {
+		n := <-progress
+		if n.Params.AdditionalFields["progressToken"] != "run-1" {
+			t.Errorf("Unexpected progress token: %v", n.Params.AdditionalFields)
+		}
+		p, _ := n.Params.AdditionalFields["progress"].(float64)
+		if p < float64(progressDelay/time.Second) || p <= last {
+			t.Errorf("Expected increasing progress from %s on, got %v after %v", progressDelay, p, last)
+		}
+		last = p
+		got++
+	}
+	if got == 0 {
+		t.Error("Expected progress notifications during a 5s command")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kinds of interactive prompt a command can be blocked on, reported as
+// awaiting_input.
+const (
+	PromptPassword     = "password"
+	PromptConfirmation = "confirmation"
+	PromptHostKey      = "host_key"
+	PromptPager        = "pager"
+)
+
+// awaitingInput describes the interactive prompt ending some output.
+type awaitingInput struct {
+	Type   string `json:"type"`
+	Prompt string `json:"prompt"` // The prompt line, escape sequences removed
+}
+
+// inputPrompts recognize the last line of output as a prompt, in order: a
+// host key prompt also asks yes/no.
+var inputPrompts = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{PromptHostKey, regexp.MustCompile(`(?i)continue connecting \(yes/no[^)]*\)\?\s*$`)},
+	{PromptPassword, regexp.MustCompile(`(?i)(password|passphrase|passcode|verification code)[^:]*:\s*$`)},
+	{PromptConfirmation, regexp.MustCompile(`(?i)[\[(](y(es)?/no?|no?/y(es)?)[\])]\s*[:?]?\s*$`)},
+	{PromptPager, regexp.MustCompile(`^(:|\(END\)|--More--(\(\d+%\))?|.*\(press h for help or q to quit\)|lines \d+-\d+.*)\s*$`)},
+}
+
+// detectInputPrompt returns the interactive prompt the output ends with,
+// such as a password prompt, a [y/N] confirmation, ssh's host key question
+// or a pager waiting for a key, or nil if it doesn't end with one.
+func detectInputPrompt(output string) *awaitingInput {
+	line := stripANSI(output)
+	line = line[strings.LastIndexByte(line, '\n')+1:]
+	// Pagers redraw their prompt in place after a carriage return
+	line = strings.TrimRight(line, "\r")
+	line = line[strings.LastIndexByte(line, '\r')+1:]
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	for _, p := range inputPrompts {
+		if p.re.MatchString(line) {
+			return &awaitingInput{Type: p.kind, Prompt: strings.TrimSpace(line)}
+		}
+	}
+	return nil
+}
+
+// awaitingNote is the marker reporting the prompt a command is blocked on,
+// or was when it timed out and got interrupted.
+func awaitingNote(a *awaitingInput, timedOut bool) string {
+	verb := "is"
+	if timedOut {
+		verb = "was"
+	}
+	return fmt.Sprintf("[Awaiting input: the command %s blocked on a %s prompt]", verb, strings.ReplaceAll(a.Type, "_", " "))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestDetectInputPrompt(t *testing.T) {
+	for output, want := range map[string]string{
+		"$ sudo ls\r\n[sudo] password for alice: ":                              PromptPassword,
+		"Enter passphrase for key '/home/alice/.ssh/id_ed25519': ":              PromptPassword,
+		"bob@db01's password: ":                                                 PromptPassword,
+		"Do you want to continue? [Y/n] ":                                       PromptConfirmation,
+		"Proceed (y/n)? ":                                                       PromptConfirmation,
+		"Are you sure you want to continue connecting (yes/no/[fingerprint])? ": PromptHostKey,
+		"line 1\r\nline 2\r\n\x1b[7m(END)\x1b[27m\x1b[K":                        PromptPager,
+		"line 1\r\n\r\x1b[K:":                                                   PromptPager,
+		" Manual page ls(1) line 1 (press h for help or q to quit)":             PromptPager,
+		"--More--(42%)":                                                         PromptPager,
+		"done\r\nuser@host:~$ ":                                                 "",
+		"Password: changed\r\n$ ":                                               "",
+		"":                                                                      "",
+	} {
+		got := detectInputPrompt(output)
+		switch {
+		case want == "" && got != nil:
+			t.Errorf("detectInputPrompt(%q) = %+v, want none", output, got)
+		case want != "" && (got == nil || got.Type != want):
+			t.Errorf("detectInputPrompt(%q) = %+v, want %s", output, got, want)
+		}
+	}
+}
+
+func TestInteractAwaitingInput(t *testing.T) {
+	sess := &Session{ID: "test-awaiting", Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	sess.outputBuf.WriteString("$ ssh-add\r\nEnter passphrase for /root/.ssh/id_rsa: ")
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+
+	text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": sess.ID, "wait_duration": "0"})
+	if isErr || !strings.HasSuffix(text, "[Awaiting input: the command is blocked on a password prompt]") {
+		t.Errorf("Expected a password prompt hint, got: %s", text)
+	}
+}
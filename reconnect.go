@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Readiness wait after an automatic reconnect, as start_session's defaults.
+const (
+	reconnectQuiet   = 300 * time.Millisecond
+	reconnectTimeout = 10 * time.Second
+)
+
+// cwdReportRe matches the OSC 7 sequence many shells print with each prompt
+// to report their working directory, e.g. "\x1b]7;file://web1/var/log\a".
+var cwdReportRe = regexp.MustCompile(`\x1b\]7;file://[^/\x07\x1b]*(/[^\x07\x1b]*)(?:\x07|\x1b\\)`)
+
+// lastCwdReport returns the directory in the last OSC 7 report in p.
+func lastCwdReport(p []byte) (string, bool) {
+	matches := cwdReportRe.FindAllSubmatch(p, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	dir, err := url.PathUnescape(string(matches[len(matches)-1][1]))
+	if err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// Cwd returns the working directory the remote shell last reported, or ""
+// if it never did.
+func (s *Session) Cwd() string {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.cwd
+}
+
+// connectionLost reports whether a dead SSH session ended because the
+// connection failed rather than because its shell exited or it was closed:
+// ssh exits with 255, and the native client gets no exit status at all.
+func (s *Session) connectionLost() bool {
+	if s.SSH == nil || s.restored || s.Alive() {
+		return false
+	}
+	if reason := s.DeadReason(); reason != "EOF" && !strings.HasPrefix(reason, "read error") {
+		return false
+	}
+	s.reap() // The reader may still be collecting the exit status
+	code := s.ExitCode()
+	return code == nil || *code == 255
+}
+
+// autoReconnect replaces a session whose connection dropped with a fresh
+// one under the same ID. Output the old session hadn't returned yet is
+// carried over, followed by a marker, and with restore_cwd the shell is
+// taken back to the directory it last reported.
+func autoReconnect(ctx context.Context, old *Session) (*Session, error) {
+	output, _ := old.read(false, false)
+	marker := fmt.Sprintf("\r\n[mcpssh: connection lost (%s); reconnected]\r\n", old.ExitSummary())
+	sess, err := relaunch(ctx, old, []byte(output+marker))
+	if err != nil {
+		if cur, ok := manager.Lookup(old.ID); ok && cur != old {
+			return cur, nil // Another call reconnected it first
+		}
+		return nil, err
+	}
+	logger.Info("session reconnected automatically", "session_id", sess.ID, "reason", old.ExitSummary())
+	waitReady(sess, nil, reconnectQuiet, reconnectTimeout)
+	if dir := old.Cwd(); old.restoreCwd && dir != "" && sess.Alive() {
+		if err := sess.Write([]byte("cd -- " + shellQuoteArgs([]string{dir}) + "\n")); err == nil {
+			waitReady(sess, nil, reconnectQuiet, reconnectTimeout)
+		}
+	}
+	return sess, nil
+}
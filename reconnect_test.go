@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSHShell stands in for ssh with a line-echoing shell: "drop" ends it
+// as a lost connection would (exit 255), "exit" as a shell would, and
+// "report" prints an OSC 7 directory report.
+func fakeSSHShell(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "ssh")
+	body := `#!/bin/sh
+n=$(cat ` + dir + `/count 2>/dev/null || echo 0); n=$((n+1)); echo $n > ` + dir + `/count
+echo "connected $n"
+while read -r line; do
+  case "$line" in
+  drop) echo "Connection to web01 closed by remote host."; exit 255 ;;
+  exit) exit 0 ;;
+  report) printf '\033]7;file://web01/srv/my%%20app\007' ;;
+  *) echo "got: $line" ;;
+  esac
+done
+`
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.SSHPath
+	t.Cleanup(func() { config.SSHPath = saved })
+	config.SSHPath = script
+}
+
+func TestAutoReconnect(t *testing.T) {
+	fakeSSHShell(t)
+	for want, args := range map[string]map[string]any{
+		"only available for SSH sessions": {"host": "local", "auto_reconnect": true, "dry_run": true},
+		"restore_cwd requires":            {"host": "web01", "restore_cwd": true, "dry_run": true},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "web01", "name": "reconnect-test", "auto_reconnect": true, "restore_cwd": true}); isErr || !strings.Contains(text, "connected 1") {
+		t.Fatalf("Expected the session to start, got: %s", text)
+	}
+	old, _ := manager.Lookup("reconnect-test")
+	defer func() {
+		if sess, ok := manager.Lookup("reconnect-test"); ok {
+			manager.Remove(sess.ID)
+		}
+	}()
+	waitExit := func(sess *Session) {
+		t.Helper()
+		select {
+		case <-sess.exited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the session to end")
+		}
+	}
+
+	callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test", "input": "report\n", "wait_duration": "0.5"})
+	if got := old.Cwd(); got != "/srv/my app" {
+		t.Errorf("Expected the reported directory to be tracked, got %q", got)
+	}
+	callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test", "input": "drop\n", "wait_duration": "0"})
+	waitExit(old)
+
+	text, isErr := callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test", "input": "hello\n", "wait_duration": "0.5"})
+	for _, want := range []string{"[mcpssh: connection lost (EOF, exit code 255); reconnected]", "connected 2", "got: cd -- '/srv/my app'", "got: hello"} {
+		if isErr || !strings.Contains(text, want) {
+			t.Errorf("Expected the output to contain %q, got: %s", want, text)
+		}
+	}
+	sess, ok := manager.Lookup("reconnect-test")
+	if !ok || sess == old || sess.ID != old.ID || !sess.autoReconnect {
+		t.Fatal("Expected a fresh session under the same ID")
+	}
+
+	// broadcast reconnects too, rather than dropping the session
+	callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test", "input": "drop\n", "wait_duration": "0"})
+	waitExit(sess)
+	text, _ = callTool(broadcastHandler, map[string]any{"session_ids": []any{"reconnect-test"}, "input": "hi\n", "wait_duration": "0.5"})
+	if !strings.Contains(text, "reconnected]") || !strings.Contains(text, "got: hi") {
+		t.Errorf("Expected broadcast to reconnect the session, got: %s", text)
+	}
+	sess, _ = manager.Lookup("reconnect-test")
+
+	// A shell that exits is not a dropped connection
+	callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test", "input": "exit\n", "wait_duration": "0"})
+	waitExit(sess)
+	if text, _ := callTool(interactSessionHandler, map[string]any{"session_id": "reconnect-test"}); !strings.Contains(text, "[Session exited: EOF, exit code 0]") {
+		t.Errorf("Expected the exit to be reported, got: %s", text)
+	}
+	if _, ok := manager.Lookup("reconnect-test"); ok {
+		t.Error("Expected the exited session to be removed")
+	}
+}
+
+func TestLastCwdReport(t *testing.T) {
+	if _, ok := lastCwdReport([]byte("no report\r\n$ ")); ok {
+		t.Error("Expected no report")
+	}
+	got, ok := lastCwdReport([]byte("\x1b]7;file://h/tmp\x07$ cd /var\r\n\x1b]7;file:///var/a%20b\x1b\\$ "))
+	if !ok || got != "/var/a b" {
+		t.Errorf("Expected the last report, got %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Every session is also an MCP resource, session://<id>/output, for clients
+// that prefer reading and subscribing to resources over polling with tools.
+const (
+	resourceScheme       = "session://"
+	resourceOutputSuffix = "/output"
+)
+
+// resourcePollInterval is how often sessions are checked for new output to
+// notify subscribers of, and for sessions to list or drop.
+const resourcePollInterval = time.Second
+
+// sessionResourceURI returns the output resource of the session id.
+func sessionResourceURI(id string) string {
+	return resourceScheme + id + resourceOutputSuffix
+}
+
+// resourceWatcher keeps a server's resource list in step with the sessions
+// and sends resources/updated notifications to the connected clients when a
+// session's output grew. mcp-go doesn't handle resources/subscribe, so every
+// client hears of every session.
+type resourceWatcher struct {
+	srv *server.MCPServer
+
+	mu       sync.Mutex
+	offsets  map[string]int64 // Listed session ID -> output offset last seen
+	notified map[string]int64 // Session ID -> output offset last announced (see notify.go)
+	clients  map[string]bool  // IDs of the connected client sessions
+}
+
+func newResourceWatcher() *resourceWatcher {
+	return &resourceWatcher{
+		offsets:  make(map[string]int64),
+		notified: make(map[string]int64),
+		clients:  make(map[string]bool),
+	}
+}
+
+// hooks returns the server hooks that track the connected clients.
+func (rw *resourceWatcher) hooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(ctx context.Context, client server.ClientSession) {
+		rw.mu.Lock()
+		rw.clients[client.SessionID()] = true
+		rw.mu.Unlock()
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, client server.ClientSession) {
+		rw.dropClient(client.SessionID())
+	})
+	return hooks
+}
+
+// dropClient forgets a disconnected client.
+func (rw *resourceWatcher) dropClient(client string) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	delete(rw.clients, client)
+}
+
+// watch polls the sessions for good; one runs per server.
+func (rw *resourceWatcher) watch() {
+	for range time.Tick(resourcePollInterval) {
+		rw.poll()
+	}
+}
+
+// poll lists new sessions as resources, drops closed ones, and notifies the
+// clients of every session whose output grew (or that was replaced) since
+// the last poll.
+func (rw *resourceWatcher) poll() {
+	current := make(map[string]int64)
+	sessions := make(map[string]*Session)
+	for _, sess := range manager.snapshot() {
+		current[sess.ID], sessions[sess.ID] = sess.OutputOffset(), sess
+	}
+
+	rw.mu.Lock()
+	var added []*Session
+	var removed, updated []string
+	for id, off := range current {
+		last, listed := rw.offsets[id]
+		if !listed {
+			added = append(added, sessions[id])
+		} else if off != last {
+			updated = append(updated, sessionResourceURI(id))
+		}
+		rw.offsets[id] = off
+	}
+	for id := range rw.offsets {
+		if _, ok := current[id]; !ok {
+			delete(rw.offsets, id)
+			removed = append(removed, sessionResourceURI(id))
+			updated = append(updated, sessionResourceURI(id)) // Reading it now fails
+		}
+	}
+	clients := make([]string, 0, len(rw.clients))
+	for client := range rw.clients {
+		clients = append(clients, client)
+	}
+	rw.mu.Unlock()
+
+	for _, sess := range added {
+		rw.srv.AddResource(sessionResource(sess), readSessionResource)
+	}
+	if len(removed) > 0 {
+		rw.srv.DeleteResources(removed...)
+	}
+	for _, uri := range updated {
+		for _, client := range clients {
+			if err := rw.srv.SendNotificationToSpecificClient(client, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri}); err != nil {
+				logger.Debug("resource update not delivered", "uri", uri, "client", client, "err", err)
+			}
+		}
+	}
+	rw.notifyOutput(sessions)
+}
+
+// sessionResource describes the output resource of sess.
+func sessionResource(sess *Session) mcp.Resource {
+	return mcp.NewResource(sessionResourceURI(sess.ID), sess.Label(),
+		mcp.WithResourceDescription(fmt.Sprintf("Unread terminal output of the session on %s", sess.Host)),
+		mcp.WithMIMEType("text/plain"),
+	)
+}
+
+// readSessionResource returns a session's unread output without consuming
+// it, so reading the resource doesn't take output from interact_session.
+// Sessions may be named by ID or name.
+func readSessionResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := req.Params.URI
+	id, ok := strings.CutPrefix(uri, resourceScheme)
+	if ok {
+		id, ok = strings.CutSuffix(id, resourceOutputSuffix)
+	}
+	if !ok || id == "" {
+		return nil, fmt.Errorf("unknown resource %q", uri)
+	}
+	sess, ok := manager.Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("session %q not found", id)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "text/plain", Text: sess.Peek()}}, nil
+}
+
+// snapshot returns the registered sessions. Unlike Lookup, it doesn't count
+// as a use for the idle reaper.
+func (sm *SessionManager) snapshot() []*Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, sess := range sm.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
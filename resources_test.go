@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// startTestClient connects an initialized client to a fresh server over an
+// in-memory stdio pipe, which unlike the in-process transport delivers the
+// server's notifications, passing each to notify.
+func startTestClient(t *testing.T, ctx context.Context, notify func(mcp.JSONRPCNotification)) *client.Client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.NewStdioServer(newServer()).Listen(ctx, serverIn, serverOut)
+	}()
+	c := client.NewClient(transport.NewIO(clientIn, clientOut, nil))
+	t.Cleanup(func() {
+		c.Close() // The server sees the end of its input and stops
+		clientIn.Close()
+		<-done
+	})
+	c.OnNotification(notify)
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var init mcp.InitializeRequest
+	init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	init.Params.ClientInfo = mcp.Implementation{Name: "test", Version: "1"}
+	if _, err := c.Initialize(ctx, init); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSessionResources(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "resource-test"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("resource-test")
+	uri := sessionResourceURI(sess.ID)
+	defer manager.Remove(sess.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	updated := make(chan string, 16)
+	c := startTestClient(t, ctx, func(n mcp.JSONRPCNotification) {
+		if n.Method == mcp.MethodNotificationResourceUpdated {
+			uri, _ := n.Params.AdditionalFields["uri"].(string)
+			select {
+			case updated <- uri:
+			default: // Updates of other sessions may pile up
+			}
+		}
+	})
+	listed := func() []string {
+		res, err := c.ListResources(ctx, mcp.ListResourcesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var uris []string
+		for _, r := range res.Resources {
+			uris = append(uris, r.URI)
+		}
+		return uris
+	}
+	waitListed := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for slices.Contains(listed(), uri) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s to be listed: %v", uri, want)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	read := func(uri string) (string, error) {
+		var req mcp.ReadResourceRequest
+		req.Params.URI = uri
+		res, err := c.ReadResource(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		return res.Contents[0].(mcp.TextResourceContents).Text, nil
+	}
+
+	waitListed(true)
+	sess.Write([]byte("echo res-$((20+22))\n"))
+	deadline := time.After(5 * time.Second)
+	for got := ""; got != uri; {
+		select {
+		case got = <-updated:
+		case <-deadline:
+			t.Fatal("Timed out waiting for a resource update")
+		}
+	}
+	// Read by name through the template, and without consuming the output
+	for range 2 {
+		if text, err := read(sessionResourceURI("resource-test")); err != nil || !strings.Contains(text, "res-42") {
+			t.Errorf("Expected the unread output, got %q, %v", text, err)
+		}
+	}
+	if _, err := read(sessionResourceURI("missing")); err == nil {
+		t.Error("Expected reading a missing session to fail")
+	}
+
+	manager.Remove(sess.ID)
+	waitListed(false)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultRunTimeout bounds a run_command that doesn't set its own timeout.
+const defaultRunTimeout = 30 * time.Second
+
+type runResult struct {
+	Command      string `json:"command"`
+	Output       string `json:"output"`
+	Encoding     string `json:"encoding,omitempty"` // How Output is encoded if it isn't text: base64 or hex
+	ExitCode     *int   `json:"exit_code"`          // Nil if the command didn't complete
+	TimedOut     bool   `json:"timed_out,omitempty"`
+	Killed       string `json:"killed,omitempty"` // Signal sent after Ctrl+C didn't stop the command
+	Exited       bool   `json:"exited,omitempty"` // The session itself ended
+	Truncated    bool   `json:"truncated"`
+	DroppedBytes int    `json:"dropped_bytes,omitempty"`
+
+	AwaitingInput *awaitingInput `json:"awaiting_input,omitempty"` // The prompt the command was blocked on when it timed out
+}
+
+// sentinelCommand appends to command a printf reporting its exit status
+// behind a unique marker. The command runs through eval, so a trailing & or
+// # comment in it stays its own rather than backgrounding or commenting out
+// the report. The marker is split across printf's arguments, so the
+// terminal's echo of the line can't be mistaken for the report; the
+// returned regexp matches only the printed form.
+func sentinelCommand(command string) (string, *regexp.Regexp) {
+	marker := "__MCPSSH_" + randomHex(6)
+	line := fmt.Sprintf(`eval %s; printf '\n%%s:%%d\n' %s "$?"`, shellQuoteArgs([]string{strings.TrimRight(command, "\r\n")}), marker)
+	return line, regexp.MustCompile(`(?:\r?\n)?` + marker + `:(\d+)\r?\n`)
+}
+
+func runCommandHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	command := args.GetString("command", "")
+	if strings.TrimSpace(command) == "" {
+		return mcp.NewToolResultError("command is required"), nil
+	}
+	timeout, err := parseWait("timeout", args.GetString("timeout", ""), defaultRunTimeout)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	maxOutput := args.GetInt("max_output_bytes", config.MaxOutputBytes)
+	binaryEncoding := args.GetString("binary_encoding", EncodingBase64)
+	if !validBinaryEncoding(binaryEncoding) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid binary_encoding %q (want %s, %s or %s)", binaryEncoding, EncodingBase64, EncodingHex, EncodingNone)), nil
+	}
+
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason())), nil
+	}
+	if err := sess.checkWritable(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkInputAllowed(ctx, sess.ID, command); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	line, doneRe := sentinelCommand(command)
+	if err := sess.checkContinuedInput(ctx, line+"\n"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Output left over from earlier interactions would be attributed to
+	// this command
+	sess.Clear()
+	since := sess.OutputOffset()
+	if err := sess.Write([]byte(line + "\n")); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Write error: %v", err)), nil
+	}
+	defer reportProgress(ctx, args, sess, timeout+maxInterruptWait)()
+	output, timedOut, killed, awaiting := waitOrInterrupt(ctx, sess, doneRe, since, timeout)
+	if args.GetBool("strip_ansi", sess.stripANSI) {
+		output = stripANSI(output)
+	}
+	// The prompt of the previous command may still arrive after the clear,
+	// ahead of the echo
+	if i := strings.Index(output, line); i >= 0 {
+		output = strings.TrimPrefix(strings.TrimPrefix(output[i+len(line):], "\r"), "\n")
+	} else {
+		output = stripEcho(output, line)
+	}
+
+	res := runResult{Command: command, TimedOut: timedOut, Killed: killed, AwaitingInput: awaiting}
+	if loc := doneRe.FindStringSubmatchIndex(output); loc != nil {
+		code, _ := strconv.Atoi(output[loc[2]:loc[3]])
+		res.ExitCode = &code
+		output = output[:loc[0]] // Drops the report and the prompt after it
+	}
+	if !sess.Alive() {
+		res.Exited = true
+		sess.reap()
+	}
+	output, res.DroppedBytes = truncateOutput(output, maxOutput)
+	output, res.Encoding = encodeOutput(output, binaryEncoding)
+	res.Output, res.Truncated = output, res.DroppedBytes > 0
+	if wantJSON(args) {
+		return jsonResult(res), nil
+	}
+
+	text := withEncodingMarker(withTruncationMarker(output, res.DroppedBytes), res.Encoding)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	switch {
+	case res.ExitCode != nil:
+		text += fmt.Sprintf("[Exit code: %d]", *res.ExitCode)
+	case timedOut:
+		text += timeoutNote(timeout, killed)
+		if awaiting != nil {
+			text += "\n" + awaitingNote(awaiting, true)
+		}
+	case res.Exited:
+		text += fmt.Sprintf("[Session exited: %s]", sess.ExitSummary())
+	default:
+		text += "[Command did not report an exit code]"
+	}
+	return mcp.NewToolResultText(text), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// serialHostPrefix marks a start_session host as a serial device, e.g.
+// "serial:/dev/ttyUSB0?baud=115200" for an embedded board or a switch's
+// console port.
+const serialHostPrefix = "serial:"
+
+// defaultBaud is the line speed used when a serial host gives none.
+const defaultBaud = 115200
+
+// serialPort is the device and line settings a serial host names. The line
+// is always 8 data bits, no parity and one stop bit.
+type serialPort struct {
+	Device string
+	Baud   int
+}
+
+// isSerialHost reports whether host names a serial device.
+func isSerialHost(host string) bool {
+	return strings.HasPrefix(host, serialHostPrefix)
+}
+
+// parseSerialHost parses a "serial:<device>[?baud=<rate>]" host.
+func parseSerialHost(host string) (serialPort, error) {
+	rest, _ := strings.CutPrefix(host, serialHostPrefix)
+	device, query, _ := strings.Cut(rest, "?")
+	if !filepath.IsAbs(device) {
+		return serialPort{}, fmt.Errorf("serial device %q must be an absolute path, e.g. serial:/dev/ttyUSB0", device)
+	}
+	port := serialPort{Device: filepath.Clean(device), Baud: defaultBaud}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return serialPort{}, fmt.Errorf("serial options %q: %v", query, err)
+	}
+	for key, values := range params {
+		if key != "baud" {
+			return serialPort{}, fmt.Errorf("unknown serial option %q (only baud is supported)", key)
+		}
+		if port.Baud, err = strconv.Atoi(values[len(values)-1]); err != nil || port.Baud <= 0 {
+			return serialPort{}, fmt.Errorf("invalid baud rate %q", values[len(values)-1])
+		}
+	}
+	return port, nil
+}
+
+// checkSerialAllowed applies the access rules to a serial session. The
+// device is on this machine, so MCPSSH_ALLOW_LOCAL governs it, and an
+// allowed hosts list must also match "serial:<device>", e.g.
+// "serial:/dev/ttyUSB*".
+func checkSerialAllowed(port serialPort) error {
+	if err := checkLocalAllowed(); err != nil {
+		return err
+	}
+	return checkHostAllowed(serialHostPrefix + port.Device)
+}
+
+// openSerial opens the device and puts the line into raw mode at the port's
+// speed. The file stands in for a PTY master: the session reads output from
+// it and writes input to it, with no local process involved.
+func openSerial(port serialPort) (*os.File, error) {
+	// Non-blocking so the open doesn't wait for carrier, and so Close
+	// interrupts the reader
+	f, err := os.OpenFile(port.Device, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureSerial(f, port.Baud); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", port.Device, err)
+	}
+	return f, nil
+}
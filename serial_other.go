@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// configureSerial would set the line speed and raw mode; the termios
+// handling is only implemented for Linux.
+func configureSerial(f *os.File, baud int) error {
+	return fmt.Errorf("serial sessions are only supported on Linux")
+}
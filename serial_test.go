@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestSerialSession(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o600)
+	for want, args := range map[string]map[string]any{
+		"must be an absolute path":        {"host": "serial:ttyUSB0", "dry_run": true},
+		"unknown serial option":           {"host": "serial:/dev/ttyUSB0?parity=none", "dry_run": true},
+		"invalid baud rate":               {"host": "serial:/dev/ttyUSB0?baud=fast", "dry_run": true},
+		"command isn't available":         {"host": "serial:/dev/ttyUSB0", "command": "sh", "dry_run": true},
+		"only available for SSH sessions": {"host": "serial:/dev/ttyUSB0", "backing": "tmux", "dry_run": true},
+		"not a serial device":             {"host": "serial:" + file},
+		"unsupported baud rate 12345":     {"host": "serial:" + file + "?baud=12345"},
+	} {
+		if text, isErr := callTool(startSessionHandler, args); !isErr || !strings.Contains(text, want) {
+			t.Errorf("%v: expected an error mentioning %q, got: %s", args, want, text)
+		}
+	}
+
+	saved := config.AllowedHosts
+	config.AllowedHosts = []string{"serial:/dev/ttyUSB*"}
+	_, isErr := callTool(startSessionHandler, map[string]any{"host": "serial:/dev/ttyUSB0?baud=9600", "dry_run": true})
+	text, _ := callTool(startSessionHandler, map[string]any{"host": "serial:/dev/ttyS0", "dry_run": true})
+	config.AllowedHosts = saved
+	if isErr || !strings.Contains(text, "not in the allowed hosts list") {
+		t.Errorf("Expected the allowed hosts list to match the device, got: %s", text)
+	}
+	if text, _ := callTool(startSessionHandler, map[string]any{"host": "serial:/dev/ttyUSB0?baud=9600", "dry_run": true}); !strings.Contains(text, "Would open /dev/ttyUSB0 at 9600 baud") {
+		t.Errorf("Expected the dry run to name the device and speed, got: %s", text)
+	}
+
+	// A PTY's terminal side stands in for the device, its master for the board
+	board, device, err := pty.Open()
+	if err != nil {
+		t.Skipf("Skipping PTY test: %v", err)
+	}
+	defer board.Close()
+	defer device.Close()
+	if err := configureSerial(device, 9600); err != nil {
+		t.Fatal(err) // Raw before the prompt is written, or it would be echoed back
+	}
+	board.WriteString("router> ")
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "serial:" + device.Name() + "?baud=9600", "name": "serial-test"}); isErr || !strings.Contains(text, "router> ") {
+		t.Fatalf("Expected the session to show the console's prompt, got: %s", text)
+	}
+	sess, _ := manager.Lookup("serial-test")
+	defer manager.Remove(sess.ID)
+	if sess.SSH != nil {
+		t.Error("Expected a serial session to have no SSH options")
+	}
+
+	callTool(interactSessionHandler, map[string]any{"session_id": "serial-test", "input": "show version\n", "wait_duration": "0"})
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(board).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case got := <-line:
+		if got != "show version\n" {
+			t.Errorf("Expected the input unchanged on the line, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the input on the line")
+	}
+	if restored := restoredSession(sessionRecord{Host: "serial:/dev/ttyUSB0"}); restored.SSH != nil {
+		t.Error("Expected a restored serial session to have no SSH options")
+	}
+}
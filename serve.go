@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How the MCP protocol itself is served.
+const (
+	ServeStdio = "stdio" // One client, which launched the server
+	ServeHTTP  = "http"  // Streamable HTTP at /mcp, for any number of clients
+	ServeSSE   = "sse"   // The older HTTP+SSE transport at /sse and /message
+)
+
+func validServeMode(mode string) bool {
+	return mode == ServeStdio || mode == ServeHTTP || mode == ServeSSE
+}
+
+// shutdownGrace bounds how long an HTTP server waits for requests in flight
+// when asked to stop.
+const shutdownGrace = 5 * time.Second
+
+// httpServer is what serve needs from mcp-go's HTTP transports.
+type httpServer interface {
+	http.Handler
+	Shutdown(ctx context.Context) error
+}
+
+// transportLogger passes the messages of mcp-go's streamable HTTP transport
+// on to the server log.
+type transportLogger struct{}
+
+func (transportLogger) Infof(format string, v ...any)  { logger.Info(fmt.Sprintf(format, v...)) }
+func (transportLogger) Errorf(format string, v ...any) { logger.Error(fmt.Sprintf(format, v...)) }
+
+// newHTTPServer wraps s in the HTTP transport for mode (ServeHTTP or
+// ServeSSE).
+func newHTTPServer(s *server.MCPServer, mode string) httpServer {
+	if mode == ServeSSE {
+		return server.NewSSEServer(s)
+	}
+	return server.NewStreamableHTTPServer(s, server.WithLogger(transportLogger{}))
+}
+
+// httpHandler routes the endpoints of hs and the Prometheus metrics at
+// /metrics, refusing requests that don't carry token or that a web page
+// could have made to the server listening on listen.
+func httpHandler(hs httpServer, mode, listen, token string) http.Handler {
+	mux := http.NewServeMux()
+	if mode == ServeSSE {
+		mux.Handle("/", hs) // Routes /sse and /message itself
+	} else {
+		mux.Handle("/mcp", hs)
+	}
+	mux.Handle("/metrics", metrics)
+	return rejectForeignRequests(listen, requireToken(token, mux))
+}
+
+// serve runs s over the configured transport until stdin closes (stdio) or
+// the server is interrupted (HTTP). Over HTTP, sessions outlive the clients
+// that started them, so the server can run as a long-lived daemon.
+func serve(s *server.MCPServer) error {
+	switch config.Serve {
+	case ServeStdio:
+		return server.ServeStdio(s)
+	case ServeHTTP, ServeSSE:
+	default:
+		return fmt.Errorf("unknown serve mode %q", config.Serve)
+	}
+
+	token, err := authToken()
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	authenticated := token != "" || config.TLSClientCA != ""
+	if !authenticated && !loopbackAddr(config.Listen) {
+		// Anyone who can connect could open shells as this user
+		return fmt.Errorf("refusing to listen on %s without authentication: set an auth token or a TLS client CA, or listen on a loopback address", config.Listen)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hs := newHTTPServer(s, config.Serve)
+	srv := &http.Server{Addr: config.Listen, Handler: httpHandler(hs, config.Serve, config.Listen, token), TLSConfig: tlsConfig}
+	errc := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+	logger.Info("serving MCP over HTTP", "mode", config.Serve, "addr", config.Listen,
+		"tls", tlsConfig != nil, "client_certs", config.TLSClientCA != "", "token", token != "")
+	if !authenticated {
+		logger.Warn("HTTP transport has no authentication; any local user can connect")
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	hs.Shutdown(ctx) // Closes the MCP sessions
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close() // SSE streams never finish on their own
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestServeHTTP(t *testing.T) {
+	ts := httptest.NewServer(httpHandler(newHTTPServer(newServer(), ServeHTTP), ServeHTTP, "127.0.0.1:0", ""))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Sessions started by one client are visible to the next
+	call := func(name string, args map[string]any) string {
+		t.Helper()
+		c, err := client.NewStreamableHttpClient(ts.URL + "/mcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		var init mcp.InitializeRequest
+		init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		init.Params.ClientInfo = mcp.Implementation{Name: "test", Version: "1"}
+		if _, err := c.Initialize(ctx, init); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		var req mcp.CallToolRequest
+		req.Params.Name = name
+		req.Params.Arguments = args
+		res, err := c.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("%s returned an error: %s", name, resultText(res))
+		}
+		return resultText(res)
+	}
+
+	call("start_session", map[string]any{"host": "local", "name": "http-test", "keep_alive": true})
+	t.Cleanup(func() {
+		if sess, ok := manager.Lookup("http-test"); ok {
+			manager.Remove(sess.ID)
+		}
+	})
+	if out := call("list_sessions", nil); !strings.Contains(out, "http-test") {
+		t.Errorf("Expected a second client to see the session, got: %s", out)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	ts := httptest.NewServer(httpHandler(newHTTPServer(newServer(), ServeHTTP), ServeHTTP, "127.0.0.1:0", "s3cret"))
+	defer ts.Close()
+
+	get := func(token string) (int, string) {
+		req, _ := http.NewRequest("GET", ts.URL+"/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+	if code, _ := get(""); code != http.StatusUnauthorized {
+		t.Errorf("Expected metrics to need the token, got %d", code)
+	}
+	if code, body := get("s3cret"); code != http.StatusOK || !strings.Contains(body, "mcpssh_sessions_active") {
+		t.Errorf("Expected the metrics with the token, got %d: %s", code, body)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sessionSignals are the signals send_signal accepts. Remote processes can
+// only be reached through their terminal, so for SSH sessions just those
+// with a control character are available.
+var sessionSignals = map[string]struct {
+	sig     syscall.Signal
+	control string // Character the terminal turns into sig, if any
+}{
+	"INT":  {syscall.SIGINT, "\x03"},  // Ctrl+C
+	"QUIT": {syscall.SIGQUIT, "\x1c"}, // Ctrl+\
+	"TSTP": {syscall.SIGTSTP, "\x1a"}, // Ctrl+Z
+	"TERM": {syscall.SIGTERM, ""},
+	"KILL": {syscall.SIGKILL, ""},
+	"HUP":  {syscall.SIGHUP, ""},
+}
+
+// foregroundGroup returns the foreground process group of a session's
+// terminal, i.e. the running command, or the shell when idle.
+func foregroundGroup(sess *Session) (int, error) {
+	// Through SyscallConn rather than Fd, which would switch the PTY to
+	// blocking mode and stop Close from interrupting the reader
+	raw, err := sess.Ptmx.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pgrp int32
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgrp), nil
+}
+
+// Signal delivers the named signal to the session's foreground process.
+// Local sessions signal the terminal's foreground process group directly;
+// SSH, container, serial and telnet sessions type the signal's control character,
+// which the remote terminal delivers the same way.
+func (s *Session) Signal(name string) error {
+	spec, ok := sessionSignals[name]
+	if !ok {
+		return fmt.Errorf("unknown signal %q", name)
+	}
+	if s.signalsByTerminal() {
+		if spec.control == "" {
+			return fmt.Errorf("SIG%s cannot be sent to a remote process; use INT, QUIT or TSTP, or close_session", name)
+		}
+		return s.Write([]byte(spec.control))
+	}
+	pgrp, err := foregroundGroup(s)
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(-pgrp, spec.sig)
+}
+
+// signalsByTerminal reports whether the session's programs can only be
+// signalled by typing control characters, not directly.
+func (s *Session) signalsByTerminal() bool {
+	return s.SSH != nil || containerHost(s.Host) || isSerialHost(s.Host) || isTelnetHost(s.Host)
+}
+
+// killForeground ends a command that Ctrl+C didn't stop, returning the
+// signal sent or "" if there was nothing to kill. Local sessions kill the
+// terminal's foreground process group with SIGKILL, unless that is the
+// session's own process, such as an idle shell. Other sessions can only
+// type Ctrl+\ (SIGQUIT), the strongest signal a terminal delivers.
+func (s *Session) killForeground() (string, error) {
+	if s.signalsByTerminal() {
+		if err := s.Signal("QUIT"); err != nil {
+			return "", err
+		}
+		return "SIGQUIT (Ctrl+\\)", nil
+	}
+	pgrp, err := foregroundGroup(s)
+	if err != nil {
+		return "", err
+	}
+	if s.Cmd == nil || s.Cmd.Process == nil || pgrp == s.Cmd.Process.Pid {
+		return "", nil
+	}
+	if err := syscall.Kill(-pgrp, syscall.SIGKILL); err != nil {
+		return "", err
+	}
+	s.transcript.note("sent SIGKILL to process group %d", pgrp)
+	return "SIGKILL", nil
+}
+
+func sendSignalHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name := strings.TrimPrefix(strings.ToUpper(args.GetString("signal", "INT")), "SIG")
+	if _, ok := sessionSignals[name]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid signal %q (want INT, QUIT, TSTP, TERM, KILL or HUP)", args.GetString("signal", ""))), nil
+	}
+	waitDuration, err := parseWaitDuration(args.GetString("wait_duration", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason())), nil
+	}
+	if err := sess.checkWritable(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := sess.Signal(name); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to send SIG%s: %v", name, err)), nil
+	}
+	sess.Touch()
+
+	exited := sess.waitOrExit(ctx, waitDuration)
+	msg := fmt.Sprintf("Sent SIG%s.\n\nOutput:\n%s", name, sess.ReadAndClear())
+	if exited {
+		sess.reap()
+		msg += fmt.Sprintf("\n[Session exited: %s]", sess.ExitSummary())
+	}
+	return mcp.NewToolResultText(msg), nil
+}
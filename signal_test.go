@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendSignal(t *testing.T) {
+	sess := startTestSession(t, "test-send-signal", "/bin/sh", "-i")
+	time.Sleep(200 * time.Millisecond)
+
+	// TERM reaches the foreground command, not the shell
+	sess.Write([]byte("sleep 30; echo after-$((1+1))\n"))
+	time.Sleep(200 * time.Millisecond)
+	sess.Clear()
+	text, isErr := callTool(sendSignalHandler, map[string]any{"session_id": sess.ID, "signal": "SIGTERM"})
+	if isErr || !strings.Contains(text, "Sent SIGTERM") {
+		t.Fatalf("send_signal failed: %s", text)
+	}
+	if strings.Contains(text, "Session exited") || !sess.Alive() {
+		t.Errorf("Expected the shell to survive, got: %s", text)
+	}
+	sess.Write([]byte("echo alive-$((2+2))\n"))
+	if out, ok := waitForPattern(context.Background(), sess, regexp.MustCompile(`alive-4`), 2*time.Second); !ok {
+		t.Errorf("Expected the shell to be usable after the signal, got %q", out)
+	}
+
+	if text, isErr := callTool(sendSignalHandler, map[string]any{"session_id": sess.ID, "signal": "USR1"}); !isErr {
+		t.Errorf("Expected an unsupported signal to be rejected, got: %s", text)
+	}
+
+	remote := &Session{ID: "test-send-signal-remote", Host: "web01", SSH: &SSHOptions{Host: "web01"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	if err := remote.Signal("KILL"); err == nil || !strings.Contains(err.Error(), "remote") {
+		t.Errorf("Expected KILL to be refused for an SSH session, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SOCKS5 (RFC 1928) constants, for the CONNECT-only proxy of
+// start_socks_proxy.
+const (
+	socksVersion    = 5
+	socksNoAuth     = 0
+	socksNoMethod   = 0xff
+	socksConnect    = 1
+	socksIPv4       = 1
+	socksDomain     = 3
+	socksIPv6       = 4
+	socksSucceeded  = 0
+	socksFailure    = 1
+	socksBadCommand = 7
+	socksBadAddress = 8
+)
+
+// socksHandshake reads a SOCKS5 greeting and CONNECT request from c and
+// returns the host:port asked for. Requests that can't be served have been
+// answered with an error reply.
+func socksHandshake(c net.Conn) (string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		return "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return "", err
+	}
+	var noAuth bool
+	for _, m := range methods {
+		noAuth = noAuth || m == socksNoAuth
+	}
+	if !noAuth {
+		c.Write([]byte{socksVersion, socksNoMethod})
+		return "", fmt.Errorf("client offers no method without authentication")
+	}
+	if _, err := c.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", err
+	}
+
+	var req [4]byte // VER CMD RSV ATYP
+	if _, err := io.ReadFull(c, req[:]); err != nil {
+		return "", err
+	}
+	if req[1] != socksConnect {
+		socksReply(c, socksBadCommand)
+		return "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socksReply(c, socksBadAddress)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(c, port[:]); err != nil {
+		return "", err
+	}
+	target, err := forwardTarget(host, int(binary.BigEndian.Uint16(port[:])))
+	if err != nil {
+		socksReply(c, socksBadAddress)
+		return "", err
+	}
+	return target, nil
+}
+
+// socksReply answers a CONNECT request. The bound address is left zero:
+// the remote end of the channel isn't known here.
+func socksReply(c net.Conn, code byte) error {
+	_, err := c.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func startSOCKSProxyHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sess, errResult := forwardSession(args)
+	if errResult != nil {
+		return errResult, nil
+	}
+	ln, errResult := listenLocal(args)
+	if errResult != nil {
+		return errResult, nil
+	}
+	f := &forward{SessionID: sess.ID, Kind: ForwardSOCKS, Listen: ln.Addr().String(), ln: ln}
+	forwards.add(f, func(f *forward, c net.Conn) {
+		target, err := socksHandshake(c)
+		if err != nil {
+			logger.Warn("SOCKS request refused", "forward_id", f.ID, "err", err)
+			return
+		}
+		var replied bool
+		connected := func() error {
+			replied = true
+			return socksReply(c, socksSucceeded)
+		}
+		if err := dialVia(f.SessionID, target, c, connected); err != nil {
+			if !replied {
+				socksReply(c, socksFailure)
+			}
+			logger.Warn("SOCKS connection failed", "forward_id", f.ID, "target", target, "err", err)
+		}
+	})
+	port := ln.Addr().(*net.TCPAddr).Port
+	if wantJSON(args) {
+		return jsonResult(describeForward(f)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("SOCKS5 proxy on %s via session %s. Forward ID: %s\nLocal port: %d\nUse e.g. curl --proxy socks5h://%s; close it with close_forward.",
+		f.Listen, sess.Label(), f.ID, port, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))), nil
+}
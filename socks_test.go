@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOCKSProxy(t *testing.T) {
+	fakeSSHForward(t)
+	sess := &Session{ID: "test-socks", Host: "web01", SSH: &SSHOptions{Host: "web01"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	if err := manager.Add(sess); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Remove(sess.ID)
+
+	text, isErr := callTool(startSOCKSProxyHandler, map[string]any{"session_id": "test-socks"})
+	if isErr || !strings.Contains(text, "Local port: ") {
+		t.Fatalf("Expected a proxy, got: %s", text)
+	}
+	listen := forwards.list(sess.ID)[0].Listen
+
+	// connect greets the proxy and sends a request, returning the reply code
+	connect := func(req []byte) (net.Conn, *bufio.Reader, byte) {
+		c, err := net.Dial("tcp", listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(c)
+		c.Write([]byte{5, 1, 0})
+		greeting := make([]byte, 2)
+		if _, err := io.ReadFull(r, greeting); err != nil || !bytes.Equal(greeting, []byte{5, 0}) {
+			t.Fatalf("Expected no authentication to be chosen, got %v, %v", greeting, err)
+		}
+		c.Write(req)
+		reply := make([]byte, 10)
+		if _, err := io.ReadFull(r, reply); err != nil {
+			t.Fatal(err)
+		}
+		return c, r, reply[1]
+	}
+
+	c, r, code := connect(append([]byte{5, 1, 0, 3, 11}, "db.internal\x15\x38"...))
+	defer c.Close()
+	if code != socksSucceeded {
+		t.Fatalf("Expected the connection to succeed, got code %d", code)
+	}
+	if line, _ := r.ReadString('\n'); line != "to db.internal:5432\n" {
+		t.Errorf("Expected the connection to reach db.internal:5432, got %q", line)
+	}
+	c.Write([]byte("ping\n"))
+	if line, _ := r.ReadString('\n'); line != "ping\n" {
+		t.Errorf("Expected the data to be relayed, got %q", line)
+	}
+
+	if _, _, code := connect([]byte{5, 2, 0, 1, 127, 0, 0, 1, 0, 80}); code != socksBadCommand {
+		t.Errorf("Expected BIND to be refused, got code %d", code)
+	}
+	if _, _, code := connect(append([]byte{5, 1, 0, 3, 16}, "-oProxyCommand=x\x00\x50"...)); code != socksBadAddress {
+		t.Errorf("Expected an option-like host to be refused, got code %d", code)
+	}
+
+	if text, _ := callTool(listForwardsHandler, map[string]any{"session_id": "test-socks"}); !strings.Contains(text, "socks "+listen+" -> any") {
+		t.Errorf("Expected the proxy to be listed, got: %s", text)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sshCommand fills in the server-wide settings on opts (config file and
+// connection sharing) and returns the ssh command for it. The native
+// transport runs no command; its destination is only validated and an empty
+// Cmd returned.
+func sshCommand(opts *SSHOptions) (*exec.Cmd, error) {
+	if err := checkBacking(opts); err != nil {
+		return nil, err
+	}
+	if opts.Transport == TransportNative {
+		if _, err := nativeHops(opts); err != nil {
+			return nil, err
+		}
+		return &exec.Cmd{}, nil
+	}
+	if config.SSHConfigFile != "" {
+		if err := checkSSHConfigFile(config.SSHConfigFile); err != nil {
+			return nil, err
+		}
+		opts.ConfigFile = config.SSHConfigFile
+	}
+	if config.ControlMaster {
+		path, err := controlMasters.Path(opts.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up connection sharing: %w", err)
+		}
+		opts.ControlPath = path
+		opts.ControlPersist = config.ControlPersist
+	}
+	sshArgs, err := buildSSHArgs(*opts)
+	if err != nil {
+		return nil, err
+	}
+	if cmd := opts.remoteCommand(); cmd != "" {
+		sshArgs = append(sshArgs, cmd)
+	}
+	sshPath, err := resolveSSHPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(sshPath, sshArgs...)
+	if len(opts.Env) > 0 {
+		setEnv(cmd, opts.Env) // For SendEnv to pick up
+	}
+	return cmd, nil
+}
+
+// isSSHHost reports whether a start_session host is reached over SSH rather
+// than being a local shell, a container, a serial line or a telnet device.
+func isSSHHost(host string) bool {
+	return host != "local" && !containerHost(host) && !isSerialHost(host) && !isTelnetHost(host)
+}
+
+// remoteCommand returns the command line run on the host instead of the
+// login shell, or "" to start the shell.
+func (opts SSHOptions) remoteCommand() string {
+	if len(opts.Command) > 0 {
+		return shellQuoteArgs(opts.Command)
+	}
+	return opts.backingCommand()
+}
+
+// resolveSSHPath returns the configured ssh binary, checking that it exists
+// and is executable.
+func resolveSSHPath() (string, error) {
+	path, err := exec.LookPath(config.SSHPath)
+	if err != nil {
+		return "", fmt.Errorf("ssh binary %q is not usable (check MCPSSH_SSH_PATH): %v", config.SSHPath, err)
+	}
+	return path, nil
+}
+
+// Remote PTY allocation modes, mapping to ssh -tt, -t and -T.
+const (
+	PTYForce   = "force"
+	PTYRequest = "request"
+	PTYDisable = "disable"
+)
+
+// SSHOptions describes how to invoke ssh for a session.
+type SSHOptions struct {
+	Host    string // Host alias, hostname, IP literal or user@host
+	User    string
+	Port    int    // 0 leaves the port to ssh_config
+	PTYMode string // One of the PTY* modes; empty means PTYForce
+
+	Transport string // TransportExec (the ssh binary, also when empty) or TransportNative
+	Password  string // Native transport only; kept in memory for reconnects, never saved or shown
+
+	JumpHosts []string // Intermediate hops ([user@]host[:port]), as ssh -J
+
+	HostKeyPolicy string // One of the HostKey* policies; empty means HostKeyAcceptNew
+
+	IdentityFile string // Private key to authenticate with instead of the agent and default keys
+	Passphrase   string // Decrypts IdentityFile; native transport only, kept like Password
+
+	ConfigFile string // Passed as -F; empty uses ~/.ssh/config
+
+	Env map[string]string // Passed on to the remote shell (SendEnv); may hold secrets, so kept like Password
+
+	StdioForward  string // host:port to connect stdin and stdout to instead of running a shell (ssh -W)
+	RemoteForward string // port:host:port to forward from the remote host instead of running a shell (ssh -N -R)
+
+	Command []string // Program and arguments to run instead of the login shell
+
+	AliveInterval int // Seconds between keepalive probes (ServerAliveInterval); 0 leaves it to ssh_config
+	AliveCountMax int // Unanswered probes before disconnecting (ServerAliveCountMax); 0 for the default
+
+	Backing        string // BackingTmux or BackingScreen to run the shell inside one; empty runs it directly
+	BackingSession string // Name of the tmux or screen session
+
+	// Connection sharing; ControlPath empty disables it
+	ControlPath    string
+	ControlPersist string
+}
+
+// Destination returns a normalized user@host[:port] key identifying where
+// these options connect, for spotting duplicate connections.
+func (opts SSHOptions) Destination() string {
+	dest, err := sshDestination(opts.User, opts.Host)
+	if err != nil {
+		dest = opts.Host
+	}
+	if opts.Port != 0 {
+		dest = fmt.Sprintf("%s:%d", dest, opts.Port)
+	}
+	return dest
+}
+
+// buildSSHArgs returns the argv (excluding the ssh binary itself) for opts.
+func buildSSHArgs(opts SSHOptions) ([]string, error) {
+	dest, err := sshDestination(opts.User, opts.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	var ptyFlag string
+	switch opts.PTYMode {
+	case "", PTYForce:
+		ptyFlag = "-tt" // Force a remote PTY even though our stdin is not a terminal to ssh
+	case PTYRequest:
+		ptyFlag = "-t"
+	case PTYDisable:
+		ptyFlag = "-T" // No remote PTY: no echo or prompt, cleaner output for scripted use
+	default:
+		return nil, fmt.Errorf("invalid pty mode %q (want %s, %s or %s)", opts.PTYMode, PTYForce, PTYRequest, PTYDisable)
+	}
+
+	// BatchMode to fail fast on auth issues
+	args := []string{ptyFlag}
+	if opts.ConfigFile != "" {
+		args = append(args, "-F", opts.ConfigFile)
+	}
+	hostKeyOpts, err := hostKeyArgs(opts.HostKeyPolicy)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "-o", "BatchMode=yes")
+	args = append(args, hostKeyOpts...)
+	args = append(args, sendEnvArgs(opts.Env)...)
+	if opts.AliveInterval > 0 {
+		args = append(args, "-o", "ServerAliveInterval="+strconv.Itoa(opts.AliveInterval))
+	}
+	if opts.AliveCountMax > 0 {
+		args = append(args, "-o", "ServerAliveCountMax="+strconv.Itoa(opts.AliveCountMax))
+	}
+	if len(opts.JumpHosts) > 0 {
+		hops := make([]string, len(opts.JumpHosts))
+		for i, spec := range opts.JumpHosts {
+			hop, err := parseJumpHost(spec)
+			if err != nil {
+				return nil, err
+			}
+			hops[i] = hop.String()
+		}
+		args = append(args, "-J", strings.Join(hops, ","))
+	}
+	if opts.IdentityFile != "" {
+		args = append(args, "-i", opts.IdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+	if opts.Port != 0 {
+		if opts.Port < 1 || opts.Port > 65535 {
+			return nil, fmt.Errorf("invalid port %d", opts.Port)
+		}
+		args = append(args, "-p", strconv.Itoa(opts.Port))
+	}
+	if opts.ControlPath != "" {
+		args = append(args,
+			"-o", "ControlMaster=auto",
+			"-o", "ControlPath="+opts.ControlPath,
+			"-o", "ControlPersist="+opts.ControlPersist,
+		)
+	}
+	if opts.StdioForward != "" {
+		args = append(args, "-W", opts.StdioForward)
+	}
+	if opts.RemoteForward != "" {
+		// Debug output reports whether the remote host accepted the forward
+		args = append(args, "-N", "-o", "ExitOnForwardFailure=yes", "-o", "LogLevel=DEBUG1", "-R", opts.RemoteForward)
+	}
+	// Terminate options so the destination can never be parsed as one
+	return append(args, "--", dest), nil
+}
+
+// unsafeHostChars are characters that never appear in a valid user or host
+// name. We build an argv rather than a shell string, but rejecting them keeps
+// inputs unambiguous and avoids surprises in ssh_config tokens and logs.
+const unsafeHostChars = " \t\r\n;&|`$()<>\\\"'*?!{}"
+
+// jumpHost is one intermediate hop of a ProxyJump chain.
+type jumpHost struct {
+	User string
+	Host string // Without IPv6 brackets
+	Port int    // 0 for the default
+}
+
+// parseJumpHost parses a [user@]host[:port] hop. IPv6 addresses need
+// brackets to carry a port.
+func parseJumpHost(spec string) (jumpHost, error) {
+	var hop jumpHost
+	hostport := spec
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		hop.User, hostport = spec[:i], spec[i+1:]
+	}
+	host := hostport
+	if strings.HasPrefix(hostport, "[") || strings.Count(hostport, ":") == 1 {
+		h, p, err := net.SplitHostPort(hostport)
+		if err == nil {
+			port, perr := strconv.Atoi(p)
+			if perr != nil || port < 1 || port > 65535 {
+				return hop, fmt.Errorf("invalid port in jump host %q", spec)
+			}
+			host, hop.Port = h, port
+		} else if !strings.HasPrefix(hostport, "[") || !strings.HasSuffix(hostport, "]") {
+			return hop, fmt.Errorf("invalid jump host %q", spec)
+		}
+	}
+	dest, err := sshDestination(hop.User, host)
+	if err != nil {
+		return hop, fmt.Errorf("jump host %q: %w", spec, err)
+	}
+	hop.Host = dest[strings.LastIndex(dest, "@")+1:]
+	return hop, nil
+}
+
+// String renders the hop in the [user@]host[:port] form ssh -J takes.
+func (hop jumpHost) String() string {
+	s := hop.Host
+	if hop.Port != 0 {
+		s = net.JoinHostPort(hop.Host, strconv.Itoa(hop.Port))
+	}
+	if hop.User != "" {
+		s = hop.User + "@" + s
+	}
+	return s
+}
+
+// resolveIdentityFile expands a leading ~/ in a private key path and checks
+// that the key is a regular file.
+func resolveIdentityFile(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("identity file: %v", err)
+		}
+		path = filepath.Join(home, rest)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("identity file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("identity file %q is not a regular file", path)
+	}
+	return path, nil
+}
+
+// checkSSHConfigFile verifies that an explicit ssh config file is readable.
+func checkSSHConfigFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("ssh config file (MCPSSH_SSH_CONFIG): %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("ssh config file (MCPSSH_SSH_CONFIG) %q is not a regular file", path)
+	}
+	return nil
+}
+
+// sshDestination composes the destination argument for ssh from an optional
+// user and a host. A user already embedded in host (user@host) is kept as-is.
+func sshDestination(user, host string) (string, error) {
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		if user != "" && user != host[:i] {
+			return "", fmt.Errorf("host %q already specifies a user, conflicting with user %q", host, user)
+		}
+		user, host = host[:i], host[i+1:]
+	}
+
+	host, err := normalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+	if user == "" {
+		return host, nil
+	}
+	if err := validateToken("user", user); err != nil {
+		return "", err
+	}
+	return user + "@" + host, nil
+}
+
+// normalizeHost validates a host name or address. IPv6 literals may be given
+// bracketed ("[fe80::1]") or bare; ssh expects them bare in the destination.
+func normalizeHost(host string) (string, error) {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+		if !isIPv6(host) {
+			return "", fmt.Errorf("invalid IPv6 address %q", host)
+		}
+	}
+	if err := validateToken("host", host); err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(host, "[]") {
+		return "", fmt.Errorf("invalid host %q: unbalanced brackets", host)
+	}
+	return host, nil
+}
+
+// isIPv6 reports whether s is an IPv6 literal, optionally with a zone (fe80::1%eth0).
+func isIPv6(s string) bool {
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && strings.Contains(s, ":")
+}
+
+func validateToken(kind, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s must not be empty", kind)
+	}
+	if strings.HasPrefix(v, "-") {
+		// Would be parsed by ssh as an option (e.g. -oProxyCommand=...)
+		return fmt.Errorf("invalid %s %q: must not start with '-'", kind, v)
+	}
+	if strings.ContainsAny(v, unsafeHostChars) {
+		return fmt.Errorf("invalid %s %q: contains disallowed characters", kind, v)
+	}
+	return nil
+}
+
+// Connection failures worth retrying: the network or name service may simply
+// not be ready yet. Authentication and host key problems never fix themselves
+// and take precedence, so a retry never hammers a host with bad credentials.
+var (
+	retryableSSHErrorRe = regexp.MustCompile(`(?i)connection refused|connection timed out|operation timed out|temporary failure in name resolution|network is unreachable|no route to host|connection reset by peer|i/o timeout|kex_exchange_identification`)
+	fatalSSHErrorRe     = regexp.MustCompile(`(?i)permission denied|host key verification failed|remote host identification has changed|too many authentication failures`)
+)
+
+// retryableSSHError reports whether the output of an ssh process that exited
+// immediately describes a transient connection failure.
+func retryableSSHError(output string) bool {
+	return !fatalSSHErrorRe.MatchString(output) && retryableSSHErrorRe.MatchString(output)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBuildSSHArgs(t *testing.T) {
+	base := []string{"-tt", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new"}
+	tests := []struct {
+		name    string
+		opts    SSHOptions
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "host only",
+			opts: SSHOptions{Host: "web01"},
+			want: append(base, "--", "web01"),
+		},
+		{
+			name: "user and port",
+			opts: SSHOptions{Host: "web01", User: "deploy", Port: 2222},
+			want: append(base, "-p", "2222", "--", "deploy@web01"),
+		},
+		{
+			name: "ipv6 with port",
+			opts: SSHOptions{Host: "[2001:db8::1]", Port: 22},
+			want: append(base, "-p", "22", "--", "2001:db8::1"),
+		},
+		{
+			name: "keepalive",
+			opts: SSHOptions{Host: "web01", AliveInterval: 30, AliveCountMax: 4},
+			want: append(base, "-o", "ServerAliveInterval=30", "-o", "ServerAliveCountMax=4", "--", "web01"),
+		},
+		{
+			name: "control master",
+			opts: SSHOptions{Host: "web01", ControlPath: "/tmp/mcpssh-1/%C", ControlPersist: "10m"},
+			want: append(base,
+				"-o", "ControlMaster=auto",
+				"-o", "ControlPath=/tmp/mcpssh-1/%C",
+				"-o", "ControlPersist=10m",
+				"--", "web01"),
+		},
+		{
+			name: "config file",
+			opts: SSHOptions{Host: "web01", ConfigFile: "/etc/mcpssh/ssh_config"},
+			want: []string{"-tt", "-F", "/etc/mcpssh/ssh_config", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "--", "web01"},
+		},
+		{
+			name: "identity file",
+			opts: SSHOptions{Host: "web01", IdentityFile: "/keys/deploy"},
+			want: append(base, "-i", "/keys/deploy", "-o", "IdentitiesOnly=yes", "--", "web01"),
+		},
+		{
+			name: "jump hosts",
+			opts: SSHOptions{Host: "db01", JumpHosts: []string{"ops@bastion:2222", "[2001:db8::1]:22", "inner"}},
+			want: append(base, "-J", "ops@bastion:2222,[2001:db8::1]:22,inner", "--", "db01"),
+		},
+		{
+			name:    "invalid jump host",
+			opts:    SSHOptions{Host: "db01", JumpHosts: []string{"bastion;id"}},
+			wantErr: true,
+		},
+		{
+			name: "strict host keys",
+			opts: SSHOptions{Host: "web01", HostKeyPolicy: HostKeyStrict},
+			want: []string{"-tt", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes", "--", "web01"},
+		},
+		{
+			name: "host keys off",
+			opts: SSHOptions{Host: "web01", HostKeyPolicy: HostKeyOff},
+			want: []string{"-tt", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "--", "web01"},
+		},
+		{
+			name:    "invalid host key policy",
+			opts:    SSHOptions{Host: "web01", HostKeyPolicy: "yes"},
+			wantErr: true,
+		},
+		{
+			name: "pty request",
+			opts: SSHOptions{Host: "web01", PTYMode: PTYRequest},
+			want: []string{"-t", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "--", "web01"},
+		},
+		{
+			name: "pty disabled",
+			opts: SSHOptions{Host: "web01", PTYMode: PTYDisable},
+			want: []string{"-T", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "--", "web01"},
+		},
+		{
+			name:    "invalid pty mode",
+			opts:    SSHOptions{Host: "web01", PTYMode: "sometimes"},
+			wantErr: true,
+		},
+		{
+			name:    "port out of range",
+			opts:    SSHOptions{Host: "web01", Port: 70000},
+			wantErr: true,
+		},
+		{
+			name:    "invalid host",
+			opts:    SSHOptions{Host: "-oProxyCommand=sh"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildSSHArgs(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildSSHArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildSSHArgs() =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHDestination(t *testing.T) {
+	tests := []struct {
+		user, host string
+		want       string
+		wantErr    bool
+	}{
+		{"", "web01", "web01", false},
+		{"deploy", "web01", "deploy@web01", false},
+		{"", "deploy@web01", "deploy@web01", false},
+		{"deploy", "deploy@web01", "deploy@web01", false},
+		{"root", "deploy@web01", "", true},
+		{"", "fe80::1", "fe80::1", false},
+		{"", "[fe80::1]", "fe80::1", false},
+		{"admin", "[2001:db8::10]", "admin@2001:db8::10", false},
+		{"", "fe80::1%eth0", "fe80::1%eth0", false},
+		{"", "admin@[::1]", "admin@::1", false},
+		{"", "[not-an-ip]", "", true},
+		{"", "fe80::1]", "", true},
+		{"", "", "", true},
+		{"", "-oProxyCommand=sh", "", true},
+		{"-l", "web01", "", true},
+		{"", "web01; rm -rf /", "", true},
+		{"", "web01$(id)", "", true},
+		{"", "web 01", "", true},
+		{"bob`id`", "web01", "", true},
+	}
+	for _, tt := range tests {
+		got, err := sshDestination(tt.user, tt.host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sshDestination(%q, %q) error = %v, wantErr %v", tt.user, tt.host, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("sshDestination(%q, %q) = %q, want %q", tt.user, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSSHPath(t *testing.T) {
+	orig := config.SSHPath
+	defer func() { config.SSHPath = orig }()
+
+	config.SSHPath = "sh" // Any binary on PATH will do
+	if _, err := resolveSSHPath(); err != nil {
+		t.Errorf("Expected sh to resolve: %v", err)
+	}
+
+	config.SSHPath = "/nonexistent/ssh"
+	if _, err := resolveSSHPath(); err == nil {
+		t.Errorf("Expected error for missing binary")
+	}
+
+	config.SSHPath = t.TempDir() + "/ssh"
+	if err := os.WriteFile(config.SSHPath, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveSSHPath(); err == nil {
+		t.Errorf("Expected error for non-executable file")
+	}
+}
+
+func TestCheckSSHConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config"
+	if err := os.WriteFile(path, []byte("Host web01\n  HostName 10.0.0.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSSHConfigFile(path); err != nil {
+		t.Errorf("Expected config file to be accepted: %v", err)
+	}
+	if err := checkSSHConfigFile(dir + "/missing"); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+	if err := checkSSHConfigFile(dir); err == nil {
+		t.Errorf("Expected error for a directory")
+	}
+}
+
+func TestSSHOptionsDestination(t *testing.T) {
+	tests := []struct {
+		opts SSHOptions
+		want string
+	}{
+		{SSHOptions{Host: "web01"}, "web01"},
+		{SSHOptions{Host: "web01", User: "deploy"}, "deploy@web01"},
+		{SSHOptions{Host: "deploy@web01"}, "deploy@web01"},
+		{SSHOptions{Host: "web01", Port: 2222}, "web01:2222"},
+		{SSHOptions{Host: "[::1]"}, "::1"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Destination(); got != tt.want {
+			t.Errorf("%+v.Destination() = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableSSHError(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"ssh: connect to host web01 port 22: Connection refused\r\n", true},
+		{"ssh: connect to host 10.0.0.5 port 22: Connection timed out\r\n", true},
+		{"ssh: Could not resolve hostname web01: Temporary failure in name resolution\r\n", true},
+		{"deploy@web01: Permission denied (publickey).\r\n", false},
+		{"Host key verification failed.\r\n", false},
+		{"ssh: Could not resolve hostname nosuch: Name or service not known\r\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := retryableSSHError(tt.output); got != tt.want {
+			t.Errorf("retryableSSHError(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestParseJumpHost(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    jumpHost
+		wantErr bool
+	}{
+		{"bastion", jumpHost{Host: "bastion"}, false},
+		{"ops@bastion:2222", jumpHost{User: "ops", Host: "bastion", Port: 2222}, false},
+		{"[2001:db8::1]:22", jumpHost{Host: "2001:db8::1", Port: 22}, false},
+		{"[2001:db8::1]", jumpHost{Host: "2001:db8::1"}, false},
+		{"fe80::1", jumpHost{Host: "fe80::1"}, false},
+		{"bastion:0", jumpHost{}, true},
+		{"bastion:ssh", jumpHost{}, true},
+		{"-oProxyCommand=sh", jumpHost{}, true},
+		{"", jumpHost{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseJumpHost(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseJumpHost(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseJumpHost(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
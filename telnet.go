@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// telnetHostPrefix marks a start_session host as a telnet destination,
+// e.g. "telnet:switch01" or "telnet:10.0.0.5:2323", for switches and older
+// appliances that offer no SSH.
+const telnetHostPrefix = "telnet:"
+
+// Telnet protocol bytes (RFC 854) and the options negotiated (RFC 857, 858,
+// 1091 and 1073).
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho  = 1
+	telnetOptSGA   = 3
+	telnetOptTType = 24
+	telnetOptNAWS  = 31
+
+	telnetTTypeIs   = 0
+	telnetTTypeSend = 1
+)
+
+// maxTelnetSubneg bounds the subnegotiation data kept from the server; the
+// only one acted on, a terminal type request, is two bytes.
+const maxTelnetSubneg = 256
+
+// telnetTarget is the host and port a telnet host names.
+type telnetTarget struct {
+	Host string
+	Port int
+}
+
+// String returns the target as host:port.
+func (t telnetTarget) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// isTelnetHost reports whether host names a telnet destination.
+func isTelnetHost(host string) bool {
+	return strings.HasPrefix(host, telnetHostPrefix)
+}
+
+// parseTelnetHost parses a "telnet:<host>[:<port>]" host; the port
+// defaults to 23.
+func parseTelnetHost(host string) (telnetTarget, error) {
+	rest, _ := strings.CutPrefix(host, telnetHostPrefix)
+	target := telnetTarget{Host: strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]"), Port: 23}
+	if h, p, err := net.SplitHostPort(rest); err == nil {
+		target.Host = h
+		if target.Port, err = strconv.Atoi(p); err != nil || target.Port < 1 || target.Port > 65535 {
+			return telnetTarget{}, fmt.Errorf("invalid telnet port %q", p)
+		}
+	}
+	if target.Host == "" {
+		return telnetTarget{}, fmt.Errorf("host %q names no telnet host", host)
+	}
+	if err := validateToken("host", target.Host); err != nil {
+		return telnetTarget{}, err
+	}
+	return target, nil
+}
+
+// Telnet parser states, between and within commands from the server.
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSubneg
+	telnetStateSubnegIAC
+)
+
+// telnetConn is a telnet connection bridged to a socket pair like a native
+// SSH session: the local end stands in for the PTY master, while the bridge
+// strips and answers the server's option negotiation on the way out and
+// encodes input as the network virtual terminal expects on the way in.
+type telnetConn struct {
+	conn net.Conn
+	term string
+
+	mu         sync.Mutex // Serializes writes to conn; guards the fields below
+	rows, cols int
+	naws       bool // The server asked for window size reports
+
+	// Parser state, used only by the goroutine reading from conn
+	state   int
+	verb    byte
+	subneg  []byte
+	cr      bool
+	replied map[[2]byte]bool
+}
+
+// dialTelnet connects to target and returns the local end of the bridge.
+// term answers the server's terminal type request and rows and cols its
+// window size request.
+func dialTelnet(target telnetTarget, term string, rows, cols int) (*os.File, *telnetConn, error) {
+	conn, err := net.DialTimeout("tcp", target.String(), nativeDialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	local, remote, err := socketBridge("telnet")
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	tc := &telnetConn{conn: conn, term: term, rows: rows, cols: cols, replied: make(map[[2]byte]bool)}
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if _, werr := remote.Write(tc.decode(buf[:n])); werr != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		remote.Close() // The reader sees EOF, as with a PTY whose child exited
+	}()
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := remote.Read(buf)
+			if n > 0 {
+				if werr := tc.send(telnetEncode(buf[:n])); werr != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+	return local, tc, nil
+}
+
+// close drops the connection, which ends the session.
+func (tc *telnetConn) close() {
+	tc.conn.Close()
+}
+
+// send writes raw protocol bytes to the server.
+func (tc *telnetConn) send(p []byte) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	_, err := tc.conn.Write(p)
+	return err
+}
+
+// resize records the terminal size and reports it if the server asked.
+func (tc *telnetConn) resize(rows, cols int) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.rows, tc.cols = rows, cols
+	if !tc.naws {
+		return nil
+	}
+	return tc.sendNAWSLocked()
+}
+
+// sendNAWSLocked reports the window size. Callers must hold tc.mu.
+func (tc *telnetConn) sendNAWSLocked() error {
+	size := []byte{byte(tc.cols >> 8), byte(tc.cols), byte(tc.rows >> 8), byte(tc.rows)}
+	msg := append([]byte{telnetIAC, telnetSB, telnetOptNAWS}, telnetEscape(size)...)
+	_, err := tc.conn.Write(append(msg, telnetIAC, telnetSE))
+	return err
+}
+
+// reply answers an option request, once per verb and option so that a
+// server repeating itself can't start a negotiation loop.
+func (tc *telnetConn) reply(verb, opt byte) {
+	key := [2]byte{verb, opt}
+	if tc.replied[key] {
+		return
+	}
+	tc.replied[key] = true
+	tc.send([]byte{telnetIAC, verb, opt})
+}
+
+// negotiate answers a DO, DONT, WILL or WONT from the server. The client
+// reports its terminal type and size; the server may echo and suppress
+// go-ahead, as interactive hosts do. Everything else is refused.
+func (tc *telnetConn) negotiate(verb, opt byte) {
+	switch verb {
+	case telnetDO:
+		switch opt {
+		case telnetOptTType:
+			tc.reply(telnetWILL, opt)
+		case telnetOptNAWS:
+			tc.reply(telnetWILL, opt)
+			tc.mu.Lock()
+			tc.naws = true
+			tc.sendNAWSLocked()
+			tc.mu.Unlock()
+		default:
+			tc.reply(telnetWONT, opt)
+		}
+	case telnetWILL:
+		if opt == telnetOptEcho || opt == telnetOptSGA {
+			tc.reply(telnetDO, opt)
+		} else {
+			tc.reply(telnetDONT, opt)
+		}
+	case telnetDONT:
+		if opt == telnetOptNAWS {
+			tc.mu.Lock()
+			tc.naws = false
+			tc.mu.Unlock()
+		}
+	}
+}
+
+// subnegotiate answers the server's request for the terminal type.
+func (tc *telnetConn) subnegotiate(data []byte) {
+	if len(data) >= 2 && data[0] == telnetOptTType && data[1] == telnetTTypeSend {
+		msg := append([]byte{telnetIAC, telnetSB, telnetOptTType, telnetTTypeIs}, tc.term...)
+		tc.send(append(msg, telnetIAC, telnetSE))
+	}
+}
+
+// decode strips the server's commands from p, answering them, and returns
+// the terminal output. A CR NUL pair, the protocol's bare carriage return,
+// becomes a plain CR. State carries over between calls.
+func (tc *telnetConn) decode(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch tc.state {
+		case telnetStateData:
+			if b == telnetIAC {
+				tc.state = telnetStateIAC
+				continue
+			}
+			if b == 0 && tc.cr {
+				tc.cr = false
+				continue
+			}
+			tc.cr = b == '\r'
+			out = append(out, b)
+		case telnetStateIAC:
+			switch b {
+			case telnetIAC:
+				out = append(out, b) // An escaped 255 data byte
+				tc.state = telnetStateData
+			case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+				tc.verb = b
+				tc.state = telnetStateOption
+			case telnetSB:
+				tc.subneg = tc.subneg[:0]
+				tc.state = telnetStateSubneg
+			default:
+				tc.state = telnetStateData // NOP, GA and the like carry nothing
+			}
+		case telnetStateOption:
+			tc.negotiate(tc.verb, b)
+			tc.state = telnetStateData
+		case telnetStateSubneg:
+			if b == telnetIAC {
+				tc.state = telnetStateSubnegIAC
+			} else if len(tc.subneg) < maxTelnetSubneg {
+				tc.subneg = append(tc.subneg, b)
+			}
+		case telnetStateSubnegIAC:
+			switch b {
+			case telnetSE:
+				tc.subnegotiate(tc.subneg)
+				tc.state = telnetStateData
+			case telnetIAC:
+				if len(tc.subneg) < maxTelnetSubneg {
+					tc.subneg = append(tc.subneg, b)
+				}
+				tc.state = telnetStateSubneg
+			default:
+				tc.state = telnetStateSubneg
+			}
+		}
+	}
+	return out
+}
+
+// telnetEscape doubles any IAC bytes in p, as data must be sent.
+func telnetEscape(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		if b == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// telnetEncode prepares input for the server: IAC bytes are doubled and
+// line endings become the network virtual terminal's CR LF, with a lone CR
+// sent as CR NUL.
+func telnetEncode(p []byte) []byte {
+	out := make([]byte, 0, len(p)+8)
+	for i := 0; i < len(p); i++ {
+		switch b := p[i]; b {
+		case telnetIAC:
+			out = append(out, telnetIAC, telnetIAC)
+		case '\r':
+			if i+1 < len(p) && p[i+1] == '\n' {
+				i++
+				out = append(out, '\r', '\n')
+			} else {
+				out = append(out, '\r', 0)
+			}
+		case '\n':
+			out = append(out, '\r', '\n')
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
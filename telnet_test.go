@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelnetCodec(t *testing.T) {
+	if got := telnetEncode([]byte("a\r\nb\nc\rd\xff")); !bytes.Equal(got, []byte("a\r\nb\r\nc\r\x00d\xff\xff")) {
+		t.Errorf("Unexpected encoding: %q", got)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	tc := &telnetConn{conn: client, term: "dumb", replied: make(map[[2]byte]bool)}
+	// Split mid-command and mid CR NUL, as reads may be
+	out := tc.decode([]byte("one\r\x00two\xff\xfb"))
+	out = append(out, tc.decode([]byte("\x03\xff\xf1x\xff\xff\r"))...)
+	out = append(out, tc.decode([]byte("\x00y\xff\xfa\x18\x01"))...)
+	out = append(out, tc.decode([]byte("\xff\xf0z"))...)
+	if string(out) != "one\rtwox\xff\ryz" {
+		t.Errorf("Unexpected decoding: %q", out)
+	}
+}
+
+func TestTelnetSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Skipping telnet test: %v", err)
+	}
+	defer ln.Close()
+
+	var mu sync.Mutex
+	var received bytes.Buffer
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("\xff\xfd\x18\xff\xfd\x1f\xff\xfb\x01\xff\xfa\x18\x01\xff\xf0login: "))
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			mu.Lock()
+			received.Write(buf[:n])
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			got := received.String()
+			mu.Unlock()
+			if strings.Contains(got, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the server to receive %q, got %q", want, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	host := "telnet:" + ln.Addr().String()
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": host, "command": "sh", "dry_run": true}); !isErr || !strings.Contains(text, "command isn't available") {
+		t.Errorf("Expected command to be rejected for telnet, got: %s", text)
+	}
+	if text, _ := callTool(startSessionHandler, map[string]any{"host": "telnet:switch01", "dry_run": true}); !strings.Contains(text, "Would connect to switch01:23 with telnet") {
+		t.Errorf("Expected the dry run to default to port 23, got: %s", text)
+	}
+
+	text, isErr := callTool(startSessionHandler, map[string]any{"host": host, "name": "telnet-test"})
+	if isErr || !strings.Contains(text, "login: ") || strings.Contains(text, "\xff") {
+		t.Fatalf("Expected the login prompt without protocol bytes, got: %q", text)
+	}
+	sess, _ := manager.Lookup("telnet-test")
+	defer manager.Remove(sess.ID)
+
+	waitFor("\xff\xfb\x18")                 // WILL TTYPE
+	waitFor("\xff\xfa\x1f\x00\x50\x00\x18") // NAWS 80x24
+	waitFor("\xff\xfd\x01")                 // DO ECHO
+	waitFor("\xff\xfa\x18\x00xterm-256color\xff\xf0")
+	callTool(interactSessionHandler, map[string]any{"session_id": "telnet-test", "input": "admin\n", "wait_duration": "0"})
+	waitFor("admin\r\n")
+	if err := sess.Resize(40, 120); err != nil {
+		t.Fatalf("Resize failed: %v", err)
+	}
+	waitFor("\xff\xfa\x1f\x00\x78\x00\x28")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Output filter modes for start_session's output_filter.
+const (
+	FilterNone     = "none"
+	FilterCoalesce = "coalesce" // Collapse runs of identical lines
+	FilterRate     = "rate"     // Drop lines above a per-second limit
+)
+
+// outputThrottle rewrites a high-rate output stream before it is buffered,
+// so floods like 'tail -f' on a busy log don't swamp the session. It is used
+// by the reader under bufMu.
+type outputThrottle struct {
+	mode      string
+	maxPerSec int
+
+	// The start of the current line, already passed through. Partial lines
+	// are never held back so prompts show up immediately.
+	partial []byte
+
+	// coalesce
+	last    []byte
+	hasLast bool
+	repeats int
+
+	// rate
+	windowStart time.Time
+	lines       int
+	omitted     int
+}
+
+func newOutputThrottle(mode string, maxPerSec int) (*outputThrottle, error) {
+	switch mode {
+	case "", FilterNone:
+		return nil, nil
+	case FilterCoalesce:
+	case FilterRate:
+		if maxPerSec <= 0 {
+			return nil, fmt.Errorf("max_lines_per_sec must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("invalid output_filter %q (want %s, %s or %s)", mode, FilterNone, FilterCoalesce, FilterRate)
+	}
+	return &outputThrottle{mode: mode, maxPerSec: maxPerSec}, nil
+}
+
+// write filters p into dst.
+func (t *outputThrottle) write(dst io.Writer, p []byte, now time.Time) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.flush(dst)
+			dst.Write(p)
+			t.partial = append(t.partial, p...)
+			return
+		}
+		rest := p[:i+1]
+		started := len(t.partial) > 0
+		line := append(t.partial, rest...)
+		t.partial = nil
+		t.line(dst, line, rest, started, now)
+		p = p[i+1:]
+	}
+}
+
+// line handles one complete line. Only rest still needs writing if started
+// is set, in which case the line can no longer be suppressed.
+func (t *outputThrottle) line(dst io.Writer, line, rest []byte, started bool, now time.Time) {
+	switch t.mode {
+	case FilterCoalesce:
+		if !started && t.hasLast && bytes.Equal(line, t.last) {
+			t.repeats++
+			return
+		}
+		t.flush(dst)
+		dst.Write(rest)
+		t.last, t.hasLast = line, true
+
+	case FilterRate:
+		if now.Sub(t.windowStart) >= time.Second {
+			t.windowStart = now
+			t.lines = 0
+		}
+		if !started && t.lines >= t.maxPerSec {
+			t.omitted++
+			return
+		}
+		t.flush(dst)
+		dst.Write(rest)
+		t.lines++
+	}
+}
+
+// flush writes a summary of anything suppressed since the last flush.
+func (t *outputThrottle) flush(dst io.Writer) {
+	if t.repeats > 0 {
+		fmt.Fprintf(dst, "[previous line repeated %d more times]\r\n", t.repeats)
+		t.repeats = 0
+	}
+	if t.omitted > 0 {
+		fmt.Fprintf(dst, "[%d lines omitted]\r\n", t.omitted)
+		t.omitted = 0
+	}
+}
+
+// reset forgets suppressed lines without summarizing them, for when the
+// buffered output is being discarded anyway.
+func (t *outputThrottle) reset() {
+	t.hasLast = false
+	t.repeats = 0
+	t.omitted = 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputThrottleCoalesce(t *testing.T) {
+	th, _ := newOutputThrottle(FilterCoalesce, 0)
+	var buf bytes.Buffer
+	now := time.Now()
+	th.write(&buf, []byte("a\r\na\r\na\r\nb\r\n"), now)
+	th.write(&buf, []byte("b\r\nprompt$ "), now)
+	th.flush(&buf)
+
+	want := "a\r\n[previous line repeated 2 more times]\r\nb\r\n[previous line repeated 1 more times]\r\nprompt$ "
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestOutputThrottleRate(t *testing.T) {
+	th, _ := newOutputThrottle(FilterRate, 2)
+	var buf bytes.Buffer
+	now := time.Now()
+	th.write(&buf, []byte("1\n2\n3\n4\n"), now)
+	th.write(&buf, []byte("5\n"), now.Add(1100*time.Millisecond))
+
+	want := "1\n2\n[2 lines omitted]\r\n5\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestOutputThrottleFastProducer(t *testing.T) {
+	for _, mode := range []string{FilterCoalesce, FilterRate} {
+		t.Run(mode, func(t *testing.T) {
+			th, _ := newOutputThrottle(mode, 100)
+			sess := runTestSession(t, &Session{ID: "test-flood-" + mode, throttle: th}, "sh", "-c", "yes | head -n 200000")
+
+			select {
+			case <-sess.exited:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Producer did not finish")
+			}
+			output := sess.ReadAndClear()
+
+			// Chunk boundaries that split a line let a few copies through
+			if lines := strings.Count(output, "y\r\n"); lines > 2000 {
+				t.Errorf("Expected the flood to be throttled, got %d lines", lines)
+			}
+			if !strings.Contains(output, "repeated") && !strings.Contains(output, "omitted") {
+				t.Errorf("Expected a summary of suppressed lines, got:\n%.500s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Transcript formats.
+const (
+	TranscriptText      = "text"      // Plain text log with timestamped input lines
+	TranscriptAsciicast = "asciicast" // asciinema v2 cast file, replayable with timing
+)
+
+func validTranscriptFormat(format string) bool {
+	return format == TranscriptText || format == TranscriptAsciicast
+}
+
+// transcriptTimeFormat timestamps transcript entries.
+const transcriptTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// unsafeFileChars matches characters kept out of transcript file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// transcript records everything sent to and received from a session in a
+// file under config.TranscriptDir, as an audit trail of what was done on
+// the host. In the text format output is written as it arrived and each
+// input is a timestamped line with the bytes quoted, so control characters
+// and the line breaks that were typed are visible. The asciicast format
+// records the same as asciinema v2 events, so the session can be replayed
+// with its original timing. A nil transcript records nothing.
+type transcript struct {
+	mu         sync.Mutex
+	f          *os.File
+	path       string
+	format     string
+	start      time.Time // Asciicast event times are relative to it
+	midLine    bool      // Text: the last output didn't end with a newline
+	partial    []byte    // Asciicast: the start of a UTF-8 character split across reads
+	writeError bool      // A write failure was logged; don't log every one
+}
+
+// newTranscript returns a transcript for a new session if transcripts are
+// enabled. It is opened once the session has its ID.
+func newTranscript() *transcript {
+	if config.TranscriptDir == "" {
+		return nil
+	}
+	return &transcript{format: cmp.Or(config.TranscriptFormat, TranscriptText)}
+}
+
+// open creates the transcript file, named after its start time and the
+// session ID, and writes a header; it does nothing if the file is already
+// open. Failures are logged rather than refusing the session.
+func (t *transcript) open(sess *Session) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f != nil {
+		return
+	}
+	t.start = time.Now()
+	if err := os.MkdirAll(config.TranscriptDir, 0o700); err != nil {
+		logger.Error("cannot create transcript directory", "session_id", sess.ID, "err", err)
+		return
+	}
+	ext := ".log"
+	if t.format == TranscriptAsciicast {
+		ext = ".cast"
+	}
+	name := t.start.Format("20060102-150405") + "-" + unsafeFileChars.ReplaceAllString(sess.ID, "_") + ext
+	t.path = filepath.Join(config.TranscriptDir, name)
+	f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		logger.Error("cannot open transcript", "session_id", sess.ID, "err", err)
+		return
+	}
+	t.f = f
+
+	if t.format == TranscriptAsciicast {
+		rows, cols := sess.Size()
+		header, _ := json.Marshal(map[string]any{
+			"version":   2,
+			"width":     cmp.Or(cols, defaultCols),
+			"height":    cmp.Or(rows, defaultRows),
+			"timestamp": t.start.Unix(),
+			"title":     fmt.Sprintf("mcpssh session %s (host %s)", sess.ID, sess.Host),
+			"env":       map[string]string{"TERM": cmp.Or(sess.Term, defaultTerm)},
+		})
+		t.writeLocked(append(header, '\n'))
+		return
+	}
+	t.writeLocked([]byte(fmt.Sprintf("# mcpssh transcript of session %s (host %s), started %s\n", sess.ID, sess.Host, t.start.Format(transcriptTimeFormat))))
+}
+
+// Path returns the transcript file, or "" if there is none.
+func (t *transcript) Path() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return ""
+	}
+	return t.path
+}
+
+// output records output from the session.
+func (t *transcript) output(p []byte) {
+	if t == nil || len(p) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.format == TranscriptAsciicast {
+		// Events hold strings, so hold back a character split across reads
+		p = append(t.partial, p...)
+		n := len(p) - incompleteRuneLen(p)
+		t.partial = append([]byte(nil), p[n:]...)
+		if n > 0 {
+			t.eventLocked("o", string(p[:n]))
+		}
+		return
+	}
+	t.writeLocked(p)
+	t.midLine = p[len(p)-1] != '\n'
+}
+
+// incompleteRuneLen returns the length of a UTF-8 character cut off at the
+// end of p, or 0 if p ends with a whole one (or with invalid bytes, which
+// waiting won't fix).
+func incompleteRuneLen(p []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		c := p[len(p)-i]
+		if utf8.RuneStart(c) {
+			if c >= utf8.RuneSelf && !utf8.FullRune(p[len(p)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// input records input sent to the session.
+func (t *transcript) input(p []byte) {
+	if t == nil || len(p) == 0 {
+		return
+	}
+	if t.format == TranscriptAsciicast {
+		t.event("i", string(p))
+		return
+	}
+	t.entry(fmt.Sprintf(">>> %q", p))
+}
+
+// resize records a change of terminal size.
+func (t *transcript) resize(rows, cols int) {
+	if t == nil {
+		return
+	}
+	if t.format == TranscriptAsciicast {
+		t.event("r", fmt.Sprintf("%dx%d", cols, rows))
+		return
+	}
+	t.entry(fmt.Sprintf("=== terminal resized to %dx%d", cols, rows))
+}
+
+// note records an event, such as the session exiting. Asciicast files
+// carry it as a marker.
+func (t *transcript) note(format string, args ...any) {
+	if t == nil {
+		return
+	}
+	text := fmt.Sprintf(format, args...)
+	if t.format == TranscriptAsciicast {
+		t.event("m", text)
+		return
+	}
+	t.entry("=== " + text)
+}
+
+// entry writes a timestamped text line, on a line of its own.
+func (t *transcript) entry(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	line := fmt.Sprintf("[%s] %s\n", time.Now().Format(transcriptTimeFormat), text)
+	if t.midLine {
+		line = "\n" + line
+		t.midLine = false
+	}
+	t.writeLocked([]byte(line))
+}
+
+// event writes an asciicast event of the given type.
+func (t *transcript) event(kind, data string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.eventLocked(kind, data)
+}
+
+func (t *transcript) eventLocked(kind, data string) {
+	elapsed := time.Since(t.start).Round(time.Microsecond).Seconds()
+	line, _ := json.Marshal([]any{elapsed, kind, data})
+	t.writeLocked(append(line, '\n'))
+}
+
+func (t *transcript) writeLocked(p []byte) {
+	if t.f == nil {
+		return
+	}
+	if _, err := t.f.Write(p); err != nil && !t.writeError {
+		t.writeError = true
+		logger.Error("transcript write failed; further failures are not logged", "path", t.path, "err", err)
+	}
+}
+
+// close closes the transcript file. Later records are dropped.
+func (t *transcript) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f != nil {
+		t.f.Close()
+		t.f = nil
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscript(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	saved := config
+	defer func() { config = saved }()
+	config.TranscriptDir = filepath.Join(t.TempDir(), "transcripts")
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "transcript-test"}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("transcript-test")
+	path := sess.describe().Transcript
+	if filepath.Dir(path) != config.TranscriptDir || !strings.Contains(filepath.Base(path), sess.ID) {
+		t.Fatalf("Expected a transcript named after the session in %s, got %q", config.TranscriptDir, path)
+	}
+
+	sess.Write([]byte("echo transcript-$((6*7))\n"))
+	waitForPattern(context.Background(), sess, regexp.MustCompile(`transcript-42`), 2*time.Second)
+	// Like sudo, which turns echo off and reads the password
+	sess.Write([]byte("stty -echo; read -r pw\n"))
+	time.Sleep(200 * time.Millisecond)
+	sess.WriteSecret([]byte("hunter2\n"), "sudo password")
+	manager.Remove(sess.ID)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"# mcpssh transcript of session " + sess.ID,
+		`>>> "echo transcript-$((6*7))\n"`, // Input, quoted
+		"transcript-42",                    // Output
+		"=== sent sudo password (8 bytes, redacted)",
+		"=== session closed",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected the transcript to contain %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "hunter2") {
+		t.Errorf("Secret leaked into the transcript:\n%s", text)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the transcript to be private, got mode %v", info.Mode().Perm())
+	}
+}
+
+func TestTranscriptAsciicast(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	saved := config
+	defer func() { config = saved }()
+	config.TranscriptDir = t.TempDir()
+	config.TranscriptFormat = TranscriptAsciicast
+
+	if text, isErr := callTool(startSessionHandler, map[string]any{"host": "local", "name": "cast-test", "cols": 100}); isErr {
+		t.Skipf("Skipping local session test: %s", text)
+	}
+	sess, _ := manager.Lookup("cast-test")
+	path := sess.describe().Transcript
+	if filepath.Ext(path) != ".cast" {
+		t.Fatalf("Expected a .cast file, got %q", path)
+	}
+	sess.Write([]byte("echo cast-$((6*7))\n"))
+	waitForPattern(context.Background(), sess, regexp.MustCompile(`cast-42`), 2*time.Second)
+	sess.Resize(30, 120)
+	manager.Remove(sess.ID)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var header struct {
+		Version, Width, Height int
+		Env                    map[string]string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width != 100 || header.Height != defaultRows {
+		t.Errorf("Unexpected header %s (%v)", lines[0], err)
+	}
+	events := map[string]string{}
+	last := 0.0
+	for _, line := range lines[1:] {
+		var ev []any
+		if err := json.Unmarshal([]byte(line), &ev); err != nil || len(ev) != 3 {
+			t.Fatalf("Invalid event %s (%v)", line, err)
+		}
+		at, kind, text := ev[0].(float64), ev[1].(string), ev[2].(string)
+		if at < last {
+			t.Errorf("Event times go backwards: %s", line)
+		}
+		last = at
+		events[kind] += text
+	}
+	if !strings.Contains(events["i"], "echo cast-$((6*7))\n") || !strings.Contains(events["o"], "cast-42") ||
+		events["r"] != "120x30" || !strings.Contains(events["m"], "session closed") {
+		t.Errorf("Missing events: %q", events)
+	}
+}
+
+func TestTranscriptAsciicastSplitRune(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "split.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &transcript{format: TranscriptAsciicast, f: f, start: time.Now()}
+	euro := []byte("€") // 3 bytes
+	tr.output(append([]byte("price: "), euro[:1]...))
+	tr.output(euro[1:2])
+	tr.output(append(euro[2:], '\n'))
+	tr.close()
+
+	data, _ := os.ReadFile(f.Name())
+	var text string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var ev []any
+		json.Unmarshal([]byte(line), &ev)
+		text += ev[2].(string)
+	}
+	if text != "price: €\n" {
+		t.Errorf("Expected the split character to be rejoined, got %q", text)
+	}
+}
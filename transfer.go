@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// runRemote runs command on a session's host over a separate channel, out
+// of band of the PTY, so binary data passes through untouched. SSH sessions
+// get a fresh non-PTY ssh invocation with the session's options (reusing the
+// shared connection when connection sharing is on); native sessions open a
+// new channel on their existing connection. Local sessions run it with sh.
+func runRemote(sess *Session, command string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	var err error
+	if sess.native != nil {
+		rs, serr := sess.native.client.NewSession()
+		if serr != nil {
+			return serr
+		}
+		defer rs.Close()
+		rs.Stdin, rs.Stdout, rs.Stderr = stdin, stdout, &stderr
+		err = rs.Run(command)
+	} else {
+		c, cerr := remoteCommand(sess, command)
+		if cerr != nil {
+			return cerr
+		}
+		c.Stdin, c.Stdout, c.Stderr = stdin, stdout, &stderr
+		err = c.Run()
+	}
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// remoteCommand builds the process that runs command for a session that
+// uses the ssh binary, for a container or pod session, or for a local session.
+func remoteCommand(sess *Session, command string) (*exec.Cmd, error) {
+	if container, ok := dockerContainer(sess.Host); ok {
+		if err := checkContainerAllowed(sess.Host); err != nil {
+			return nil, err
+		}
+		path, err := resolveDockerPath()
+		if err != nil {
+			return nil, err
+		}
+		return exec.Command(path, "exec", "-i", container, "/bin/sh", "-c", command), nil
+	}
+	if isSerialHost(sess.Host) || isTelnetHost(sess.Host) {
+		return nil, fmt.Errorf("file transfer isn't available for serial or telnet sessions")
+	}
+	if _, _, ok := kubePod(sess.Host); ok {
+		if err := checkContainerAllowed(sess.Host); err != nil {
+			return nil, err
+		}
+		return kubectlExec(sess.Host, sess.PodContainer, false, "/bin/sh", "-c", command)
+	}
+	if sess.SSH == nil {
+		if err := checkLocalAllowed(); err != nil {
+			return nil, err
+		}
+		return exec.Command("/bin/sh", "-c", command), nil
+	}
+	opts := *sess.SSH
+	opts.PTYMode = PTYDisable // A PTY would mangle binary data
+	args, err := buildSSHArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+	path, err := resolveSSHPath()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(path, append(args, command)...), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func uploadFileHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	remotePath := args.GetString("remote_path", "")
+	if remotePath == "" {
+		return mcp.NewToolResultError("remote_path is required"), nil
+	}
+	localPath := args.GetString("local_path", "")
+	content, hasContent := args.GetArguments()["content_base64"].(string)
+	if (localPath == "") == !hasContent {
+		return mcp.NewToolResultError("Pass exactly one of local_path or content_base64"), nil
+	}
+	mode := args.GetString("mode", "")
+	if mode != "" {
+		if m, err := strconv.ParseUint(mode, 8, 32); err != nil || m > 0o7777 {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid mode %q (want octal, e.g. 0755)", mode)), nil
+		}
+	}
+
+	var src io.Reader
+	if hasContent {
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid content_base64: %v", err)), nil
+		}
+		src = bytes.NewReader(data)
+	} else {
+		// Reads a file on the server, which is local access
+		if err := checkLocalAllowed(); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		f, err := os.Open(localPath)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to open local_path: %v", err)), nil
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+			return mcp.NewToolResultError(fmt.Sprintf("local_path %q is not a regular file", localPath)), nil
+		}
+		src = f
+	}
+
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason())), nil
+	}
+	if err := sess.checkWritable(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	quoted := shellQuoteArgs([]string{remotePath})
+	command := "cat > " + quoted
+	if mode != "" {
+		command += " && chmod " + mode + " " + quoted
+	}
+	counted := &countingReader{r: src}
+	if err := runRemote(sess, command, counted, io.Discard); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Upload failed: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Uploaded %d bytes to %s:%s", counted.n, sess.Host, remotePath)), nil
+}
+
+type downloadResult struct {
+	RemotePath string `json:"remote_path"`
+	Bytes      int64  `json:"bytes"`
+	LocalPath  string `json:"local_path,omitempty"`
+	Encoding   string `json:"encoding,omitempty"` // "text" or "base64" for inline content
+	Content    string `json:"content,omitempty"`
+}
+
+func downloadFileHandler(ctx context.Context, args mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	remotePath := args.GetString("remote_path", "")
+	if remotePath == "" {
+		return mcp.NewToolResultError("remote_path is required"), nil
+	}
+	localPath := args.GetString("local_path", "")
+	if localPath != "" {
+		// Writes a file on the server, which is local access
+		if err := checkLocalAllowed(); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	sess, ok := manager.Lookup(args.GetString("session_id", ""))
+	if !ok {
+		return mcp.NewToolResultError("Session not found"), nil
+	}
+	if !sess.Alive() {
+		return mcp.NewToolResultError(fmt.Sprintf("Session is dead (%s)", sess.DeadReason())), nil
+	}
+
+	quoted := shellQuoteArgs([]string{remotePath})
+	res := downloadResult{RemotePath: remotePath, LocalPath: localPath}
+	if localPath != "" {
+		n, err := downloadTo(sess, "cat -- "+quoted, localPath)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Download failed: %v", err)), nil
+		}
+		res.Bytes = n
+		if wantJSON(args) {
+			return jsonResult(res), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Downloaded %d bytes from %s:%s to %s", n, sess.Host, remotePath, localPath)), nil
+	}
+
+	// Fetch one byte past the limit to tell a file of exactly the limit
+	// from a larger one, without transferring all of a huge file
+	var buf bytes.Buffer
+	command := fmt.Sprintf("head -c %d -- %s", config.MaxDownload+1, quoted)
+	if err := runRemote(sess, command, nil, &buf); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Download failed: %v", err)), nil
+	}
+	if buf.Len() > config.MaxDownload {
+		return mcp.NewToolResultError(fmt.Sprintf("%s is larger than %d bytes (MCPSSH_MAX_DOWNLOAD_BYTES); pass local_path to save it instead", remotePath, config.MaxDownload)), nil
+	}
+	res.Bytes = int64(buf.Len())
+	if isText(buf.String()) {
+		res.Encoding, res.Content = "text", buf.String()
+	} else {
+		res.Encoding, res.Content = "base64", base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	if wantJSON(args) {
+		return jsonResult(res), nil
+	}
+	encoding := ""
+	if res.Encoding == "base64" {
+		encoding = ", binary, base64-encoded"
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Content of %s:%s (%d bytes%s):\n%s", sess.Host, remotePath, res.Bytes, encoding, res.Content)), nil
+}
+
+// downloadTo streams the output of command into path via a temporary file
+// and a rename, so a failed transfer never leaves a partial file behind.
+func downloadTo(sess *Session, command, path string) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	counted := &countingWriter{w: tmp}
+	err = runRemote(sess, command, nil, counted)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return counted.n, os.Rename(tmp.Name(), path)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeSSH installs an ssh stand-in that runs the remote command locally, so
+// the exec transport's out-of-band commands can be tested without a server.
+func fakeSSH(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ssh")
+	body := "#!/bin/sh\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift 2\nexec /bin/sh -c \"$1\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.SSHPath
+	t.Cleanup(func() { config.SSHPath = saved })
+	config.SSHPath = script
+}
+
+func callTool(h func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) (string, bool) {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = args
+	result, _ := h(context.Background(), req)
+	return result.Content[0].(mcp.TextContent).Text, result.IsError
+}
+
+// binaryPayload covers bytes a PTY would mangle: NUL, ^C, ^D, CR and high bytes.
+var binaryPayload = []byte("#!/bin/sh\x00\x03\x04\r\n\xff\xfe end")
+
+func TestUploadFile(t *testing.T) {
+	fakeSSH(t)
+	sess := &Session{ID: "test-upload", Host: "web01", SSH: &SSHOptions{Host: "web01"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "it's a script.sh")
+	text, isErr := callTool(uploadFileHandler, map[string]any{
+		"session_id":     sess.ID,
+		"remote_path":    dest,
+		"content_base64": base64.StdEncoding.EncodeToString(binaryPayload),
+		"mode":           "0750",
+	})
+	if isErr {
+		t.Fatalf("upload_file failed: %s", text)
+	}
+	if !strings.Contains(text, fmt.Sprintf("Uploaded %d bytes", len(binaryPayload))) {
+		t.Errorf("Unexpected result: %s", text)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil || !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Uploaded content = %q, %v; want %q", got, err, binaryPayload)
+	}
+	if info, _ := os.Stat(dest); info == nil || info.Mode().Perm() != 0o750 {
+		t.Errorf("Expected mode 0750, got %v", info.Mode())
+	}
+
+	src := filepath.Join(dir, "src.bin")
+	os.WriteFile(src, binaryPayload, 0o600)
+	if text, isErr := callTool(uploadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": dest + ".2", "local_path": src}); isErr {
+		t.Errorf("upload_file from local_path failed: %s", text)
+	}
+	if got, _ := os.ReadFile(dest + ".2"); !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Uploaded content = %q, want %q", got, binaryPayload)
+	}
+
+	for _, args := range []map[string]any{
+		{"session_id": sess.ID, "remote_path": dest},
+		{"session_id": sess.ID, "remote_path": dest, "local_path": src, "content_base64": ""},
+		{"session_id": sess.ID, "remote_path": dest, "content_base64": "!!"},
+		{"session_id": sess.ID, "remote_path": dest, "content_base64": "", "mode": "rwx"},
+	} {
+		if text, isErr := callTool(uploadFileHandler, args); !isErr {
+			t.Errorf("Expected %v to be rejected, got: %s", args, text)
+		}
+	}
+	if text, isErr := callTool(uploadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": filepath.Join(dir, "missing", "x"), "content_base64": ""}); !isErr || !strings.Contains(text, "Upload failed") {
+		t.Errorf("Expected a failing remote command to be reported, got: %s", text)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	fakeSSH(t)
+	sess := &Session{ID: "test-download", Host: "web01", SSH: &SSHOptions{Host: "web01"}, Cmd: exec.Command("true"), done: make(chan struct{}), exited: make(chan struct{})}
+	manager.Add(sess)
+	defer manager.Remove(sess.ID)
+
+	dir := t.TempDir()
+	textFile := filepath.Join(dir, "app.log")
+	binFile := filepath.Join(dir, "core.bin")
+	os.WriteFile(textFile, []byte("line one\nline two\n"), 0o644)
+	os.WriteFile(binFile, binaryPayload, 0o644)
+
+	if text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": textFile}); isErr || !strings.HasSuffix(text, "(18 bytes):\nline one\nline two\n") {
+		t.Errorf("Expected text content inline, got: %s", text)
+	}
+	text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": binFile, "format": "json"})
+	var res downloadResult
+	if err := json.Unmarshal([]byte(text), &res); isErr || err != nil {
+		t.Fatalf("download_file failed: %s", text)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(res.Content); res.Encoding != "base64" || !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Expected binary content base64-encoded, got %+v", res)
+	}
+
+	local := filepath.Join(dir, "copy.bin")
+	if text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": binFile, "local_path": local}); isErr {
+		t.Errorf("download_file to local_path failed: %s", text)
+	}
+	if got, _ := os.ReadFile(local); !bytes.Equal(got, binaryPayload) {
+		t.Errorf("Saved content = %q, want %q", got, binaryPayload)
+	}
+	if text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": filepath.Join(dir, "missing"), "local_path": filepath.Join(dir, "never")}); !isErr || !strings.Contains(text, "Download failed") {
+		t.Errorf("Expected a missing remote file to fail, got: %s", text)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "never")); err == nil {
+		t.Errorf("A failed download must not leave a file behind")
+	}
+
+	saved := config.MaxDownload
+	defer func() { config.MaxDownload = saved }()
+	config.MaxDownload = 18
+	if _, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": textFile}); isErr {
+		t.Errorf("A file of exactly the limit should be returned")
+	}
+	config.MaxDownload = 17
+	if text, isErr := callTool(downloadFileHandler, map[string]any{"session_id": sess.ID, "remote_path": textFile}); !isErr || !strings.Contains(text, "local_path") {
+		t.Errorf("Expected an oversized file to be refused with a hint, got: %s", text)
+	}
+}